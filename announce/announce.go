@@ -6,12 +6,14 @@ package announce
 
 import (
 	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/gnomon"
 	"github.com/bitmark-inc/bitmarkd/pool"
 	"sync"
 )
 
 // maximum entries in the list
 const (
+	announceMaximum    = 1000 // of each listener type, the oldest are removed
 	certificateMaximum = 200
 )
 
@@ -21,6 +23,10 @@ var announce struct {
 	peerPool        *pool.IndexedPool
 	rpcPool         *pool.IndexedPool
 	certificatePool *pool.Pool
+
+	// number of entries in each indexed pool
+	peerCount int
+	rpcCount  int
 }
 
 // initialise the pools
@@ -31,9 +37,32 @@ func Initialise() {
 	if nil != announce.peerPool || nil != announce.rpcPool || nil != announce.certificatePool {
 		fault.Panic("announce.Initialise - already done")
 	}
-	announce.peerPool = pool.NewIndexed(pool.Peers) //, announceMaximum)
-	announce.rpcPool = pool.NewIndexed(pool.RPCs)   //, announceMaximum)
+	announce.peerPool = pool.NewIndexed(pool.Peers)
+	announce.rpcPool = pool.NewIndexed(pool.RPCs)
 	announce.certificatePool = pool.New(pool.Certificates, certificateMaximum)
+
+	announce.peerCount = countEntries(announce.peerPool)
+	announce.rpcCount = countEntries(announce.rpcPool)
+}
+
+// number of entries already stored in an indexed pool
+func countEntries(p *pool.IndexedPool) int {
+	n := 0
+	cursor := &gnomon.Cursor{}
+	for {
+		entries, nextStart, err := p.Recent(cursor, announceMaximum, func(key []byte, value []byte) interface{} {
+			return nil
+		})
+		if nil != err {
+			fault.Criticalf("announce.Initialise - count error: %v", err)
+			fault.PanicWithError("announce.Initialise", err)
+		}
+		n += len(entries)
+		if len(entries) < announceMaximum {
+			return n
+		}
+		cursor = nextStart
+	}
 }
 
 // close the pools
@@ -20,11 +20,17 @@ const (
 )
 
 // a type to store data about a peer
+//
+// an RPC listener is identified by its certificate fingerprint and a
+// peer listener by its Z85 encoded curve public key
 type PeerData struct {
 	Fingerprint *util.FingerprintBytes
+	PublicKey   string
 }
 
 // add a peer announcement to the corresponding LRU
+//
+// when the pool is full the oldest announcements are removed
 func AddPeer(address string, listenType int, data *PeerData) (bool, error) {
 
 	newlyAdded := false
@@ -36,15 +42,75 @@ func AddPeer(address string, listenType int, data *PeerData) (bool, error) {
 		return newlyAdded, err
 	}
 
+	announce.Lock()
+	defer announce.Unlock()
+
+	thePool, count, err := poolOf(listenType)
+	if nil != err {
+		return newlyAdded, err
+	}
+
+	newlyAdded, err = thePool.Add([]byte(address), buffer.Bytes())
+	if nil != err || !newlyAdded {
+		return newlyAdded, err
+	}
+	*count += 1
+
+	excess := *count - announceMaximum
+	if excess <= 0 {
+		return newlyAdded, nil
+	}
+	oldest, _, err := thePool.Recent(&gnomon.Cursor{}, excess, nil)
+	if nil != err {
+		return newlyAdded, err
+	}
+	for _, e := range oldest {
+		if err := thePool.Remove(e.(pool.Element).Key); nil != err {
+			return newlyAdded, err
+		}
+		*count -= 1
+	}
+	return newlyAdded, nil
+}
+
+// remove a peer announcement
+//
+// returns true if it was present
+func RemovePeer(address string, listenType int) (bool, error) {
+
+	announce.Lock()
+	defer announce.Unlock()
+
+	thePool, count, err := poolOf(listenType)
+	if nil != err {
+		return false, err
+	}
+
+	if _, err := thePool.Get([]byte(address)); fault.ErrKeyNotFound == err {
+		return false, nil
+	} else if nil != err {
+		return false, err
+	}
+
+	if err := thePool.Remove([]byte(address)); nil != err {
+		return false, err
+	}
+	*count -= 1
+	return true, nil
+}
+
+// the pool and its entry count for a type of listener
+//
+// must be called with the lock held
+func poolOf(listenType int) (*pool.IndexedPool, *int, error) {
 	switch listenType {
 	case TypePeer:
-		newlyAdded, err = announce.peerPool.Add([]byte(address), buffer.Bytes())
+		return announce.peerPool, &announce.peerCount, nil
 	case TypeRPC:
-		newlyAdded, err = announce.rpcPool.Add([]byte(address), buffer.Bytes())
+		return announce.rpcPool, &announce.rpcCount, nil
 	default:
-		err = fault.ErrInvalidType
+		return nil, nil, fault.ErrInvalidType
 	}
-	return newlyAdded, err
 }
 
 // look up a p2p neighbour in the LRU
@@ -0,0 +1,66 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package announce
+
+import (
+	"fmt"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"os"
+	"testing"
+)
+
+// test database file
+const limitDatabase = "limit.leveldb"
+
+// test the oldest announcements are removed when the pool is full
+func TestAnnounceMaximum(t *testing.T) {
+	os.RemoveAll(limitDatabase)
+	pool.Initialise(limitDatabase)
+	Initialise()
+	defer func() {
+		Finalise()
+		pool.Finalise()
+		os.RemoveAll(limitDatabase)
+	}()
+
+	address := func(i int) string {
+		return fmt.Sprintf("192.0.2.1:%d", 1000+i)
+	}
+
+	extra := 5
+	for i := 0; i < announceMaximum+extra; i += 1 {
+		if _, err := AddPeer(address(i), TypePeer, &PeerData{PublicKey: "key"}); nil != err {
+			t.Fatalf("%d: add peer error: %v", i, err)
+		}
+	}
+	if announceMaximum != announce.peerCount {
+		t.Errorf("count: %d  expected: %d", announce.peerCount, announceMaximum)
+	}
+	for i := 0; i < extra; i += 1 {
+		if _, err := GetPeer(address(i), TypePeer); nil == err {
+			t.Errorf("%d: oldest was not removed", i)
+		}
+	}
+	if _, err := GetPeer(address(extra), TypePeer); nil != err {
+		t.Errorf("newer was removed: %v", err)
+	}
+
+	// counted again after a restart
+	Finalise()
+	Initialise()
+	if announceMaximum != announce.peerCount {
+		t.Errorf("count after restart: %d  expected: %d", announce.peerCount, announceMaximum)
+	}
+
+	if removed, err := RemovePeer(address(extra), TypePeer); nil != err || !removed {
+		t.Errorf("remove: %v  error: %v", removed, err)
+	}
+	if removed, err := RemovePeer(address(extra), TypePeer); nil != err || removed {
+		t.Errorf("remove again: %v  error: %v", removed, err)
+	}
+	if announceMaximum-1 != announce.peerCount {
+		t.Errorf("count after remove: %d  expected: %d", announce.peerCount, announceMaximum-1)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Offline wallet for creating, signing and submitting transactions
+//
+// private keys are kept in an encrypted keystore, the passphrase is
+// read from the terminal or from BITMARK_WALLET_PASSWORD
+//
+// records are signed locally and printed as JSON, add -s to send
+// them to bitmarkd instead, a printed record can be moved to an
+// online machine and sent later with the submit command
+//
+// a certificate holds the provenance of a bitmark with the block
+// header and merkle branch for each record, so it can be checked
+// later by the verify command without access to bitmarkd, each
+// header must meet the difficulty given by -d, which should be
+// taken from a trusted view of the network
+//
+//   bitmark-wallet [-t] generate NAME
+//   bitmark-wallet [-t] list
+//   bitmark-wallet [-t] [-s] asset NAME ASSET-NAME FINGERPRINT DESCRIPTION
+//   bitmark-wallet [-t] [-s] issue NAME ASSET-INDEX [NONCE]
+//   bitmark-wallet [-t] [-s] transfer NAME LINK NEW-OWNER
+//   bitmark-wallet [-t] submit FILE
+//   bitmark-wallet [-t] provenance TXID [COUNT]
+//   bitmark-wallet [-t] certificate TXID [FILE]
+//   bitmark-wallet [-d DIFFICULTY] verify FILE
+package main
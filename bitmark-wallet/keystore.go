@@ -0,0 +1,266 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/agl/ed25519"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// keystore format and key derivation parameters
+const (
+	keystoreVersion = 1
+
+	saltLength = 32
+	scryptN    = 32768
+	scryptR    = 8
+	scryptP    = 1
+	aesKeySize = 32
+)
+
+// errors
+var (
+	errKeyExists        = errors.New("key already exists")
+	errKeyNotFound      = errors.New("key not found")
+	errWrongPassphrase  = errors.New("wrong passphrase")
+	errInvalidKeystore  = errors.New("invalid keystore")
+	errKeystoreNotFound = errors.New("keystore not found")
+)
+
+// the file contents
+type keystore struct {
+	Version int                   `json:"version"`
+	Keys    map[string]*storedKey `json:"keys"`
+}
+
+// one encrypted private key
+//
+// the public key is stored in clear so records can be prepared
+// without the passphrase
+type storedKey struct {
+	PublicKey string `json:"publicKey"` // hex
+	Test      bool   `json:"test"`
+	Salt      string `json:"salt"`       // hex: for scrypt
+	Nonce     string `json:"nonce"`      // hex: for AES-GCM
+	Encrypted string `json:"privateKey"` // hex: AES-GCM sealed private key
+}
+
+// a decrypted key pair
+type keyPair struct {
+	publicKey  [ed25519.PublicKeySize]byte
+	privateKey [ed25519.PrivateKeySize]byte
+	test       bool
+}
+
+// read the keystore, a missing file is an empty keystore
+func readKeystore(fileName string) (*keystore, error) {
+	ks := &keystore{
+		Version: keystoreVersion,
+		Keys:    make(map[string]*storedKey),
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return ks, nil
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, ks)
+	if nil != err {
+		return nil, err
+	}
+	if keystoreVersion != ks.Version || nil == ks.Keys {
+		return nil, errInvalidKeystore
+	}
+	return ks, nil
+}
+
+// write the keystore readable only by the user
+//
+// write to a temporary file first so a failure cannot lose keys
+func (ks *keystore) write(fileName string) error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if nil != err {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fileName), 0700)
+	if nil != err {
+		return err
+	}
+
+	temporary := fileName + ".new"
+	err = ioutil.WriteFile(temporary, data, 0600)
+	if nil != err {
+		return err
+	}
+	return os.Rename(temporary, fileName)
+}
+
+// sorted list of key names
+func (ks *keystore) names() []string {
+	names := make([]string, 0, len(ks.Keys))
+	for name := range ks.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// create a new random key pair and store it encrypted
+func (ks *keystore) generate(name string, passphrase []byte, test bool) (*transaction.Address, error) {
+	if _, found := ks.Keys[name]; found {
+		return nil, errKeyExists
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		return nil, err
+	}
+
+	salt := make([]byte, saltLength)
+	_, err = rand.Read(salt)
+	if nil != err {
+		return nil, err
+	}
+
+	aead, err := newCipher(passphrase, salt)
+	if nil != err {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if nil != err {
+		return nil, err
+	}
+
+	// public key is authenticated so it cannot be swapped in the file
+	encrypted := aead.Seal(nil, nonce, privateKey[:], publicKey[:])
+
+	ks.Keys[name] = &storedKey{
+		PublicKey: hex.EncodeToString(publicKey[:]),
+		Test:      test,
+		Salt:      hex.EncodeToString(salt),
+		Nonce:     hex.EncodeToString(nonce),
+		Encrypted: hex.EncodeToString(encrypted),
+	}
+
+	return makeAddress(publicKey, test), nil
+}
+
+// the public address of a key
+func (ks *keystore) address(name string) (*transaction.Address, error) {
+	key, found := ks.Keys[name]
+	if !found {
+		return nil, errKeyNotFound
+	}
+
+	publicKey := [ed25519.PublicKeySize]byte{}
+	b, err := hex.DecodeString(key.PublicKey)
+	if nil != err || len(publicKey) != len(b) {
+		return nil, errInvalidKeystore
+	}
+	copy(publicKey[:], b)
+
+	return makeAddress(&publicKey, key.Test), nil
+}
+
+// decrypt a key pair
+func (ks *keystore) unlock(name string, passphrase []byte) (*keyPair, error) {
+	key, found := ks.Keys[name]
+	if !found {
+		return nil, errKeyNotFound
+	}
+
+	publicKey, err := hex.DecodeString(key.PublicKey)
+	if nil != err || ed25519.PublicKeySize != len(publicKey) {
+		return nil, errInvalidKeystore
+	}
+	salt, err := hex.DecodeString(key.Salt)
+	if nil != err {
+		return nil, errInvalidKeystore
+	}
+	nonce, err := hex.DecodeString(key.Nonce)
+	if nil != err {
+		return nil, errInvalidKeystore
+	}
+	encrypted, err := hex.DecodeString(key.Encrypted)
+	if nil != err {
+		return nil, errInvalidKeystore
+	}
+
+	aead, err := newCipher(passphrase, salt)
+	if nil != err {
+		return nil, err
+	}
+	if aead.NonceSize() != len(nonce) {
+		return nil, errInvalidKeystore
+	}
+
+	privateKey, err := aead.Open(nil, nonce, encrypted, publicKey)
+	if nil != err {
+		return nil, errWrongPassphrase
+	}
+
+	// ed25519 private key has the public key as its second half
+	if ed25519.PrivateKeySize != len(privateKey) || !bytes.Equal(privateKey[32:], publicKey) {
+		return nil, errInvalidKeystore
+	}
+
+	pair := &keyPair{
+		test: key.Test,
+	}
+	copy(pair.publicKey[:], publicKey)
+	copy(pair.privateKey[:], privateKey)
+	return pair, nil
+}
+
+// derive the AES key from the passphrase
+func newCipher(passphrase []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, aesKeySize)
+	if nil != err {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// the address of a key pair
+func (pair *keyPair) address() *transaction.Address {
+	return makeAddress(&pair.publicKey, pair.test)
+}
+
+// sign a message
+func (pair *keyPair) sign(message []byte) transaction.Signature {
+	signature := ed25519.Sign(&pair.privateKey, message)
+	return signature[:]
+}
+
+// helper to make an address
+func makeAddress(publicKey *[ed25519.PublicKeySize]byte, test bool) *transaction.Address {
+	return &transaction.Address{
+		AddressInterface: &transaction.ED25519Address{
+			Test:      test,
+			PublicKey: publicKey,
+		},
+	}
+}
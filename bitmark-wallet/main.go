@@ -0,0 +1,436 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/bitmark-inc/bitmarkd/difficulty"
+	"github.com/bitmark-inc/bitmarkd/mode"
+	"github.com/bitmark-inc/bitmarkd/rpc"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"github.com/bitmark-inc/bitmarkd/util"
+	"github.com/bitmark-inc/exitwithstatus"
+	flags "github.com/jessevdk/go-flags"
+	"golang.org/x/crypto/ssh/terminal"
+	"io/ioutil"
+	netrpc "net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// environment variable to supply the passphrase without a terminal
+const passphraseVariable = "BITMARK_WALLET_PASSWORD"
+
+// defaults
+var (
+	appHomeDirectory       = util.AppDataDir("bitmarkd", false)
+	defaultKeystoreFile    = filepath.Join(appHomeDirectory, "wallet.json")
+	defaultCertificateFile = filepath.Join(appHomeDirectory, "bitmarkd-local-rpc.crt")
+	defaultConnect         = "127.0.0.1:2130"
+	defaultProvenanceCount = 20
+)
+
+type commandOptions struct {
+	Version     bool   `short:"V" long:"version" description:"Display version information and exit"`
+	Verbose     bool   `short:"v" long:"verbose" description:"Show JSON requests and responses"`
+	TestNet     bool   `short:"t" long:"testnet" description:"Use test network addresses"`
+	Submit      bool   `short:"s" long:"submit" description:"Send signed records to bitmarkd instead of printing them"`
+	Keystore    string `short:"k" long:"keystore" description:"Encrypted keystore file"`
+	Certificate string `short:"C" long:"certificate" description:"Certificate of the bitmarkd RPC server"`
+	Connect     string `short:"r" long:"connect" description:"bitmarkd RPC IP:port"`
+
+	Difficulty float64 `short:"d" long:"difficulty" description:"Minimum difficulty of certificate block headers, e.g. the current network difficulty"`
+
+	Args struct {
+		Command   string   `name:"command" description:"Command: use 'help' to show list of commands"`
+		Arguments []string `name:"args" description:"A optional arguments for command"`
+	} `positional-args:"yes"`
+}
+
+// the main program
+func main() {
+	// ensure exit handler is first
+	defer exitwithstatus.Handler()
+
+	options := commandOptions{
+		Keystore:    defaultKeystoreFile,
+		Certificate: defaultCertificateFile,
+		Connect:     defaultConnect,
+		Difficulty:  1.0, // network minimum
+	}
+
+	parser := flags.NewParser(&options, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			exitwithstatus.Usage("Error: %v\n", err)
+		}
+		exitwithstatus.Exit(1)
+	}
+
+	if options.Version {
+		exitwithstatus.Usage("Version: %s\n", Version())
+	}
+
+	// addresses are only accepted for the selected network
+	mode.SetTesting(options.TestNet)
+
+	arguments := options.Args.Arguments
+
+	switch options.Args.Command {
+	case "generate":
+		if 1 != len(arguments) {
+			exitwithstatus.Usage("generate needs: NAME\n")
+		}
+		ks := openKeystore(options.Keystore)
+		passphrase := readPassphrase(true)
+		address, err := ks.generate(arguments[0], passphrase, options.TestNet)
+		if nil != err {
+			exitwithstatus.Usage("generate error: %v\n", err)
+		}
+		err = ks.write(options.Keystore)
+		if nil != err {
+			exitwithstatus.Usage("keystore: %q  write error: %v\n", options.Keystore, err)
+		}
+		fmt.Printf("%s\t%s\n", arguments[0], address)
+
+	case "list":
+		ks := openKeystore(options.Keystore)
+		for _, name := range ks.names() {
+			address, err := ks.address(name)
+			if nil != err {
+				fmt.Printf("%s\t%v\n", name, err)
+				continue
+			}
+			fmt.Printf("%s\t%s\n", name, address)
+		}
+
+	case "asset":
+		if 4 != len(arguments) {
+			exitwithstatus.Usage("asset needs: NAME ASSET-NAME FINGERPRINT DESCRIPTION\n")
+		}
+		pair := unlockKey(options.Keystore, arguments[0])
+		record, err := makeAsset(pair, arguments[1], arguments[2], arguments[3])
+		output(&options, record, err)
+
+	case "issue":
+		if len(arguments) < 2 || len(arguments) > 3 {
+			exitwithstatus.Usage("issue needs: NAME ASSET-INDEX [NONCE]\n")
+		}
+		var assetIndex transaction.AssetIndex
+		if _, err := fmt.Sscan(arguments[1], &assetIndex); nil != err {
+			exitwithstatus.Usage("invalid asset index: %q  error: %v\n", arguments[1], err)
+		}
+		nonce := uint64(time.Now().UTC().UnixNano())
+		if 3 == len(arguments) {
+			nonce, err = strconv.ParseUint(arguments[2], 10, 64)
+			if nil != err {
+				exitwithstatus.Usage("invalid nonce: %q  error: %v\n", arguments[2], err)
+			}
+		}
+		pair := unlockKey(options.Keystore, arguments[0])
+		record, err := makeIssue(pair, assetIndex, nonce)
+		output(&options, record, err)
+
+	case "transfer":
+		if 3 != len(arguments) {
+			exitwithstatus.Usage("transfer needs: NAME LINK NEW-OWNER\n")
+		}
+		var link transaction.Link
+		if _, err := fmt.Sscan(arguments[1], &link); nil != err {
+			exitwithstatus.Usage("invalid link: %q  error: %v\n", arguments[1], err)
+		}
+		owner, err := transaction.AddressFromBase58(arguments[2])
+		if nil != err {
+			exitwithstatus.Usage("invalid owner: %q  error: %v\n", arguments[2], err)
+		}
+		pair := unlockKey(options.Keystore, arguments[0])
+		record, err := makeTransfer(pair, link, owner)
+		output(&options, record, err)
+
+	case "submit":
+		if 1 != len(arguments) {
+			exitwithstatus.Usage("submit needs: FILE\n")
+		}
+		data, err := ioutil.ReadFile(arguments[0])
+		if nil != err {
+			exitwithstatus.Usage("file: %q  read error: %v\n", arguments[0], err)
+		}
+		method, record, err := readSignedRecord(data)
+		if nil != err {
+			exitwithstatus.Usage("file: %q  error: %v\n", arguments[0], err)
+		}
+		submit(&options, method, record)
+
+	case "provenance":
+		if len(arguments) < 1 || len(arguments) > 2 {
+			exitwithstatus.Usage("provenance needs: TXID [COUNT]\n")
+		}
+		var txId transaction.Link
+		if _, err := fmt.Sscan(arguments[0], &txId); nil != err {
+			exitwithstatus.Usage("invalid txid: %q  error: %v\n", arguments[0], err)
+		}
+		count := defaultProvenanceCount
+		if 2 == len(arguments) {
+			count, err = strconv.Atoi(arguments[1])
+			if nil != err || count <= 0 {
+				exitwithstatus.Usage("invalid count: %q\n", arguments[1])
+			}
+		}
+		provenance(&options, txId, count)
+
+	case "certificate":
+		if len(arguments) < 1 || len(arguments) > 2 {
+			exitwithstatus.Usage("certificate needs: TXID [FILE]\n")
+		}
+		var txId transaction.Link
+		if _, err := fmt.Sscan(arguments[0], &txId); nil != err {
+			exitwithstatus.Usage("invalid txid: %q  error: %v\n", arguments[0], err)
+		}
+		fileName := ""
+		if 2 == len(arguments) {
+			fileName = arguments[1]
+		}
+		certificate(&options, txId, fileName)
+
+	case "verify":
+		if 1 != len(arguments) {
+			exitwithstatus.Usage("verify needs: FILE\n")
+		}
+		data, err := ioutil.ReadFile(arguments[0])
+		if nil != err {
+			exitwithstatus.Usage("file: %q  read error: %v\n", arguments[0], err)
+		}
+		var c transaction.Certificate
+		err = json.Unmarshal(data, &c)
+		if nil != err {
+			exitwithstatus.Usage("file: %q  error: %v\n", arguments[0], err)
+		}
+		verifyCertificate(&options, &c)
+
+	case "", "help":
+		exitwithstatus.Usage("commands: generate list asset issue transfer submit provenance certificate verify\n")
+
+	default:
+		exitwithstatus.Usage("invalid command: %s\n", options.Args.Command)
+	}
+}
+
+// read the keystore or exit
+func openKeystore(fileName string) *keystore {
+	ks, err := readKeystore(fileName)
+	if nil != err {
+		exitwithstatus.Usage("keystore: %q  error: %v\n", fileName, err)
+	}
+	return ks
+}
+
+// decrypt a key or exit
+func unlockKey(fileName string, name string) *keyPair {
+	ks := openKeystore(fileName)
+	if _, found := ks.Keys[name]; !found {
+		exitwithstatus.Usage("keystore: %q  has no key: %q\n", fileName, name)
+	}
+	pair, err := ks.unlock(name, readPassphrase(false))
+	if nil != err {
+		exitwithstatus.Usage("key: %q  error: %v\n", name, err)
+	}
+	return pair
+}
+
+// get the passphrase from the environment or the terminal
+//
+// a new passphrase must be entered twice
+func readPassphrase(confirm bool) []byte {
+	if p := os.Getenv(passphraseVariable); "" != p {
+		return []byte(p)
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		exitwithstatus.Usage("no terminal: set %s to supply the passphrase\n", passphraseVariable)
+	}
+
+	fmt.Fprintf(os.Stderr, "passphrase: ")
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintf(os.Stderr, "\n")
+	if nil != err {
+		exitwithstatus.Usage("passphrase error: %v\n", err)
+	}
+	if 0 == len(passphrase) {
+		exitwithstatus.Usage("empty passphrase\n")
+	}
+
+	if confirm {
+		fmt.Fprintf(os.Stderr, "confirm passphrase: ")
+		again, err := terminal.ReadPassword(fd)
+		fmt.Fprintf(os.Stderr, "\n")
+		if nil != err {
+			exitwithstatus.Usage("passphrase error: %v\n", err)
+		}
+		if !bytes.Equal(passphrase, again) {
+			exitwithstatus.Usage("passphrases do not match\n")
+		}
+	}
+	return passphrase
+}
+
+// print a signed record or send it to bitmarkd
+func output(options *commandOptions, record *signedRecord, err error) {
+	if nil != err {
+		exitwithstatus.Usage("signing error: %v\n", err)
+	}
+	if options.Submit {
+		submit(options, record.Method, record.Record)
+		return
+	}
+	printJSON(record)
+}
+
+// send a record to bitmarkd
+func submit(options *commandOptions, method string, record interface{}) {
+	client := connect(options)
+	defer client.Close()
+
+	if options.Verbose {
+		fmt.Printf("JSON request:\n")
+		printJSON(record)
+	}
+
+	var reply interface{}
+	err := client.Call(method, record, &reply)
+	if nil != err {
+		exitwithstatus.Usage("%s error: %v\n", method, err)
+	}
+	printJSON(reply)
+}
+
+// fetch provenance and check it locally
+func provenance(options *commandOptions, txId transaction.Link, count int) {
+	client := connect(options)
+	defer client.Close()
+
+	arguments := rpc.ProvenanceArguments{
+		TxId:  txId,
+		Count: count,
+	}
+	var reply struct {
+		Data []provenanceItem `json:"data"`
+	}
+	err := client.Call("Bitmark.Provenance", &arguments, &reply)
+	if nil != err {
+		exitwithstatus.Usage("Bitmark.Provenance error: %v\n", err)
+	}
+
+	if options.Verbose {
+		printJSON(reply.Data)
+	}
+
+	for _, item := range reply.Data {
+		fmt.Printf("%-28s %s  %s\n", item.Record, item.State, item.TxId)
+	}
+
+	err = verifyProvenance(reply.Data)
+	if nil != err {
+		exitwithstatus.Usage("verification failed: %v\n", err)
+	}
+	fmt.Printf("verified: %d records\n", len(reply.Data))
+}
+
+// fetch a certificate, check it locally and print or save it
+func certificate(options *commandOptions, txId transaction.Link, fileName string) {
+	client := connect(options)
+	defer client.Close()
+
+	arguments := rpc.CertificateArguments{
+		TxId: txId,
+	}
+	var reply rpc.CertificateReply
+	err := client.Call("Bitmark.Certificate", &arguments, &reply)
+	if nil != err {
+		exitwithstatus.Usage("Bitmark.Certificate error: %v\n", err)
+	}
+	if nil == reply.Certificate {
+		exitwithstatus.Usage("Bitmark.Certificate: empty reply\n")
+	}
+
+	if "" == fileName {
+		printJSON(reply.Certificate)
+	}
+
+	verifyCertificate(options, reply.Certificate)
+
+	if "" != fileName {
+		data, err := json.MarshalIndent(reply.Certificate, "", "  ")
+		if nil != err {
+			exitwithstatus.Usage("certificate error: %v\n", err)
+		}
+		err = ioutil.WriteFile(fileName, data, 0644)
+		if nil != err {
+			exitwithstatus.Usage("file: %q  write error: %v\n", fileName, err)
+		}
+		fmt.Printf("saved: %s\n", fileName)
+	}
+}
+
+// check a certificate without contacting bitmarkd
+//
+// the block numbers and header digests are printed so that they can
+// be compared with a trusted copy of the chain
+func verifyCertificate(options *commandOptions, c *transaction.Certificate) {
+	minimum := difficulty.New()
+	minimum.SetPdiff(options.Difficulty)
+
+	link, asset, err := c.Verify(minimum)
+	if nil != err {
+		exitwithstatus.Usage("verification failed: %v\n", err)
+	}
+
+	for _, r := range c.Records {
+		fmt.Printf("block: %8d  %s  txid: %s\n", r.Inclusion.Number, r.Inclusion.Header.Digest(), r.Packed.MakeLink())
+	}
+	fmt.Printf("asset: %q  fingerprint: %q\n", asset.Name, asset.Fingerprint)
+	fmt.Printf("bitmark: %s\n", link)
+	fmt.Printf("verified: %d records\n", len(c.Records))
+}
+
+// connect to bitmarkd RPC
+func connect(options *commandOptions) *netrpc.Client {
+
+	pemData, err := ioutil.ReadFile(options.Certificate)
+	if nil != err {
+		exitwithstatus.Usage("certificate: %q  error: %v\n", options.Certificate, err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pemData) {
+		exitwithstatus.Usage("failed to parse certificate file: %q\n", options.Certificate)
+	}
+
+	conn, err := tls.Dial("tcp", options.Connect, &tls.Config{
+		RootCAs: roots,
+	})
+	if nil != err {
+		exitwithstatus.Usage("connect: %s  error: %v\n", options.Connect, err)
+	}
+
+	return jsonrpc.NewClient(conn)
+}
+
+// display any value as indented JSON
+func printJSON(value interface{}) {
+	b, err := json.MarshalIndent(value, "", "  ")
+	if nil != err {
+		exitwithstatus.Usage("json error: %v\n", err)
+	}
+	fmt.Printf("%s\n", b)
+}
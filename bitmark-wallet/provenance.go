@@ -0,0 +1,196 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+)
+
+// errors
+var (
+	errBrokenChain          = errors.New("provenance chain is broken")
+	errIncompleteProvenance = errors.New("provenance does not reach the asset")
+	errUnknownRecord        = errors.New("unknown record type")
+)
+
+// one item of the Bitmark.Provenance reply as seen by a client
+type provenanceItem struct {
+	Record string           `json:"record"`
+	TxId   transaction.Link `json:"txid"`
+	State  string           `json:"state"`
+	Data   json.RawMessage  `json:"data"`
+}
+
+// decode the record in a provenance item
+func (item *provenanceItem) decode() (interface{}, error) {
+	var record interface{}
+	switch item.Record {
+	case "AssetData":
+		record = &transaction.AssetData{}
+	case "BitmarkIssue":
+		record = &transaction.BitmarkIssue{}
+	case "BitmarkBatchIssue":
+		record = &transaction.BitmarkBatchIssue{}
+	case "BitmarkTransfer":
+		record = &transaction.BitmarkTransfer{}
+	case "BitmarkCountersignedTransfer":
+		record = &transaction.BitmarkCountersignedTransfer{}
+	case "BitmarkBurn":
+		record = &transaction.BitmarkBurn{}
+	default:
+		return nil, errUnknownRecord
+	}
+	err := json.Unmarshal(item.Data, record)
+	if nil != err {
+		return nil, err
+	}
+	return record, nil
+}
+
+// check a provenance chain without trusting the node that supplied it
+//
+// items are newest first and must end at the AssetData, each record
+// is re-packed so that its signature is checked against the owner of
+// the record before it and its txid is recomputed
+func verifyProvenance(items []provenanceItem) error {
+
+	records := make([]interface{}, len(items))
+	for i := range items {
+		record, err := items[i].decode()
+		if nil != err {
+			return err
+		}
+		records[i] = record
+	}
+
+	if 0 == len(records) {
+		return errIncompleteProvenance
+	}
+	if _, ok := records[len(records)-1].(*transaction.AssetData); !ok {
+		return errIncompleteProvenance
+	}
+
+	for i, record := range records {
+
+		link := items[i].TxId
+
+		switch record.(type) {
+		case *transaction.AssetData:
+			asset := record.(*transaction.AssetData)
+			packed, err := asset.Pack(asset.Registrant)
+			if nil != err {
+				return err
+			}
+			if packed.MakeLink() != link {
+				return errBrokenChain
+			}
+
+		case *transaction.BitmarkIssue:
+			issue := record.(*transaction.BitmarkIssue)
+			packed, err := issue.Pack(issue.Owner)
+			if nil != err {
+				return err
+			}
+			if packed.MakeLink() != link {
+				return errBrokenChain
+			}
+			asset, ok := records[i+1].(*transaction.AssetData)
+			if !ok || asset.AssetIndex() != issue.AssetIndex {
+				return errBrokenChain
+			}
+
+		case *transaction.BitmarkBatchIssue:
+			batch := record.(*transaction.BitmarkBatchIssue)
+			packed, err := batch.Pack(batch.Owner)
+			if nil != err {
+				return err
+			}
+			if !inBatch(packed.MakeLink(), batch, link) {
+				return errBrokenChain
+			}
+			asset, ok := records[i+1].(*transaction.AssetData)
+			if !ok || asset.AssetIndex() != batch.AssetIndex {
+				return errBrokenChain
+			}
+
+		case *transaction.BitmarkTransfer:
+			transfer := record.(*transaction.BitmarkTransfer)
+			if transfer.Link != items[i+1].TxId {
+				return errBrokenChain
+			}
+			packed, err := transfer.Pack(ownerOf(records[i+1]))
+			if nil != err {
+				return err
+			}
+			if packed.MakeLink() != link {
+				return errBrokenChain
+			}
+
+		case *transaction.BitmarkCountersignedTransfer:
+			transfer := record.(*transaction.BitmarkCountersignedTransfer)
+			if transfer.Link != items[i+1].TxId {
+				return errBrokenChain
+			}
+			packed, err := transfer.Pack(ownerOf(records[i+1]))
+			if nil != err {
+				return err
+			}
+			if packed.MakeLink() != link {
+				return errBrokenChain
+			}
+
+		case *transaction.BitmarkBurn:
+			burn := record.(*transaction.BitmarkBurn)
+			if burn.Link != items[i+1].TxId {
+				return errBrokenChain
+			}
+			packed, err := burn.Pack(ownerOf(records[i+1]))
+			if nil != err {
+				return err
+			}
+			if packed.MakeLink() != link {
+				return errBrokenChain
+			}
+		}
+	}
+	return nil
+}
+
+// the owner of a bitmark after a record
+//
+// returns an address that never verifies for a record without an owner
+func ownerOf(record interface{}) *transaction.Address {
+	switch record.(type) {
+	case *transaction.BitmarkIssue:
+		return record.(*transaction.BitmarkIssue).Owner
+	case *transaction.BitmarkBatchIssue:
+		return record.(*transaction.BitmarkBatchIssue).Owner
+	case *transaction.BitmarkTransfer:
+		return record.(*transaction.BitmarkTransfer).Owner
+	case *transaction.BitmarkCountersignedTransfer:
+		return record.(*transaction.BitmarkCountersignedTransfer).Owner
+	default:
+		return &transaction.Address{
+			AddressInterface: &transaction.NothingAddress{
+				PublicKey: &[2]byte{},
+			},
+		}
+	}
+}
+
+// check if a link is the batch itself or one of its bitmarks
+func inBatch(txId transaction.Link, batch *transaction.BitmarkBatchIssue, link transaction.Link) bool {
+	if txId == link {
+		return true
+	}
+	for i := uint64(0); i < batch.Count; i += 1 {
+		if transaction.BatchItemLink(txId, batch.Nonce+i) == link {
+			return true
+		}
+	}
+	return false
+}
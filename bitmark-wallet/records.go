@@ -0,0 +1,154 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+)
+
+// errors
+var (
+	errTxIdMismatch = errors.New("txid does not match packed record")
+)
+
+// a signed record ready to be sent to bitmarkd
+//
+// this is the output of the signing commands and the input to submit
+type signedRecord struct {
+	Method string             `json:"method"`
+	TxId   transaction.Link   `json:"txid"`
+	Packed transaction.Packed `json:"packed"`
+	Record interface{}        `json:"record"`
+}
+
+// any record that can be signed
+type packer interface {
+	Pack(address *transaction.Address) (transaction.Packed, error)
+}
+
+// sign a record
+//
+// the first Pack returns the unsigned message because the signature
+// is empty, the second Pack checks the signature
+func sign(record packer, signature *transaction.Signature, pair *keyPair) (transaction.Packed, error) {
+	address := pair.address()
+
+	*signature = nil
+	message, err := record.Pack(address)
+	if fault.ErrInvalidSignature != err {
+		if nil == err {
+			err = fault.ErrInvalidSignature
+		}
+		return nil, err
+	}
+
+	*signature = pair.sign(message)
+	return record.Pack(address)
+}
+
+// build a signed asset registration
+func makeAsset(pair *keyPair, name string, fingerprint string, description string) (*signedRecord, error) {
+	r := &transaction.AssetData{
+		Description: description,
+		Name:        name,
+		Fingerprint: fingerprint,
+		Registrant:  pair.address(),
+	}
+	packed, err := sign(r, &r.Signature, pair)
+	if nil != err {
+		return nil, err
+	}
+	return newSignedRecord("Asset.Register", packed, r), nil
+}
+
+// build a signed issue
+func makeIssue(pair *keyPair, assetIndex transaction.AssetIndex, nonce uint64) (*signedRecord, error) {
+	r := &transaction.BitmarkIssue{
+		AssetIndex: assetIndex,
+		Owner:      pair.address(),
+		Nonce:      nonce,
+	}
+	packed, err := sign(r, &r.Signature, pair)
+	if nil != err {
+		return nil, err
+	}
+	return newSignedRecord("Bitmark.Issue", packed, r), nil
+}
+
+// build a signed transfer
+//
+// the key must be the current owner of the linked record
+func makeTransfer(pair *keyPair, link transaction.Link, owner *transaction.Address) (*signedRecord, error) {
+	r := &transaction.BitmarkTransfer{
+		Link:  link,
+		Owner: owner,
+	}
+	packed, err := sign(r, &r.Signature, pair)
+	if nil != err {
+		return nil, err
+	}
+	return newSignedRecord("Bitmark.Transfer", packed, r), nil
+}
+
+// wrap the record for output
+func newSignedRecord(method string, packed transaction.Packed, record interface{}) *signedRecord {
+	return &signedRecord{
+		Method: method,
+		TxId:   packed.MakeLink(),
+		Packed: packed,
+		Record: record,
+	}
+}
+
+// the submit command input
+type signedInput struct {
+	Method string           `json:"method"`
+	TxId   transaction.Link `json:"txid"`
+	Packed string           `json:"packed"` // hex
+}
+
+// recover a record from the output of a signing command
+//
+// the record is rebuilt from the packed bytes so that a modified
+// JSON record cannot be submitted by mistake
+func readSignedRecord(data []byte) (string, interface{}, error) {
+	var input signedInput
+	err := json.Unmarshal(data, &input)
+	if nil != err {
+		return "", nil, err
+	}
+
+	packed, err := hex.DecodeString(input.Packed)
+	if nil != err {
+		return "", nil, err
+	}
+	if transaction.Packed(packed).MakeLink() != input.TxId {
+		return "", nil, errTxIdMismatch
+	}
+	record, err := transaction.Packed(packed).Unpack()
+	if nil != err {
+		return "", nil, err
+	}
+
+	method := ""
+	switch record.(type) {
+	case *transaction.AssetData:
+		method = "Asset.Register"
+	case *transaction.BitmarkIssue:
+		method = "Bitmark.Issue"
+	case *transaction.BitmarkTransfer:
+		method = "Bitmark.Transfer"
+	default:
+		return "", nil, fault.ErrNotTransactionType
+	}
+	if method != input.Method {
+		return "", nil, fault.ErrNotTransactionType
+	}
+	return method, record, nil
+}
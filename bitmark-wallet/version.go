@@ -0,0 +1,15 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+// the version
+var (
+	version string = "1"
+)
+
+// Return string representation of version
+func Version() string {
+	return version
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"github.com/agl/ed25519"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// check keys survive a write/read cycle and need the passphrase
+func TestKeystore(t *testing.T) {
+
+	directory, err := ioutil.TempDir("", "bitmark-wallet")
+	if nil != err {
+		t.Fatalf("temporary directory error: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	fileName := filepath.Join(directory, "wallet.json")
+	passphrase := []byte("correct horse battery staple")
+
+	ks, err := readKeystore(fileName)
+	if nil != err {
+		t.Fatalf("new keystore error: %v", err)
+	}
+
+	address, err := ks.generate("alice", passphrase, false)
+	if nil != err {
+		t.Fatalf("generate error: %v", err)
+	}
+	if _, err := ks.generate("alice", passphrase, false); errKeyExists != err {
+		t.Errorf("duplicate name: expected errKeyExists but got: %v", err)
+	}
+
+	err = ks.write(fileName)
+	if nil != err {
+		t.Fatalf("write error: %v", err)
+	}
+
+	ks, err = readKeystore(fileName)
+	if nil != err {
+		t.Fatalf("read error: %v", err)
+	}
+
+	stored, err := ks.address("alice")
+	if nil != err {
+		t.Fatalf("address error: %v", err)
+	}
+	if stored.String() != address.String() {
+		t.Errorf("address: %s  expected: %s", stored, address)
+	}
+
+	if _, err := ks.unlock("alice", []byte("wrong")); errWrongPassphrase != err {
+		t.Errorf("wrong passphrase: expected errWrongPassphrase but got: %v", err)
+	}
+	if _, err := ks.unlock("bob", passphrase); errKeyNotFound != err {
+		t.Errorf("missing key: expected errKeyNotFound but got: %v", err)
+	}
+
+	pair, err := ks.unlock("alice", passphrase)
+	if nil != err {
+		t.Fatalf("unlock error: %v", err)
+	}
+	message := []byte("message")
+	signature := pair.sign(message)
+	if err := address.CheckSignature(message, signature); nil != err {
+		t.Errorf("signature error: %v", err)
+	}
+}
+
+// sign a chain of records and check it as a client would
+func TestVerifyProvenance(t *testing.T) {
+
+	registrant := newKeyPair(t)
+	owner := newKeyPair(t)
+
+	asset, err := makeAsset(registrant, "Item's Name", "0123456789abcdef", "Just the description")
+	if nil != err {
+		t.Fatalf("asset error: %v", err)
+	}
+	assetIndex := asset.Record.(*transaction.AssetData).AssetIndex()
+
+	issue, err := makeIssue(registrant, assetIndex, 99)
+	if nil != err {
+		t.Fatalf("issue error: %v", err)
+	}
+
+	transfer, err := makeTransfer(registrant, issue.TxId, owner.address())
+	if nil != err {
+		t.Fatalf("transfer error: %v", err)
+	}
+
+	items := []provenanceItem{
+		toItem(t, "BitmarkTransfer", transfer),
+		toItem(t, "BitmarkIssue", issue),
+		toItem(t, "AssetData", asset),
+	}
+
+	if err := verifyProvenance(items); nil != err {
+		t.Errorf("verify error: %v", err)
+	}
+
+	// must reach the asset
+	if err := verifyProvenance(items[:2]); errIncompleteProvenance != err {
+		t.Errorf("truncated: expected errIncompleteProvenance but got: %v", err)
+	}
+
+	// transfer not signed by the previous owner
+	forged, err := makeTransfer(owner, issue.TxId, owner.address())
+	if nil != err {
+		t.Fatalf("forged transfer error: %v", err)
+	}
+	items[0] = toItem(t, "BitmarkTransfer", forged)
+	if err := verifyProvenance(items); nil == err {
+		t.Errorf("forged transfer was accepted")
+	}
+
+	// record does not match its txid
+	items[0] = toItem(t, "BitmarkTransfer", transfer)
+	items[0].TxId = issue.TxId
+	if err := verifyProvenance(items); errBrokenChain != err {
+		t.Errorf("wrong txid: expected errBrokenChain but got: %v", err)
+	}
+
+	// an issue must be followed by its asset
+	items = []provenanceItem{
+		toItem(t, "BitmarkIssue", issue),
+		toItem(t, "BitmarkIssue", issue),
+		toItem(t, "AssetData", asset),
+	}
+	if err := verifyProvenance(items); errBrokenChain != err {
+		t.Errorf("issue of issue: expected errBrokenChain but got: %v", err)
+	}
+}
+
+// make a random key pair
+func newKeyPair(t *testing.T) *keyPair {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("generate key error: %v", err)
+	}
+	return &keyPair{
+		publicKey:  *publicKey,
+		privateKey: *privateKey,
+	}
+}
+
+// convert a signed record to the JSON form returned by Bitmark.Provenance
+func toItem(t *testing.T, kind string, record *signedRecord) provenanceItem {
+	data, err := json.Marshal(record.Record)
+	if nil != err {
+		t.Fatalf("json error: %v", err)
+	}
+	return provenanceItem{
+		Record: kind,
+		TxId:   record.TxId,
+		State:  "Mined",
+		Data:   data,
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/bitmark-inc/bitmarkd/mode"
 	"github.com/bitmark-inc/bitmarkd/payment"
 	"github.com/bitmark-inc/bitmarkd/peer"
+	"github.com/bitmark-inc/bitmarkd/policy"
 	"github.com/bitmark-inc/bitmarkd/pool"
 	"github.com/bitmark-inc/bitmarkd/rpc"
 	"github.com/bitmark-inc/bitmarkd/transaction"
@@ -35,6 +36,7 @@ type serverChannel struct {
 	keyFileName         string
 	callback            listener.Callback
 	argument            interface{}
+	clientCertificates  bool // request certificates from clients
 
 	// filled in later
 	tlsConfiguration *tls.Config
@@ -176,6 +178,9 @@ func main() {
 		exitwithstatus.Exit(1)
 	}
 
+	// shared by both mining listeners so failed log ins are counted together
+	workers := mineWorkers(options.MineWorkers)
+
 	servers := map[string]*serverChannel{
 		"rpc": {
 			limit:               options.RPCClients,
@@ -184,7 +189,9 @@ func main() {
 			keyFileName:         options.RPCKey,
 			callback:            rpc.Callback,
 			argument: &rpc.ServerArgument{
-				Log: rpcLog,
+				Log:   rpcLog,
+				Quota: rpc.NewClientQuota(options.ClientQuota),
+				Admin: options.RPCAdmin,
 			},
 		},
 		// "peer": {
@@ -203,10 +210,30 @@ func main() {
 			certificateFileName: options.MineCertificate,
 			keyFileName:         options.MineKey,
 			callback:            mine.Callback,
+			clientCertificates:  true,
 			argument: &mine.ServerArgument{
-				Log: mineLog,
+				Log:               mineLog,
+				Workers:           workers,
+				ShareInterval:     options.MineShareInterval,
+				MinimumDifficulty: options.MineMinimumDifficulty,
 			},
 		},
+		"template": {
+			limit:               options.Mines,
+			addresses:           options.MineTemplateListeners,
+			certificateFileName: options.MineCertificate,
+			keyFileName:         options.MineKey,
+			callback:            mine.TemplateCallback,
+			clientCertificates:  true,
+			argument: &mine.ServerArgument{
+				Log:     mineLog,
+				Workers: workers,
+			},
+		},
+	}
+
+	if 0 == len(options.MineWorkers) {
+		log.Warn("no MineWorker accounts: any miner can log in")
 	}
 
 	// capture a set of this certificate fingerprints
@@ -246,7 +273,7 @@ func main() {
 			for _, address := range options.PeerAnnounce {
 				announce.AddPeer(address, announce.TypePeer, &peerData)
 			}
-		case "mine":
+		case "mine", "template":
 			// no need to announce - currently assume only certain nodes will be mines (i.e. have attached miners)
 			// and these will be local connections or be run as pools
 		default:
@@ -305,15 +332,63 @@ func main() {
 	// }
 	// defer p2p.Finalise()
 
+	// free transaction policy - depends on pool
+	err = policy.Initialise(options.FreeRegistrant, options.FreeAsset)
+	if nil != err {
+		log.Criticalf("failed to initialise policy  error: %v", err)
+		exitwithstatus.Exit(1)
+	}
+	defer policy.Finalise()
+
 	// connect to various payment services
-	err = payment.BitcoinInitialise(options.BitcoinURL, options.BitcoinUsername, options.BitcoinPassword, options.BitcoinAddress, options.BitcoinFee, options.BitcoinStart)
+	err = payment.Initialise(options.PaymentExpiry, options.PaymentInterval)
+	if nil != err {
+		log.Criticalf("failed to initialise payment  error: %v", err)
+		exitwithstatus.Exit(1)
+	}
+	defer payment.Finalise()
+
+	fees := payment.FeeSchedule{
+		Default:         options.BitcoinFee,
+		BitmarkIssue:    options.BitcoinIssueFee,
+		BitmarkTransfer: options.BitcoinTransferFee,
+		IssueDiscounts:  options.BitcoinIssueDiscount,
+	}
+	err = payment.BitcoinInitialise(options.BitcoinURL, options.BitcoinUsername, options.BitcoinPassword, options.BitcoinAddress, &fees, options.BitcoinStart)
 	if nil != err {
 		log.Criticalf("failed to initialise Bitcoin  error: %v", err)
 		exitwithstatus.Exit(1)
 	}
 
+	// bound the unpaid pool - depends on fees for eviction
+	eviction, err := transaction.ParseEviction(options.UnpaidEviction)
+	if nil != err {
+		log.Criticalf("unpaid eviction: %q  error: %v", options.UnpaidEviction, err)
+		exitwithstatus.Exit(1)
+	}
+	transaction.SetLimits(transaction.Limits{
+		MaximumCount:    options.UnpaidCount,
+		MaximumBytes:    options.UnpaidBytes,
+		Eviction:        eviction,
+		RegistrantQuota: options.RegistrantQuota,
+		Fee:             payment.BitcoinFee,
+	})
+
+	// choice of transactions for mining - depends on fees
+	selection, err := mine.ParseSelection(options.MineSelection)
+	if nil != err {
+		log.Criticalf("mine selection: %q  error: %v", options.MineSelection, err)
+		exitwithstatus.Exit(1)
+	}
+	mine.SetSelection(selection, payment.BitcoinFee)
+
 	// start up the peering
-	err = peer.Initialise(options.PeerListeners, mode.NetworkName(), publicKey, privateKey)
+	seeds := make([]peer.Remote, len(options.RemoteSeeds))
+	for i, remote := range options.RemoteSeeds {
+		seeds[i] = peer.Remote(remote)
+	}
+	peer.SetDiscovery(options.Remotes, seeds)
+	err = peer.Initialise(options.PeerListeners, mode.NetworkName(), publicKey, privateKey, options.BanDuration)
 	if nil != err {
 		log.Criticalf("failed to initialise peer  error: %v", err)
 		exitwithstatus.Exit(1)
@@ -321,6 +396,17 @@ func main() {
 	defer peer.Finalise()
 	privateKey = ""
 
+	// publish this node's peer listeners
+	for _, address := range options.PeerAnnounce {
+		peerData := announce.PeerData{
+			PublicKey: publicKey,
+		}
+		if _, err := announce.AddPeer(address, announce.TypePeer, &peerData); nil != err {
+			log.Criticalf("invalid peer announce: %q  error: %v", address, err)
+			exitwithstatus.Exit(1)
+		}
+	}
+
 	// now start listeners - these can access memory pools
 	serversStarted := 0
 	for name, server := range servers {
@@ -374,3 +460,17 @@ func removeAppLock(appLockFile string) {
 		lockWasCreated = false
 	}
 }
+
+// convert configured worker accounts for the miner server
+func mineWorkers(workers []configuration.Worker) *mine.Workers {
+	credentials := make([]mine.WorkerCredential, len(workers))
+	for i, w := range workers {
+		credentials[i] = mine.WorkerCredential{
+			Name:        w.Name,
+			Password:    w.Password,
+			Fingerprint: w.Fingerprint,
+			Disabled:    w.Disabled,
+		}
+	}
+	return mine.NewWorkers(credentials)
+}
@@ -281,6 +281,15 @@ func doCalc(t *testing.T, title string, extraNonce1 []byte, extraNonce2 []byte,
 		t.Fatalf("re-packed mismatch actual: %x  expected: %x", rePacked, blk)
 	}
 
+	// rebuild from the parts sent in a compact block
+	compact, err := block.NewPacked(block.Packed(blk).Header(), unpacked.Coinbase, unpacked.TxIds)
+	if nil != err {
+		t.Fatalf("block.NewPacked: err = %v", err)
+	}
+	if !bytes.Equal(compact, blk) {
+		t.Fatalf("compact re-packed mismatch actual: %x  expected: %x", compact, blk)
+	}
+
 	// log the final result
 	if verboseTesting { // turn on in all_test.go
 		t.Logf("Genesis digest: %#v", reDigest)
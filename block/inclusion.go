@@ -0,0 +1,171 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/bitmark-inc/bitmarkd/difficulty"
+	"github.com/bitmark-inc/bitmarkd/fault"
+)
+
+// proof that a transaction is in a block
+//
+// this is enough to check the transaction against the proof of work
+// of the block header without the rest of the block
+type Inclusion struct {
+	Number uint64       `json:"number"`
+	Header PackedHeader `json:"header"`
+	Index  int          `json:"index"` // merkle position, coinbase is zero
+	Branch []Digest     `json:"branch"`
+}
+
+// find the number of the block that contains a transaction
+func Locate(txId Digest) (uint64, bool) {
+	data, found := globalBlock.txIndex.Get(txId[:])
+	if !found || uint64Size != len(data) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// create the proof that a transaction is in a stored block
+func Include(txId Digest) (*Inclusion, bool) {
+
+	number, found := Locate(txId)
+	if !found {
+		return nil, false
+	}
+	packed, found := Get(number)
+	if !found {
+		return nil, false
+	}
+
+	var blk Block
+	err := packed.Unpack(&blk)
+	if nil != err {
+		return nil, false
+	}
+
+	index := -1
+	for i, id := range blk.TxIds {
+		if txId == id {
+			index = i + 1 // skip the coinbase
+			break
+		}
+	}
+	if index < 0 {
+		return nil, false
+	}
+
+	cbStart := totalBlockSize + int16Size
+	coinbaseLength := int(packed[totalBlockSize]) + int(packed[totalBlockSize+1])<<8
+	coinbase := NewDigest(packed[cbStart : cbStart+coinbaseLength])
+
+	tree := FullMerkleTree(coinbase, blk.TxIds)
+	return &Inclusion{
+		Number: number,
+		Header: PackedHeader(packed[:totalBlockSize]),
+		Index:  index,
+		Branch: MerkleBranch(tree, len(blk.TxIds)+1, index),
+	}, true
+}
+
+// check that a transaction is in the header and the header meets
+// its own difficulty, which must be at least the minimum
+//
+// a header can always be made at a lower difficulty than the network
+// is mining at, so the minimum should come from a trusted checkpoint
+// of the chain, e.g. the current difficulty, the cost of forging a
+// header is then the same as mining a block
+func (inclusion *Inclusion) Verify(txId Digest, minimum *difficulty.Difficulty) error {
+	var header Header
+	err := inclusion.Header.Unpack(&header)
+	if nil != err {
+		return err
+	}
+
+	if inclusion.Index < 1 || len(inclusion.Branch) > 32 {
+		return fault.ErrMerkleMismatch
+	}
+	if header.MerkleRoot != MerkleRootFromBranch(txId, inclusion.Index, inclusion.Branch) {
+		return fault.ErrMerkleMismatch
+	}
+
+	// a larger target is a lower difficulty
+	target := header.Bits.BigInt()
+	if target.Cmp(minimum.BigInt()) > 0 {
+		return fault.ErrInvalidBlockHeader
+	}
+	if inclusion.Header.Digest().Cmp(target) > 0 {
+		return fault.ErrInvalidBlockHeader
+	}
+	return nil
+}
+
+// add the transactions of a block to the index
+//
+// this does not lock, so use only when locked
+func indexTransactions(number uint64, blk Packed) {
+	var b Block
+	err := blk.Unpack(&b)
+	if nil != err {
+		globalBlock.log.Errorf("index block: %d  error: %v", number, err)
+		return
+	}
+
+	blockNumber := make([]byte, uint64Size)
+	binary.BigEndian.PutUint64(blockNumber, number)
+	for _, txId := range b.TxIds {
+		globalBlock.txIndex.Add(txId[:], blockNumber)
+	}
+}
+
+// index any blocks stored before the index existed
+//
+// works back from the highest block and stops at the first block
+// that is already indexed
+func indexMissing(highest uint64) {
+	for n := highest; n > GenesisBlockNumber; n -= 1 {
+		packed, found := Get(n)
+		if !found {
+			continue
+		}
+		var blk Block
+		err := packed.Unpack(&blk)
+		if nil != err || 0 == len(blk.TxIds) {
+			continue
+		}
+		if _, found := globalBlock.txIndex.Get(blk.TxIds[0][:]); found {
+			return
+		}
+		globalBlock.log.Infof("index block: %d", n)
+		indexTransactions(n, packed)
+	}
+}
+
+// convert a header to its hex JSON form
+func (record PackedHeader) MarshalJSON() ([]byte, error) {
+	size := 2 + hex.EncodedLen(len(record))
+	b := make([]byte, size)
+	b[0] = '"'
+	b[size-1] = '"'
+	hex.Encode(b[1:], record)
+	return b, nil
+}
+
+// convert a hex JSON header
+func (record *PackedHeader) UnmarshalJSON(s []byte) error {
+	if len(s) < 2 || '"' != s[0] || '"' != s[len(s)-1] {
+		return fault.ErrInvalidCharacter
+	}
+	b := make([]byte, hex.DecodedLen(len(s)-2))
+	_, err := hex.Decode(b, s[1:len(s)-1])
+	if nil != err {
+		return err
+	}
+	*record = b
+	return nil
+}
@@ -91,3 +91,47 @@ func MinimumMerkleTree(ids []Digest) []Digest {
 	}
 	return tree[:finish]
 }
+
+// extract the digests needed to prove one leaf is in a full merkle tree
+//
+// the tree is the output of FullMerkleTree and the index counts the
+// coinbase as zero, so the first transaction is index 1
+//
+// returns nil if the index is not a leaf of the tree
+func MerkleBranch(tree []Digest, leafCount int, index int) []Digest {
+	if index < 0 || index >= leafCount {
+		return nil
+	}
+
+	branch := make([]Digest, 0, 16)
+	start := 0
+	for width := leafCount; width > 1; width = (width + 1) / 2 {
+		sibling := index ^ 1
+		if sibling >= width {
+			sibling = index // compensate for odd number
+		}
+		if start+sibling >= len(tree) {
+			return nil
+		}
+		branch = append(branch, tree[start+sibling])
+		start += width
+		index /= 2
+	}
+	return branch
+}
+
+// compute a merkle root from one leaf and its branch
+//
+// the index is the position of the leaf as used by MerkleBranch
+func MerkleRootFromBranch(leaf Digest, index int, branch []Digest) Digest {
+	root := leaf
+	for _, d := range branch {
+		if 0 == index&1 {
+			root = NewDigest(append(root[:], d[:]...))
+		} else {
+			root = NewDigest(append(d[:], root[:]...))
+		}
+		index /= 2
+	}
+	return root
+}
@@ -2797,3 +2797,35 @@ var block328656MerkleTree = []string{
 	"57a992f49842570a91a970e222484f471d0380a7ab6a46915f88129fc5413a0f",
 	"2b44fc83c84e21817b0da633af7733a4872c2415a21bf9f6b4883a5751c3e020",
 }
+
+// check every leaf can be proved against the root
+func TestMerkleBranch(t *testing.T) {
+
+	for count := 0; count < 12; count += 1 {
+
+		coinbase := block.NewDigest([]byte("coinbase"))
+		ids := make([]block.Digest, count)
+		for i := range ids {
+			ids[i] = block.NewDigest([]byte{byte(i)})
+		}
+
+		tree := block.FullMerkleTree(coinbase, ids)
+		root := tree[len(tree)-1]
+		leaves := append([]block.Digest{coinbase}, ids...)
+
+		for i, leaf := range leaves {
+			branch := block.MerkleBranch(tree, len(leaves), i)
+			if nil == branch && len(leaves) > 1 {
+				t.Errorf("count: %d  index: %d  no branch", count, i)
+				continue
+			}
+			if r := block.MerkleRootFromBranch(leaf, i, branch); root != r {
+				t.Errorf("count: %d  index: %d  root: %#v  expected: %#v", count, i, r, root)
+			}
+		}
+
+		if nil != block.MerkleBranch(tree, len(leaves), len(leaves)) {
+			t.Errorf("count: %d  branch for index beyond leaves", count)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/bitmark-inc/bitmarkd/background"
 	"github.com/bitmark-inc/bitmarkd/difficulty"
 	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/messagebus"
 	"github.com/bitmark-inc/bitmarkd/mode"
 	"github.com/bitmark-inc/bitmarkd/pool"
 	"github.com/bitmark-inc/logger"
@@ -62,6 +63,7 @@ var globalBlock struct {
 
 	// stored block data
 	blockData *pool.Pool
+	txIndex   *pool.Pool // block number of each transaction
 
 	// for background processes
 	background *background.T
@@ -85,6 +87,7 @@ func Initialise(cacheSize int) {
 	globalBlock.currentBlockNumber = 0
 
 	globalBlock.blockData = pool.New(pool.BlockData, cacheSize)
+	globalBlock.txIndex = pool.New(pool.BlockTxIndex, cacheSize)
 
 	if mode.IsTesting() {
 		globalBlock.previousBlock = TestGenesisDigest
@@ -116,6 +119,7 @@ func Initialise(cacheSize int) {
 		globalBlock.currentBlockNumber = bn + 1
 		globalBlock.previousBlock = blk.Digest
 		globalBlock.previousTimestamp = blk.Timestamp
+		indexMissing(bn)
 		return
 	}
 
@@ -131,6 +135,7 @@ func Finalise() {
 
 	globalBlock.log.Info("shutting down…")
 	globalBlock.blockData.Flush()
+	globalBlock.txIndex.Flush()
 }
 
 // access to previous link
@@ -210,10 +215,13 @@ func Get(number uint64) (Packed, bool) {
 // store a block
 // requires number to save an unpack step which was probably already done
 // or the number was known from the pack step
+//
+// the transactions of the block must already be marked as mined
 func (blk Packed) Save(number uint64, digest *Digest, timestamp time.Time) {
 	globalBlock.Lock()
 	defer globalBlock.Unlock()
 	blk.internalSave(number, digest, timestamp)
+	messagebus.Notify(messagebus.EventBlockSaved)
 }
 
 // this does not lock, so use only when locked
@@ -224,6 +232,7 @@ func (blk Packed) internalSave(number uint64, digest *Digest, timestamp time.Tim
 
 	globalBlock.log.Infof("storing block %d", number)
 	globalBlock.blockData.Add(blockKey, blk)
+	indexTransactions(number, blk)
 
 	// update current block number/digest
 	if number >= globalBlock.currentBlockNumber {
@@ -282,6 +291,29 @@ func Pack(blockNumber uint64, timestamp time.Time, difficulty *difficulty.Diffic
 		return hDigest, nil, false
 	}
 
+	return hDigest, assemble(header, coinbase, transactionCount, tree), true
+}
+
+// create a packed block from a header, coinbase and the transaction
+// ids that were sent instead of the whole block
+//
+// the result must be checked by Unpack
+func NewPacked(header PackedHeader, coinbase []byte, ids []Digest) (Packed, error) {
+
+	transactionCount := len(ids) + 1
+	if totalBlockSize != len(header) || len(coinbase) < 1 || len(coinbase) > 32767 || transactionCount > 32767 {
+		return nil, fault.ErrInvalidBlock
+	}
+
+	tree := FullMerkleTree(NewDigest(coinbase), ids)
+	return assemble(header, coinbase, transactionCount, tree), nil
+}
+
+// lay out the parts of a block
+func assemble(header PackedHeader, coinbase []byte, transactionCount int, tree []Digest) Packed {
+
+	coinbaseLength := len(coinbase)
+
 	// compute block size
 	blockSize := len(header) + 2*int16Size + coinbaseLength + len(tree)*DigestSize
 
@@ -304,7 +336,14 @@ func Pack(blockNumber uint64, timestamp time.Time, difficulty *difficulty.Diffic
 		fault.Panic("block.Check - block size mismatch")
 	}
 
-	return hDigest, blk, true
+	return blk
+}
+
+// the header of a block
+//
+// only valid for a block that has been unpacked without error
+func (pack Packed) Header() PackedHeader {
+	return PackedHeader(pack[:totalBlockSize])
 }
 
 func (pack Packed) Unpack(blk *Block) error {
@@ -406,6 +445,7 @@ func (pack Packed) Unpack(blk *Block) error {
 	blk.Timestamp = cb.Timestamp.UTC()
 	blk.Addresses = cb.Addresses
 
+	blk.Coinbase = []byte(coinbase)
 	blk.TxIds = txIds
 
 	return nil
@@ -61,6 +61,12 @@ func verifyListen(log *logger.L, name string, server *serverChannel) (*util.Fing
 		},
 	}
 
+	// client certificates are not verified here, only matched by
+	// fingerprint after the handshake
+	if server.clientCertificates {
+		util.RecordClientCertificates(server.tlsConfiguration)
+	}
+
 	fingerprint := util.Fingerprint(keyPair.Certificate[0])
 	log.Infof("fingerprint = %x", fingerprint)
 
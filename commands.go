@@ -5,13 +5,16 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/bitmark-inc/bitmarkd/block"
 	"github.com/bitmark-inc/bitmarkd/configuration"
 	"github.com/bitmark-inc/exitwithstatus"
 	"github.com/bitmark-inc/logger"
+	"golang.org/x/crypto/bcrypt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // setup command handler
@@ -120,6 +123,21 @@ func processSetupCommand(log *logger.L, options configuration.CommandOptions) bo
 		fmt.Printf("generated mine key: '%s' and certificate: '%s'\n", privateKeyFilename, certificateFilename)
 		log.Infof("generated mine key: '%s' and certificate: '%s'", privateKeyFilename, certificateFilename)
 
+	case "hash-mine-password":
+		fmt.Fprintf(os.Stderr, "password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if "" == password {
+			fmt.Printf("error reading password: %v\n", err)
+			exitwithstatus.Exit(1)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if nil != err {
+			fmt.Printf("error hashing password: %v\n", err)
+			exitwithstatus.Exit(1)
+		}
+		fmt.Printf("%s\n", hash)
+
 	case "block-times":
 		return false // defer processing until database is loaded
 
@@ -135,6 +153,7 @@ func processSetupCommand(log *logger.L, options configuration.CommandOptions) bo
 		//fmt.Printf("  generate-peer-cert PREFIX IPs... - create private key in: '<PREFIX>.key' certificate in: '<PREFIX>.crt'\n")
 		fmt.Printf("  generate-mine-cert               - create private key in: '%s' and certificate in: '%s'\n", options.MineKey, options.MineCertificate)
 		fmt.Printf("  generate-mine-cert PREFIX IPs... - create private key in: '<PREFIX>.key' certificate in: '<PREFIX>.crt'\n")
+		fmt.Printf("  hash-mine-password               - read a password from stdin and print its hash for MineWorker\n")
 		fmt.Printf("  block-times FILE BEGIN END       - write time and difficulty to text file for a range of blocks\n")
 		exitwithstatus.Exit(1)
 	}
@@ -5,6 +5,7 @@
 package configuration
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/util"
@@ -14,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // basic defaults
@@ -30,10 +32,24 @@ const (
 	defaultPeers      = 125
 	defaultMines      = 125
 	defaultRemotes    = 25
-	//defaultBanDuration = time.Hour * 24
+
+	defaultBanDuration = time.Hour * 24
 
 	defaultBlockCacheSize       = 100
 	defaultTransactionCacheSize = 100
+
+	defaultPaymentExpiry   = 2 * time.Hour
+	defaultPaymentInterval = 2 * time.Minute
+
+	defaultUnpaidCount     = 100000
+	defaultUnpaidBytes     = 64 * 1024 * 1024
+	defaultUnpaidEviction  = "oldest"
+	defaultRegistrantQuota = 1000
+	defaultClientQuota     = 600
+
+	defaultMineShareInterval     = 10 * time.Second
+	defaultMineMinimumDifficulty = 1.0
+	defaultMineSelection         = "fifo"
 )
 
 // path expanded or calculated defaults
@@ -66,6 +82,14 @@ type Remote struct {
 	Address   string
 }
 
+// type to hold a miner worker account
+type Worker struct {
+	Name        string
+	Password    []byte                 // bcrypt hash
+	Fingerprint *util.FingerprintBytes // SHA256 of client certificate
+	Disabled    bool
+}
+
 // all of the possible options
 type CommandOptions struct {
 
@@ -87,19 +111,22 @@ type CommandOptions struct {
 	PrivateKey string `long:"PrivateKey" description:"File containing Z85 encoded Curve Private Key"`
 
 	// Peers (incoming from other bitmarkd)
-	Peers         int      `long:"Peers" description:"Limit the number of peers that can connect"`
-	PeerListeners []string `long:"PeerListen" description:"Add an IP:port to listen for peer connections"`
-	PeerAnnounce  []string `long:"PeerAnnounce" description:"Publish a peer IP:port to network (Public/Firewall Forwarded/NAT)"`
+	Peers         int           `long:"Peers" description:"Limit the number of peers that can connect"`
+	PeerListeners []string      `long:"PeerListen" description:"Add an IP:port to listen for peer connections"`
+	PeerAnnounce  []string      `long:"PeerAnnounce" description:"Publish a peer IP:port to network (Public/Firewall Forwarded/NAT)"`
+	BanDuration   time.Duration `long:"BanDuration" description:"How long a misbehaving peer is ignored (e.g. 24h)"`
 
 	// Connect (outgoing to other bitmarkd)
 	Remotes       int      `long:"Remotes" description:"Limit the number outgoing peer connections"`
 	RemoteConnect []Remote `long:"RemoteConnect" description:"Add a 'Z85-public-key',IP:port for a connection to a remote peer"`
+	RemoteSeeds   []Remote `long:"RemoteSeed" description:"Add a 'Z85-public-key',IP:port to connect to when no other peers are known"`
 
 	// RPC (incoming from clients)
 	RPCClients     int      `long:"RpcClients" description:"Limit the number of RPC clients that can connect"`
 	RPCListeners   []string `long:"RpcListen" description:"Add an IP:port to listen for RPC connections"`
 	RPCCertificate string   `long:"RpcCert" description:"File containing the certificate"`
 	RPCKey         string   `long:"RpcKey" description:"File containing the private key"`
+	RPCAdmin       []string `long:"RpcAdmin" description:"Add a client IP address allowed to use the Admin RPCs"`
 	RPCAnnounce    []string `long:"RpcAnnounce" description:"Publish an RPC IP:port to network (Public/Firewall Forwarded/NAT)"`
 
 	// Mines (incoming from stratum+ssl miners)
@@ -107,6 +134,19 @@ type CommandOptions struct {
 	MineListeners   []string `long:"MineListen" description:"Add an IP:port to listen for miner connections"`
 	MineCertificate string   `long:"MineCert" description:"File containing the certificate"`
 	MineKey         string   `long:"MineKey" description:"File containing the private key"`
+
+	// getblocktemplate over HTTPS, shares the certificate and limit with stratum
+	MineTemplateListeners []string `long:"MineTemplateListen" description:"Add an IP:port to listen for getblocktemplate miner connections"`
+
+	// per miner share difficulty
+	MineShareInterval     time.Duration `long:"MineShareInterval" description:"Desired time between shares from one miner (e.g. 10s)"`
+	MineMinimumDifficulty float64       `long:"MineMinimumDifficulty" description:"Lowest share difficulty sent to a miner"`
+
+	// choice of transactions for each block
+	MineSelection string `long:"MineSelection" description:"Transactions to put in a block first: fifo, fee or fair"`
+
+	// miner accounts, if none then any worker can log in
+	MineWorkers []Worker `long:"MineWorker" description:"Add a NAME,password,BCRYPT-HASH or NAME,certificate,SHA256-FINGERPRINT miner account (append ,disabled to refuse it)"`
 	//MineAnnounce    []string `long:"MineAnnounce" description:"Publish a mine IP:port to network (Public/Firewall Forwarded/NAT)"`
 
 	// storage
@@ -127,6 +167,26 @@ type CommandOptions struct {
 	BitcoinFee      string `long:"BitcoinFee" description:"Bitcoin fee per transaction in BTC (e.g. 0.0002)"`
 	BitcoinStart    uint64 `long:"BitcoinStart" description:"Bitcoin start block for transaction dectection"`
 
+	// Bitcoin fee schedule (any not set use BitcoinFee)
+	BitcoinIssueFee      string   `long:"BitcoinIssueFee" description:"Bitcoin fee per bitmark issue in BTC"`
+	BitcoinTransferFee   string   `long:"BitcoinTransferFee" description:"Bitcoin fee per bitmark transfer in BTC"`
+	BitcoinIssueDiscount []string `long:"BitcoinIssueDiscount" description:"Add a volume discount for issues in one payment as count:percent (e.g. 10:5)"`
+
+	// free transaction policy
+	FreeRegistrant []string `long:"FreeRegistrant" description:"Add a registrant as base58-address[:quota] whose transactions skip payment"`
+	FreeAsset      []string `long:"FreeAsset" description:"Add an asset as BMA0hex-asset-index[:quota] whose transactions skip payment"`
+
+	// payment timing
+	PaymentExpiry   time.Duration `long:"PaymentExpiry" description:"How long to keep unpaid transactions (e.g. 2h)"`
+	PaymentInterval time.Duration `long:"PaymentInterval" description:"How often to verify unpaid transactions (e.g. 2m)"`
+
+	// unpaid pool limits, zero is unlimited
+	UnpaidCount     uint64 `long:"UnpaidCount" description:"Maximum number of unpaid transactions"`
+	UnpaidBytes     uint64 `long:"UnpaidBytes" description:"Maximum total size in bytes of unpaid transactions"`
+	UnpaidEviction  string `long:"UnpaidEviction" description:"Unpaid transactions to remove when full: oldest or fee"`
+	RegistrantQuota uint64 `long:"RegistrantQuota" description:"Maximum unpaid transactions signed by one key"`
+	ClientQuota     uint64 `long:"ClientQuota" description:"Maximum RPC submissions per minute from one client address"`
+
 	Args struct {
 		Command   string   `name:"command" description:"Command: use 'help' to show list of commands"`
 		Arguments []string `name:"args" description:"A optional arguments for command"`
@@ -136,26 +196,38 @@ type CommandOptions struct {
 func ParseOptions() CommandOptions {
 
 	options := CommandOptions{
-		ConfigFile:           defaultConfigFile,
-		Debug:                defaultDebug,
-		PidFile:              defaultPidFile,
-		TestMode:             false,
-		PublicKey:            defaultPublicKeyFile,
-		PrivateKey:           defaultPrivateKeyFile,
-		RPCClients:           defaultRPCClients,
-		RPCCertificate:       defaultCertificateFile,
-		RPCKey:               defaultKeyFile,
-		Peers:                defaultPeers,
-		Remotes:              defaultRemotes,
-		Mines:                defaultMines,
-		MineCertificate:      defaultCertificateFile,
-		MineKey:              defaultKeyFile,
-		DatabaseFile:         defaultLiveDatabaseFile,
-		BlockCacheSize:       defaultBlockCacheSize,
-		TransactionCacheSize: defaultTransactionCacheSize,
-		LogFile:              defaultLogFile,
-		LogSize:              defaultLogSize,
-		LogRotateCount:       defaultLogRotateCount,
+		ConfigFile:            defaultConfigFile,
+		Debug:                 defaultDebug,
+		PidFile:               defaultPidFile,
+		TestMode:              false,
+		PublicKey:             defaultPublicKeyFile,
+		PrivateKey:            defaultPrivateKeyFile,
+		RPCClients:            defaultRPCClients,
+		RPCAdmin:              []string{"127.0.0.1", "::1"},
+		RPCCertificate:        defaultCertificateFile,
+		RPCKey:                defaultKeyFile,
+		Peers:                 defaultPeers,
+		BanDuration:           defaultBanDuration,
+		Remotes:               defaultRemotes,
+		Mines:                 defaultMines,
+		MineCertificate:       defaultCertificateFile,
+		MineKey:               defaultKeyFile,
+		MineShareInterval:     defaultMineShareInterval,
+		MineMinimumDifficulty: defaultMineMinimumDifficulty,
+		MineSelection:         defaultMineSelection,
+		DatabaseFile:          defaultLiveDatabaseFile,
+		BlockCacheSize:        defaultBlockCacheSize,
+		TransactionCacheSize:  defaultTransactionCacheSize,
+		LogFile:               defaultLogFile,
+		LogSize:               defaultLogSize,
+		LogRotateCount:        defaultLogRotateCount,
+		PaymentExpiry:         defaultPaymentExpiry,
+		PaymentInterval:       defaultPaymentInterval,
+		UnpaidCount:           defaultUnpaidCount,
+		UnpaidBytes:           defaultUnpaidBytes,
+		UnpaidEviction:        defaultUnpaidEviction,
+		RegistrantQuota:       defaultRegistrantQuota,
+		ClientQuota:           defaultClientQuota,
 	}
 
 	temporaryOptions := options
@@ -253,3 +325,67 @@ func (r *Remote) UnmarshalFlag(value string) error {
 func (r Remote) MarshalFlag() (string, error) {
 	return fmt.Sprintf("'%s',%s", r.PublicKey, r.Address), nil
 }
+
+// parse worker
+// expect:
+//   name,password,$2a$10$...
+//   name,certificate,64-hex-digit-fingerprint
+//   either followed by ,disabled
+func (w *Worker) UnmarshalFlag(value string) error {
+
+	parts := strings.Split(strings.Trim(value, " "), ",")
+	if len(parts) < 3 || len(parts) > 4 || 0 == len(parts[0]) || 0 == len(parts[2]) {
+		return fault.ErrInvalidWorker
+	}
+
+	worker := Worker{
+		Name: parts[0],
+	}
+
+	switch parts[1] {
+	case "password":
+		if !strings.HasPrefix(parts[2], "$2") {
+			return fault.ErrInvalidWorker
+		}
+		worker.Password = []byte(parts[2])
+
+	case "certificate":
+		b, err := hex.DecodeString(parts[2])
+		if nil != err {
+			return err
+		}
+		var fingerprint util.FingerprintBytes
+		if len(fingerprint) != len(b) {
+			return fault.ErrInvalidWorker
+		}
+		copy(fingerprint[:], b)
+		worker.Fingerprint = &fingerprint
+
+	default:
+		return fault.ErrInvalidWorker
+	}
+
+	if 4 == len(parts) {
+		if "disabled" != parts[3] {
+			return fault.ErrInvalidWorker
+		}
+		worker.Disabled = true
+	}
+
+	*w = worker
+	return nil
+}
+
+func (w Worker) MarshalFlag() (string, error) {
+	kind := "password"
+	value := string(w.Password)
+	if nil != w.Fingerprint {
+		kind = "certificate"
+		value = hex.EncodeToString(w.Fingerprint[:])
+	}
+	s := fmt.Sprintf("%s,%s,%s", w.Name, kind, value)
+	if w.Disabled {
+		s += ",disabled"
+	}
+	return s, nil
+}
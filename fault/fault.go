@@ -20,16 +20,21 @@ type RecordError GenericError
 
 // common errors - keep in alphabetic order
 var (
+	ErrAddressNotRoutable            = InvalidError("address not routable")
 	ErrAlreadyInitialised            = ExistsError("already initialised")
 	ErrAssetNotFound                 = NotFoundError("asset not found")
+	ErrBitmarkBurned                 = RecordError("bitmark burned")
 	ErrBlockNotFound                 = NotFoundError("block not found")
 	ErrCannotDecodeAddress           = RecordError("cannot decode address")
 	ErrCertificateFileAlreadyExists  = ExistsError("certificate file already exists")
 	ErrCertificateNotFound           = NotFoundError("certificate not found")
 	ErrChecksumMismatch              = ProcessError("checksum mismatch")
+	ErrClientAddressMissing          = NotFoundError("client address missing")
+	ErrClientQuotaExceeded           = ProcessError("client quota exceeded")
 	ErrCountMismatch                 = ProcessError("count mismatch")
 	ErrConnectingToSelfForbidden     = ProcessError("connecting to self forbidden")
 	ErrDescriptionTooLong            = LengthError("name too long")
+	ErrDoubleSpend                   = RecordError("double spend")
 	ErrFingerprintTooLong            = LengthError("fingerprint too long")
 	ErrInsufficientPayment           = InvalidError("insufficient payment")
 	ErrInvalidBlock                  = InvalidError("invalid block")
@@ -38,23 +43,34 @@ var (
 	ErrInvalidCount                  = InvalidError("invalid count")
 	ErrInvalidCharacter              = InvalidError("invalid character")
 	ErrInvalidCurrency               = InvalidError("invalid currency")
+	ErrInvalidDiscount               = InvalidError("invalid discount")
+	ErrInvalidEviction               = InvalidError("invalid eviction")
 	ErrInvalidIPAddress              = InvalidError("invalid IP Address")
 	ErrInvalidKeyLength              = InvalidError("invalid key length")
 	ErrInvalidKeyType                = InvalidError("invalid key type")
 	ErrInvalidLength                 = InvalidError("invalid length")
 	ErrInvalidLoggerChannel          = InvalidError("invalid logger channel")
+	ErrInvalidMetadata               = InvalidError("invalid metadata")
+	ErrInvalidPolicyRule             = InvalidError("invalid policy rule")
 	ErrInvalidPortNumber             = InvalidError("invalid port number")
+	ErrInvalidPublicKey              = InvalidError("invalid public key")
 	ErrInvalidRemote                 = InvalidError("invalid remote: expected 'z85',IP:Port")
+	ErrInvalidSearch                 = InvalidError("invalid search")
+	ErrInvalidSelection              = InvalidError("invalid selection")
 	ErrInvalidSignature              = InvalidError("invalid signature")
+	ErrInvalidState                  = InvalidError("invalid state")
 	ErrInvalidTransactionChain       = InvalidError("invalid transaction chain")
 	ErrInvalidType                   = InvalidError("invalid type")
 	ErrInvalidVersion                = InvalidError("invalid version")
+	ErrInvalidWorker                 = InvalidError("invalid worker: expected NAME,password|certificate,VALUE[,disabled]")
 	ErrKeyFileAlreadyExists          = ExistsError("key file already exists")
 	ErrKeyFileNotFound               = NotFoundError("key file not found")
 	ErrKeyNotFound                   = NotFoundError("key not found")
 	ErrLinkNotFound                  = NotFoundError("link not found")
 	ErrLinksToUnconfirmedTransaction = InvalidError("links to unconfirmed transaction")
+	ErrMerkleMismatch                = ProcessError("merkle mismatch")
 	ErrMessagingTerminated           = ProcessError("messaging terminated")
+	ErrMetadataTooLong               = LengthError("metadata too long")
 	ErrNameTooLong                   = LengthError("name too long")
 	ErrNoPaymentToMiner              = InvalidError("no payment to miner")
 	ErrNotABitmarkPayment            = InvalidError("not a bitmark payment")
@@ -65,11 +81,18 @@ var (
 	ErrNotPublicKey                  = RecordError("not public key")
 	ErrNotTransactionType            = RecordError("not transaction type")
 	ErrNotTransactionPack            = RecordError("not transaction pack")
+	ErrOfferNotFound                 = NotFoundError("offer not found")
 	ErrPaymentAddressMissing         = NotFoundError("payment address missing")
 	ErrPeerAlreadyExists             = ExistsError("peer already exists")
+	ErrPeerBanned                    = ProcessError("peer banned")
 	ErrPeerNotFound                  = NotFoundError("peer not found")
+	ErrPermissionDenied              = ProcessError("permission denied")
+	ErrRegistrantQuotaExceeded       = ProcessError("registrant quota exceeded")
 	ErrSignatureTooLong              = LengthError("signature too long")
+	ErrTooManyOffers                 = ProcessError("too many offers")
 	ErrTransactionAlreadyExists      = ExistsError("transaction already exists")
+	ErrTransferExpired               = InvalidError("transfer expired")
+	ErrUnpaidPoolFull                = ProcessError("unpaid pool full")
 	ErrWrongNetworkForPublicKey      = InvalidError("wrong network for public key")
 )
 
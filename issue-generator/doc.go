@@ -8,4 +8,7 @@
 //      (add -v flag to sse JSON requests and responses)
 //
 //   issue-generator [-v] rate 5.0 5
+//
+// this only uses fixed test keys, see bitmark-wallet for creating
+// and transferring real assets
 package main
@@ -3,4 +3,6 @@
 // license that can be found in the LICENSE file.
 
 // a queue system to transfer transactions
+//
+// also provides events to wake the miner when its work changes
 package messagebus
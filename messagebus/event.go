@@ -0,0 +1,43 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package messagebus
+
+// events that change the work available to miners
+type Event int
+
+// the possible events
+const (
+	EventTransactionAvailable Event = iota // a transaction was paid
+	EventBlockSaved                        // a block was stored with its transactions marked mined
+
+	eventCount // must be last
+)
+
+// one channel for each event, each can hold a single pending
+// notification so that a burst of events is merged into one
+var events [eventCount]chan struct{}
+
+func init() {
+	for i := range events {
+		events[i] = make(chan struct{}, 1)
+	}
+}
+
+// raise an event
+//
+// never blocks, so this is safe to call while holding locks
+func Notify(e Event) {
+	select {
+	case events[e] <- struct{}{}:
+	default: // already pending
+	}
+}
+
+// channel that receives after an event was raised
+//
+// there must only be one reader of each event
+func Events(e Event) <-chan struct{} {
+	return events[e]
+}
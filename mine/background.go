@@ -8,6 +8,7 @@ import (
 	"github.com/bitmark-inc/bitmarkd/background"
 	"github.com/bitmark-inc/bitmarkd/block"
 	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/messagebus"
 	"github.com/bitmark-inc/bitmarkd/mode"
 	"github.com/bitmark-inc/bitmarkd/payment"
 	"github.com/bitmark-inc/bitmarkd/transaction"
@@ -40,11 +41,16 @@ var globalBackgroundData struct {
 
 	// for background processes
 	background *background.T
+
+	// choice of transactions for each job
+	selection SelectionPolicy
+	fee       func(record interface{}) uint64
 }
 
 // list of background processes to start
 var processes = background.Processes{
 	assembleBlock,
+	expireRegistrations,
 }
 
 // initialise the background process
@@ -89,43 +95,109 @@ func Finalise() error {
 	return nil
 }
 
+// set the transaction selection policy
+//
+// fee is needed by FeeSelection
+func SetSelection(policy SelectionPolicy, fee func(record interface{}) uint64) {
+	globalBackgroundData.Lock()
+	defer globalBackgroundData.Unlock()
+
+	globalBackgroundData.selection = policy
+	globalBackgroundData.fee = fee
+}
+
+// the current selection policy, FIFO if none was set
+func selectionPolicy() SelectionPolicy {
+	globalBackgroundData.RLock()
+	defer globalBackgroundData.RUnlock()
+
+	if nil == globalBackgroundData.selection {
+		return FIFOSelection{}
+	}
+	return globalBackgroundData.selection
+}
+
+// add candidates for newly fetched transactions
+func gatherCandidates(candidates []Candidate, ids []block.Digest) []Candidate {
+	globalBackgroundData.RLock()
+	fee := globalBackgroundData.fee
+	globalBackgroundData.RUnlock()
+
+	for _, id := range ids {
+		if c, ok := newCandidate(id, fee); ok {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
 // assemble records for mining
+//
+// a new job is made as soon as transactions become available, but
+// not more often than interval, and the jobs are restarted with
+// clean_jobs set whenever a block is saved
 func assembleBlock(args interface{}, shutdown <-chan bool, finished chan<- bool) {
 
 	log := args.(*logger.L)
 	log.Info("assemble: starting…")
 
+	blockSaved := messagebus.Events(messagebus.EventBlockSaved)
+	available := messagebus.Events(messagebus.EventTransactionAvailable)
+
 loop:
 	for {
 		cursor := transaction.NewAvailableCursor()
 		restart := true
 		ids := []block.Digest{}
+		candidates := []Candidate{}
 		jobQueue.clear()
 
 		restartPoint := time.Now().Add(restartTimeout)
 
+		pending := true // fetch at once after restarting
+		lastJob := time.Time{}
+
 	assemble:
 		for {
+			// wait for the rate limit if there is work, otherwise
+			// only poll for miners connecting and the timeout
+			wait := interval
+			if pending {
+				wait = lastJob.Add(interval).Sub(time.Now())
+			}
+
 			select {
 			case <-shutdown:
 				break loop
 
-			//case <-restart:       // if a block was mined restart the assembly
-			//	break assemble  // assuming the notifier has already move transactions to mined
+			case <-blockSaved: // transactions in the jobs may now be mined
+				log.Info("assemble: block saved")
+				break assemble
+
+			case <-available: // new transactions
+				pending = true
+				continue assemble
 
-			case <-time.After(interval): // periodic polling for new transactions
+			case <-time.After(wait):
 			}
+			pending = false
 
 			// do not bother if no miners are connected
 			if 0 == atomic.LoadInt64(&globalMinerCount) {
 				log.Info("mine-assemble: waiting for first miner")
-				break assemble
+				if len(ids) > 0 {
+					break assemble
+				}
+				continue assemble
 			}
 
 			// check not in re-sync
 			if mode.IsNot(mode.Normal) {
 				log.Info("mine-assemble: waiting re-sync completion")
-				break assemble
+				if len(ids) > 0 {
+					break assemble
+				}
+				continue assemble
 			}
 
 			// nothing happened within timeout
@@ -134,18 +206,13 @@ loop:
 				break assemble
 			}
 
-			// detect a restart condition - is there a better way?
-			if jobQueue.isClear() && len(ids) > 0 {
-				log.Info("mine-assemble: clear detected")
-				break assemble
-			}
-
 			enqueue := false
 			if restart {
 				log.Info("assemble: initial ids")
 				ids = cursor.FetchAvailable(chunkSize)
 				if len(ids) > 0 {
 					log.Debugf("assemble: initial count: %d", len(ids))
+					candidates = gatherCandidates(nil, ids)
 					restart = false
 					enqueue = true
 				}
@@ -158,15 +225,19 @@ loop:
 				if enqueue {
 					log.Infof("assemble: more ids: %d", len(moreIds))
 					ids = append(ids, moreIds...)
+					candidates = gatherCandidates(candidates, moreIds)
 					restart = len(ids)+chunkSize > maximumTransactions
 				}
 			}
 			if enqueue {
-				addresses := payment.MinerAddresses()
-				log.Infof("assemble: new job: ids: %d  addresses: %#v", len(ids), addresses)
 				timestamp := time.Now().UTC()
-				jobQueue.add(ids, addresses, timestamp)
+				candidates = unexpired(candidates, timestamp)
+				selected := selectionPolicy().Select(candidates, maximumTransactions)
+				addresses := payment.MinerAddresses()
+				log.Infof("assemble: new job: ids: %d of: %d  addresses: %#v", len(selected), len(ids), addresses)
+				jobQueue.add(selected, addresses, timestamp)
 				restartPoint = timestamp.Add(restartTimeout) // new job so extend timeout
+				lastJob = timestamp
 			}
 		}
 	}
@@ -174,3 +245,26 @@ loop:
 	log.Info("assemble: shutting down…")
 	close(finished)
 }
+
+// remove registrations of miners that have not reconnected
+func expireRegistrations(args interface{}, shutdown <-chan bool, finished chan<- bool) {
+
+	log := args.(*logger.L)
+	log.Info("expire: starting…")
+
+loop:
+	for {
+		select {
+		case <-shutdown:
+			break loop
+		case <-time.After(registrationPurgeInterval):
+		}
+
+		if n := activeRegistrations.purge(time.Now()); n > 0 {
+			log.Infof("expire: registrations removed: %d", n)
+		}
+	}
+
+	log.Info("expire: shutting down…")
+	close(finished)
+}
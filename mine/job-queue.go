@@ -34,6 +34,7 @@ type job struct {
 	addresses []block.MinerAddress
 	timestamp time.Time
 	accessed  bool
+	shares    map[string]struct{} // submitted: extraNonce1 ++ extraNonce2 ++ ntime ++ nonce
 }
 
 // the job queue
@@ -45,6 +46,7 @@ type queue struct {
 	jobs           [queueSize]job         // array of jobs
 	topJob         *job                   // fast access to top item
 	index          map[jobIdentifier]*job // index of active items
+	updated        chan struct{}          // closed when the top job changes
 }
 
 // the master queue
@@ -59,6 +61,7 @@ func initialiseJobQueue() {
 		topIndex:       0,
 		topJob:         nil,
 		index:          make(map[jobIdentifier]*job),
+		updated:        make(chan struct{}),
 	}
 }
 
@@ -127,9 +130,14 @@ func (queue *queue) add(ids []block.Digest, addresses []block.MinerAddress, time
 	// store timestamp
 	p.timestamp = timestamp
 
+	// no shares yet
+	p.shares = make(map[string]struct{})
+
 	// index the entry for later recall
 	queue.index[queue.jobIdAllocator] = p
 	queue.topJob = p
+
+	queue.wake()
 }
 
 // fetch the min tree for and the latest job id for miner notify
@@ -171,6 +179,25 @@ func (queue *queue) getIds(jobId jobIdentifier) (ids []block.Digest, addresses [
 	return job.ids, job.addresses, job.timestamp, true
 }
 
+// record a share submitted for a job
+//
+// the same share can only be submitted once for each job
+func (queue *queue) submitShare(jobId jobIdentifier, share []byte) error {
+	queue.Lock()
+	defer queue.Unlock()
+
+	job, ok := queue.index[jobId]
+	if mode.IsNot(mode.Normal) || !ok || job.jobId != jobId {
+		return ErrJobNotFound
+	}
+
+	if _, found := job.shares[string(share)]; found {
+		return ErrDuplicateShare
+	}
+	job.shares[string(share)] = struct{}{}
+	return nil
+}
+
 // job was mined sucessfully
 func (queue *queue) confirm(jobId jobIdentifier) []block.Digest {
 	queue.Lock()
@@ -200,6 +227,24 @@ func (queue *queue) doClear() {
 	queue.topIndex = 0
 	queue.topJob = nil
 	queue.jobs[0].accessed = false
+
+	queue.wake()
+}
+
+// signal all waiting notifiers
+//
+// only call while write locked
+func (queue *queue) wake() {
+	close(queue.updated)
+	queue.updated = make(chan struct{})
+}
+
+// channel that is closed when the top job next changes
+func (queue *queue) changed() <-chan struct{} {
+	queue.RLock()
+	defer queue.RUnlock()
+
+	return queue.updated
 }
 
 // abandon all jobs and clear the queue
@@ -221,6 +266,14 @@ func (queue *queue) isClear() bool {
 	return nil == queue.topJob
 }
 
+// number of jobs that can still be submitted
+func (queue *queue) depth() int {
+	queue.RLock()
+	defer queue.RUnlock()
+
+	return len(queue.index)
+}
+
 // convert a job id into a string
 func (jobId jobIdentifier) String() string {
 	return fmt.Sprintf("%04x", uint16(jobId))
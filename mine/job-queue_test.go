@@ -228,3 +228,70 @@ func checkConfirm(t *testing.T, id jobIdentifier) {
 		t.Fatalf("was not able to confim overwritten id: %s", id)
 	}
 }
+
+// test waiting miners are woken by new and cleared jobs
+func TestJobQueueChanged(t *testing.T) {
+	setup()
+	initialiseJobQueue()
+
+	changed := jobQueue.changed()
+	select {
+	case <-changed:
+		t.Fatalf("changed before any job")
+	default:
+	}
+
+	ids := []block.Digest{block.NewDigest([]byte("1234567890"))}
+	jobQueue.add(ids, nil, time.Now())
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("add did not signal change")
+	}
+	if _, _, _, _, clean, ok := jobQueue.top(); !ok || !clean {
+		t.Errorf("first job: ok: %v  clean: %v", ok, clean)
+	}
+
+	changed = jobQueue.changed()
+	jobQueue.clear()
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("clear did not signal change")
+	}
+}
+
+// test a share is only accepted once for each job
+func TestJobQueueShares(t *testing.T) {
+	setup()
+	initialiseJobQueue()
+
+	ids := []block.Digest{block.NewDigest([]byte("1234567890"))}
+	jobQueue.add(ids, nil, time.Now())
+	first, _, _, _, _, _ := jobQueue.top()
+
+	jobQueue.add(ids, nil, time.Now())
+	second, _, _, _, _, _ := jobQueue.top()
+
+	share := []byte("extranonce-ntime-nonce")
+
+	if err := jobQueue.submitShare(first, share); nil != err {
+		t.Fatalf("first share: error: %v", err)
+	}
+	if err := jobQueue.submitShare(first, share); ErrDuplicateShare != err {
+		t.Errorf("repeated share: expected ErrDuplicateShare but got: %v", err)
+	}
+	if err := jobQueue.submitShare(first, []byte("extranonce-ntime-other")); nil != err {
+		t.Errorf("different nonce: error: %v", err)
+	}
+
+	// the same share for another job is a different solution
+	if err := jobQueue.submitShare(second, share); nil != err {
+		t.Errorf("second job: error: %v", err)
+	}
+
+	jobQueue.clear()
+	if err := jobQueue.submitShare(first, []byte("after clear")); ErrJobNotFound != err {
+		t.Errorf("cleared job: expected ErrJobNotFound but got: %v", err)
+	}
+}
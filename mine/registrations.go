@@ -0,0 +1,98 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"sync"
+	"time"
+)
+
+// registration expiry
+const (
+	registrationLifetime      = 10 * time.Minute // kept this long after the miner disconnects
+	registrationPurgeInterval = time.Minute      // how often expired registrations are removed
+)
+
+// the registrations of subscribed miners
+//
+// a miner that reconnects can subscribe with its previous notify id
+// to keep its extraNonce1 and share difficulty, so work in progress
+// is not lost
+type registrationStore struct {
+	sync.Mutex
+	entries map[string]*minerRegistration // indexed by notifyId
+}
+
+// the active registrations
+var activeRegistrations = registrationStore{
+	entries: make(map[string]*minerRegistration),
+}
+
+// store a new subscription of a connected miner
+//
+// replaces any earlier subscription of the same connection
+func (store *registrationStore) add(notifyId string, r *minerRegistration) {
+	store.Lock()
+	defer store.Unlock()
+
+	if "" != r.notifyId && notifyId != r.notifyId {
+		delete(store.entries, r.notifyId)
+	}
+	r.notifyId = notifyId
+	r.connected = true
+	store.entries[notifyId] = r
+}
+
+// take over a previous registration
+//
+// only a registration that is not in use by another connection and
+// has not expired can be resumed, its values are copied to the
+// registration of the new connection which then replaces it
+func (store *registrationStore) resume(notifyId string, r *minerRegistration, now time.Time) bool {
+	store.Lock()
+	defer store.Unlock()
+
+	old, found := store.entries[notifyId]
+	if !found || old == r || old.connected || now.After(old.expires) {
+		return false
+	}
+
+	if "" != r.notifyId {
+		delete(store.entries, r.notifyId)
+	}
+	r.notifyId = notifyId
+	r.extraNonce1 = old.extraNonce1
+	r.difficultyId = old.difficultyId
+	r.shares.restore(old.shares.pdiff())
+	r.connected = true
+	store.entries[notifyId] = r
+	return true
+}
+
+// the miner disconnected, start the expiry time
+func (store *registrationStore) release(r *minerRegistration, now time.Time) {
+	store.Lock()
+	defer store.Unlock()
+
+	r.connected = false
+	r.expires = now.Add(registrationLifetime)
+}
+
+// remove expired registrations
+//
+// returns the number removed
+func (store *registrationStore) purge(now time.Time) int {
+	store.Lock()
+	defer store.Unlock()
+
+	n := 0
+	for notifyId, r := range store.entries {
+		if !r.connected && now.After(r.expires) {
+			delete(store.entries, notifyId)
+			n += 1
+		}
+	}
+	return n
+}
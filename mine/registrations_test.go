@@ -0,0 +1,83 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// create a registration as a new connection would
+func newTestRegistration() *minerRegistration {
+	return &minerRegistration{
+		shares:     newVarDiff(10*time.Second, 1.0),
+		authorised: newAuthorisedWorkers(),
+	}
+}
+
+// test resuming and expiry of registrations
+func TestRegistrations(t *testing.T) {
+
+	store := registrationStore{
+		entries: make(map[string]*minerRegistration),
+	}
+	now := time.Now()
+
+	first := newTestRegistration()
+	first.extraNonce1 = []byte{1, 2, 3, 4}
+	first.difficultyId = "difficulty-id"
+	first.shares.restore(8.0)
+	store.add("notify-id", first)
+
+	// cannot take over while the first connection is active
+	second := newTestRegistration()
+	if store.resume("notify-id", second, now) {
+		t.Fatalf("resumed a connected registration")
+	}
+
+	// unknown ids are not resumed
+	store.release(first, now)
+	if store.resume("unknown", second, now) {
+		t.Fatalf("resumed an unknown registration")
+	}
+
+	// after disconnecting the values are restored
+	if !store.resume("notify-id", second, now.Add(time.Minute)) {
+		t.Fatalf("resume failed")
+	}
+	if !bytes.Equal(first.extraNonce1, second.extraNonce1) {
+		t.Errorf("extraNonce1: %x  expected: %x", second.extraNonce1, first.extraNonce1)
+	}
+	if "difficulty-id" != second.difficultyId {
+		t.Errorf("difficultyId: %q", second.difficultyId)
+	}
+	if d := second.shares.pdiff(); 8.0 != d {
+		t.Errorf("difficulty: %v  expected: 8", d)
+	}
+	if second != store.entries["notify-id"] || !second.connected {
+		t.Errorf("resumed registration not stored")
+	}
+
+	// expired registrations are neither resumed nor kept
+	store.release(second, now)
+	third := newTestRegistration()
+	later := now.Add(registrationLifetime + time.Second)
+	if store.resume("notify-id", third, later) {
+		t.Errorf("resumed an expired registration")
+	}
+	if n := store.purge(later); 1 != n {
+		t.Errorf("purged: %d  expected: 1", n)
+	}
+	if 0 != len(store.entries) {
+		t.Errorf("entries remain: %d", len(store.entries))
+	}
+
+	// connected registrations are never purged
+	store.add("other-id", third)
+	if n := store.purge(later.Add(registrationLifetime)); 0 != n {
+		t.Errorf("purged connected: %d", n)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"sort"
+	"strings"
+	"time"
+)
+
+// a transaction that can be put in a block
+type Candidate struct {
+	Id       block.Digest
+	Requires []block.Digest // must come earlier in the block
+	Provides []block.Digest // bitmarks of a batch issue that transfers can require
+	Spends   *block.Digest  // at most one record in a block can spend a bitmark
+	Signer   string         // public key that signed it
+	Fee      uint64
+
+	Expires time.Time // cannot be mined after this, zero if never
+}
+
+// chooses the transactions for a block
+//
+// candidates are in the order they became available and the result
+// must be in dependency order: an asset before its issues and an
+// issue before any transfer of it
+type SelectionPolicy interface {
+	Select(candidates []Candidate, maximum int) []block.Digest
+}
+
+// the available policies
+type FIFOSelection struct{}
+type FeeSelection struct{}
+type FairSelection struct{}
+
+// convert a configuration value to a selection policy
+func ParseSelection(s string) (SelectionPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "fifo":
+		return FIFOSelection{}, nil
+	case "fee":
+		return FeeSelection{}, nil
+	case "fair":
+		return FairSelection{}, nil
+	default:
+		return FIFOSelection{}, fault.ErrInvalidSelection
+	}
+}
+
+// in the order they became available
+func (FIFOSelection) Select(candidates []Candidate, maximum int) []block.Digest {
+	return schedule(candidates, maximum)
+}
+
+// highest fee first, otherwise in the order they became available
+func (FeeSelection) Select(candidates []Candidate, maximum int) []block.Digest {
+	ordered := make([]Candidate, len(candidates))
+	copy(ordered, candidates)
+	sort.Stable(byFee(ordered))
+	return schedule(ordered, maximum)
+}
+
+// take one transaction from each signer in turn so that one signer
+// with many transactions cannot fill the block
+func (FairSelection) Select(candidates []Candidate, maximum int) []block.Digest {
+
+	signers := []string{}
+	queues := make(map[string][]Candidate)
+	for _, c := range candidates {
+		if _, found := queues[c.Signer]; !found {
+			signers = append(signers, c.Signer)
+		}
+		queues[c.Signer] = append(queues[c.Signer], c)
+	}
+
+	ordered := make([]Candidate, 0, len(candidates))
+	for len(ordered) < len(candidates) {
+		for _, signer := range signers {
+			if q := queues[signer]; len(q) > 0 {
+				ordered = append(ordered, q[0])
+				queues[signer] = q[1:]
+			}
+		}
+	}
+	return schedule(ordered, maximum)
+}
+
+// to sort candidates by decreasing fee
+type byFee []Candidate
+
+func (a byFee) Len() int           { return len(a) }
+func (a byFee) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFee) Less(i, j int) bool { return a[i].Fee > a[j].Fee }
+
+// states while scheduling
+const (
+	unscheduled = iota
+	scheduling
+	scheduled
+	unschedulable
+)
+
+// take candidates in the given order up to the maximum
+//
+// records a candidate requires are brought forward, a candidate is
+// left out if anything it requires is not a candidate or if its
+// bitmark has already been spent in this block
+func schedule(ordered []Candidate, maximum int) []block.Digest {
+
+	provider := make(map[block.Digest]int, len(ordered))
+	for i, c := range ordered {
+		provider[c.Id] = i
+		for _, d := range c.Provides {
+			provider[d] = i
+		}
+	}
+
+	status := make([]int, len(ordered))
+	spent := make(map[block.Digest]struct{})
+	ids := make([]block.Digest, 0, maximum)
+
+	var place func(i int) bool
+	place = func(i int) bool {
+		switch status[i] {
+		case scheduled:
+			return true
+		case scheduling, unschedulable:
+			return false
+		}
+		status[i] = scheduling
+
+		c := &ordered[i]
+		for _, d := range c.Requires {
+			j, found := provider[d]
+			if !found || !place(j) {
+				status[i] = unschedulable
+				return false
+			}
+		}
+		if nil != c.Spends {
+			if _, found := spent[*c.Spends]; found {
+				status[i] = unschedulable
+				return false
+			}
+		}
+		if len(ids) >= maximum {
+			status[i] = unschedulable
+			return false
+		}
+
+		if nil != c.Spends {
+			spent[*c.Spends] = struct{}{}
+		}
+		ids = append(ids, c.Id)
+		status[i] = scheduled
+		return true
+	}
+
+	for i := range ordered {
+		if len(ids) >= maximum {
+			break
+		}
+		place(i)
+	}
+	return ids
+}
+
+// remove the candidates that can no longer be mined
+func unexpired(candidates []Candidate, now time.Time) []Candidate {
+	result := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.Expires.IsZero() || !now.After(c.Expires) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// create the candidate for an available transaction
+//
+// returns false if it is no longer waiting to be mined
+func newCandidate(id block.Digest, fee func(record interface{}) uint64) (Candidate, bool) {
+
+	r, ok := transaction.Link(id).Requirements()
+	if !ok {
+		return Candidate{}, false
+	}
+
+	c := Candidate{
+		Id:     id,
+		Signer: r.Signer,
+	}
+	if transfer, ok := r.Record.(*transaction.BitmarkCountersignedTransfer); ok && 0 != transfer.Expiry {
+		c.Expires = time.Unix(int64(transfer.Expiry), 0).UTC()
+		if transfer.IsExpired(time.Now()) {
+			return Candidate{}, false
+		}
+	}
+	for _, link := range r.Requires {
+		c.Requires = append(c.Requires, block.Digest(link))
+	}
+	if nil != r.Spends {
+		spends := block.Digest(*r.Spends)
+		c.Spends = &spends
+	}
+	if batch, ok := r.Record.(*transaction.BitmarkBatchIssue); ok {
+		c.Provides = make([]block.Digest, batch.Count)
+		for i := uint64(0); i < batch.Count; i += 1 {
+			c.Provides[i] = block.Digest(transaction.BatchItemLink(transaction.Link(id), batch.Nonce+i))
+		}
+	}
+	if nil != fee {
+		c.Fee = fee(r.Record)
+	}
+	return c, true
+}
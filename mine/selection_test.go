@@ -0,0 +1,280 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"encoding/binary"
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// all the policies to test
+var testPolicies = []struct {
+	name   string
+	policy SelectionPolicy
+}{
+	{"fifo", FIFOSelection{}},
+	{"fee", FeeSelection{}},
+	{"fair", FairSelection{}},
+}
+
+// check the configuration values for selection
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		s      string
+		policy SelectionPolicy
+		err    error
+	}{
+		{"", FIFOSelection{}, nil},
+		{"fifo", FIFOSelection{}, nil},
+		{" FIFO ", FIFOSelection{}, nil},
+		{"fee", FeeSelection{}, nil},
+		{"fair", FairSelection{}, nil},
+		{"random", FIFOSelection{}, fault.ErrInvalidSelection},
+	}
+
+	for i, item := range tests {
+		policy, err := ParseSelection(item.s)
+		if item.err != err {
+			t.Errorf("%d: %q  error: %v  expected: %v", i, item.s, err, item.err)
+			continue
+		}
+		if item.policy != policy {
+			t.Errorf("%d: %q  policy: %T  expected: %T", i, item.s, policy, item.policy)
+		}
+	}
+}
+
+// test the order of independent transactions
+func TestSelectionOrder(t *testing.T) {
+
+	candidates := []Candidate{
+		{Id: testDigest(1), Signer: "a", Fee: 1},
+		{Id: testDigest(2), Signer: "a", Fee: 3},
+		{Id: testDigest(3), Signer: "a", Fee: 2},
+		{Id: testDigest(4), Signer: "b", Fee: 3},
+		{Id: testDigest(5), Signer: "c", Fee: 1},
+	}
+
+	tests := []struct {
+		policy   SelectionPolicy
+		maximum  int
+		expected []uint64
+	}{
+		{FIFOSelection{}, 10, []uint64{1, 2, 3, 4, 5}},
+		{FIFOSelection{}, 2, []uint64{1, 2}},
+		{FeeSelection{}, 10, []uint64{2, 4, 3, 1, 5}},
+		{FeeSelection{}, 3, []uint64{2, 4, 3}},
+		{FairSelection{}, 10, []uint64{1, 4, 5, 2, 3}},
+		{FairSelection{}, 3, []uint64{1, 4, 5}},
+	}
+
+	for i, test := range tests {
+		ids := test.policy.Select(candidates, test.maximum)
+		if len(test.expected) != len(ids) {
+			t.Errorf("%d: %T  count: %d  expected: %d", i, test.policy, len(ids), len(test.expected))
+			continue
+		}
+		for j, n := range test.expected {
+			if testDigest(n) != ids[j] {
+				t.Errorf("%d: %T  position: %d  expected: %d", i, test.policy, j, n)
+			}
+		}
+	}
+}
+
+// test dependencies are brought forward and invalid records left out
+func TestSelectionDependencies(t *testing.T) {
+
+	asset := testDigest(1)
+	issue := testDigest(2)
+	batch := testDigest(3)
+	item := testDigest(30)
+	spends := issue
+
+	candidates := []Candidate{
+		{Id: testDigest(4), Requires: []block.Digest{issue}, Spends: &spends, Fee: 9}, // transfer
+		{Id: testDigest(5), Requires: []block.Digest{issue}, Spends: &spends, Fee: 1}, // double spend
+		{Id: testDigest(6), Requires: []block.Digest{item}, Spends: &item, Fee: 8},    // transfer from batch
+		{Id: testDigest(7), Requires: []block.Digest{testDigest(99)}, Fee: 9},         // missing
+		{Id: issue, Requires: []block.Digest{asset}},
+		{Id: batch, Requires: []block.Digest{asset}, Provides: []block.Digest{item}},
+		{Id: asset},
+	}
+
+	for _, p := range testPolicies {
+		ids := p.policy.Select(candidates, 10)
+		checkBlock(t, p.name, candidates, ids, 10)
+		if 5 != len(ids) {
+			t.Errorf("%s: count: %d  expected: 5", p.name, len(ids))
+		}
+		for _, id := range ids {
+			if testDigest(7) == id {
+				t.Errorf("%s: record with missing dependency selected", p.name)
+			}
+		}
+	}
+}
+
+// test every generated block is valid against the dependency rules
+func TestSelectionRandom(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 200; round += 1 {
+		candidates := randomCandidates(r, 1+r.Intn(100))
+		for _, p := range testPolicies {
+			for _, maximum := range []int{1, 5, len(candidates) / 2, len(candidates)} {
+				ids := p.policy.Select(candidates, maximum)
+				checkBlock(t, p.name, candidates, ids, maximum)
+			}
+		}
+	}
+}
+
+// make a set of assets, issues and chains of transfers
+//
+// some assets and issues are already mined and so are not candidates,
+// some transfers spend the same bitmark and some require records
+// that are not yet available
+func randomCandidates(r *rand.Rand, n int) []Candidate {
+
+	candidates := []Candidate{}
+	bitmarks := []block.Digest{} // current records that can be transferred
+	assets := []block.Digest{}   // assets that can be issued
+	next := uint64(1)
+
+	newId := func() block.Digest {
+		next += 1
+		return testDigest(next)
+	}
+
+	signers := []string{"a", "b", "c", "d"}
+	add := func(c Candidate) {
+		c.Signer = signers[r.Intn(len(signers))]
+		c.Fee = uint64(r.Intn(5))
+		candidates = append(candidates, c)
+	}
+
+	for len(candidates) < n {
+		switch r.Intn(6) {
+		case 0: // asset, maybe already mined
+			id := newId()
+			assets = append(assets, id)
+			if 0 == r.Intn(2) {
+				add(Candidate{Id: id})
+			}
+
+		case 1: // issue
+			if 0 == len(assets) {
+				continue
+			}
+			id := newId()
+			asset := assets[r.Intn(len(assets))]
+			add(Candidate{Id: id, Requires: []block.Digest{asset}})
+			bitmarks = append(bitmarks, id)
+
+		case 2: // batch issue
+			if 0 == len(assets) {
+				continue
+			}
+			id := newId()
+			asset := assets[r.Intn(len(assets))]
+			items := []block.Digest{newId(), newId(), newId()}
+			add(Candidate{Id: id, Requires: []block.Digest{asset}, Provides: items})
+			bitmarks = append(bitmarks, items...)
+
+		case 3, 4: // transfer, sometimes a double spend
+			if 0 == len(bitmarks) {
+				continue
+			}
+			i := r.Intn(len(bitmarks))
+			previous := bitmarks[i]
+			id := newId()
+			add(Candidate{Id: id, Requires: []block.Digest{previous}, Spends: &previous})
+			if 0 != r.Intn(4) {
+				bitmarks[i] = id
+			}
+
+		case 5: // requires a record that is not available
+			previous := newId()
+			add(Candidate{Id: newId(), Requires: []block.Digest{previous}, Spends: &previous})
+		}
+	}
+
+	// the order they become available is not the dependency order
+	r.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates
+}
+
+// check a block follows the dependency rules
+func checkBlock(t *testing.T, name string, candidates []Candidate, ids []block.Digest, maximum int) {
+
+	if len(ids) > maximum {
+		t.Errorf("%s: count: %d  exceeds: %d", name, len(ids), maximum)
+	}
+
+	byId := make(map[block.Digest]*Candidate)
+	for i := range candidates {
+		byId[candidates[i].Id] = &candidates[i]
+	}
+
+	included := make(map[block.Digest]struct{})
+	spent := make(map[block.Digest]struct{})
+	for i, id := range ids {
+		c, found := byId[id]
+		if !found {
+			t.Fatalf("%s: %d: not a candidate: %s", name, i, id)
+		}
+		if _, found := included[id]; found {
+			t.Fatalf("%s: %d: duplicate: %s", name, i, id)
+		}
+		for _, d := range c.Requires {
+			if _, found := included[d]; !found {
+				t.Fatalf("%s: %d: %s  before its requirement: %s", name, i, id, d)
+			}
+		}
+		if nil != c.Spends {
+			if _, found := spent[*c.Spends]; found {
+				t.Fatalf("%s: %d: %s  spends again: %s", name, i, id, *c.Spends)
+			}
+			spent[*c.Spends] = struct{}{}
+		}
+		included[id] = struct{}{}
+		for _, d := range c.Provides {
+			included[d] = struct{}{}
+		}
+	}
+}
+
+// a distinct digest for each number
+func testDigest(n uint64) block.Digest {
+	buffer := make([]byte, 8)
+	binary.BigEndian.PutUint64(buffer, n)
+	return block.NewDigest(buffer)
+}
+
+// test expired countersigned transfers are left out
+func TestSelectionExpired(t *testing.T) {
+	now := time.Now()
+	candidates := []Candidate{
+		{Id: testDigest(1)},
+		{Id: testDigest(2), Expires: now.Add(-time.Second)},
+		{Id: testDigest(3), Expires: now},
+		{Id: testDigest(4), Expires: now.Add(time.Hour)},
+	}
+
+	result := unexpired(candidates, now)
+	expected := []Candidate{candidates[0], candidates[2], candidates[3]}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("result: %v  expected: %v", result, expected)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/bitmark-inc/bitmarkd/gnomon"
 	"github.com/bitmark-inc/bitmarkd/messagebus"
 	"github.com/bitmark-inc/bitmarkd/transaction"
+	"github.com/bitmark-inc/bitmarkd/util"
 	"github.com/bitmark-inc/logger"
 	"io"
 	"sync/atomic"
@@ -31,6 +32,11 @@ type Mining struct {
 	notifyId     string
 	difficultyId string
 	extraNonce1  []byte
+	registration *minerRegistration
+	workers      *Workers
+	conn         io.ReadWriteCloser
+	client       string // address for throttling failed log ins
+	statistics   *minerStatistics
 	//argument *ServerArgument
 	//m           sync.Mutex
 	//value       int
@@ -44,15 +50,19 @@ const (
 )
 
 // miner registrations
+//
+// the subscription values are protected by the lock of
+// activeRegistrations once the registration has been stored
 type minerRegistration struct {
+	notifyId     string
 	extraNonce1  []byte // this is unique per miner and a random value
 	difficultyId string
+	connected    bool               // in use by a connection
+	expires      time.Time          // when no longer connected
+	shares       *varDiff           // share target for this miner
+	authorised   *authorisedWorkers // workers logged in on this connection
 }
 
-// the active registrations
-// indexed by notifyId
-var activeRegistrations map[string]minerRegistration
-
 // miner subscription
 // ------------------
 
@@ -65,15 +75,27 @@ type SubscribeReply []interface{}
 
 func (mining *Mining) Subscribe(arguments SubscribeArguments, reply *SubscribeReply) error {
 
+	// a throttled client cannot start again with a new subscription
+	if mining.workers.blocked(mining.client, time.Now()) {
+		return ErrUnauthorizedWorker
+	}
+
 	// check if there is an existing registration
 	if "" != arguments.NotifyId {
-		if r, ok := activeRegistrations[arguments.NotifyId]; ok {
+		r := mining.registration
+		if activeRegistrations.resume(arguments.NotifyId, r, time.Now()) {
+			mining.log.Infof("resumed subscription: %s", arguments.NotifyId)
+
+			mining.notifyId = arguments.NotifyId
+			mining.difficultyId = r.difficultyId
+			mining.extraNonce1 = r.extraNonce1
+
 			*reply = SubscribeReply{
 				[][]string{
 					{"mining.set_difficulty", r.difficultyId},
 					{"mining.notify", arguments.NotifyId},
 				},
-				r.extraNonce1,
+				hex.EncodeToString(r.extraNonce1),
 				extraNonce2Size,
 			}
 			return nil
@@ -95,9 +117,10 @@ func (mining *Mining) Subscribe(arguments SubscribeArguments, reply *SubscribeRe
 	mining.difficultyId = difficultyId
 	mining.extraNonce1 = extraNonce1
 
-	// ***** FIX THIS: save above in activeRegistrations *****
-	// but need to consider a way to expire these
-	// do for now just issue a new value
+	// save so that the miner can resume after reconnecting
+	mining.registration.extraNonce1 = extraNonce1
+	mining.registration.difficultyId = difficultyId
+	activeRegistrations.add(notifyId, mining.registration)
 
 	*reply = SubscribeReply{
 		[][]string{
@@ -119,13 +142,23 @@ type AuthoriseArguments struct {
 }
 
 // miner log in
+//
+// work is only sent to a connection after a worker has logged in
+// and only shares from logged in workers are accepted
 func (mining *Mining) Authorize(arguments AuthoriseArguments, reply *bool) error {
 
-	// ***** FIX THIS: need a proper config setting *****
-	if arguments.Username == arguments.Password {
-		return ErrUnauthorizedWorker
+	log := mining.log
+	client := mining.client
+
+	err := mining.workers.authorise(arguments.Username, arguments.Password, util.ClientFingerprint(mining.conn), client, time.Now())
+	if nil != err {
+		log.Warnf("worker: %q  client: %s  authorisation failed", arguments.Username, client)
+		return err
 	}
 
+	log.Infof("worker: %q  client: %s  authorised", arguments.Username, client)
+	mining.registration.authorised.add(arguments.Username)
+
 	*reply = true
 	return nil
 }
@@ -162,12 +195,24 @@ func fromAny(s string, endian binary.ByteOrder) uint32 {
 }
 
 // miner submit result
-func (mining *Mining) Submit(arguments SubmitArguments, reply *bool) error {
+func (mining *Mining) Submit(arguments SubmitArguments, reply *bool) (err error) {
 
 	jobId := stringToJobId(arguments.JobId)
 
 	log := mining.log
 
+	// count every share
+	pdiff := 0.0
+	found := false
+	defer func() {
+		mining.statistics.submit(err, pdiff, found, time.Now())
+	}()
+
+	if !mining.registration.authorised.has(arguments.Username) {
+		log.Warnf("submit from unauthorised worker: %q", arguments.Username)
+		return ErrUnauthorizedWorker
+	}
+
 	*reply = true
 
 	extraNonce2, err := hex.DecodeString(arguments.ExtraNonce2)
@@ -197,23 +242,56 @@ func (mining *Mining) Submit(arguments SubmitArguments, reply *bool) error {
 	nonce12 = append(nonce12, mining.extraNonce1...)
 	nonce12 = append(nonce12, extraNonce2...)
 
+	// a share that does not meet the network difficulty only
+	// counts towards the miner's share rate
+	shares := mining.registration.shares
 	digest, blk, ok := block.MinerCheckIn(timestamp, ntime, nonce, nonce12, addresses, ids)
-	if !ok {
-		log.Warnf("difficulty NOT MET: %s", digest)
+	pdiff, accepted := shares.accept(digest)
+	if !accepted && !ok {
+		log.Warnf("share difficulty NOT MET: %s", digest)
 		return ErrLowDifficultyShare
 	}
 
+	// the same solution must only be counted once
+	share := make([]byte, len(nonce12)+8)
+	copy(share, nonce12)
+	binary.BigEndian.PutUint32(share[len(nonce12):], ntime)
+	binary.BigEndian.PutUint32(share[len(nonce12)+4:], nonce)
+	if err := jobQueue.submitShare(jobId, share); nil != err {
+		log.Warnf("share: %x  error: %v", share, err)
+		return err
+	}
+	if !ok {
+		log.Infof("share accepted: digest: %s", digest)
+		return nil
+	}
+
 	log.Infof("difficulty met: digest: %s", digest)
+	found = true
+
+	blockFound(jobId, blk)
+
+	return nil
+}
+
+// finish a block that MinerCheckIn has saved
+func blockFound(jobId jobIdentifier, blk block.Packed) {
 
 	// mark the tx as mined
 	for _, id := range jobQueue.confirm(jobId) {
 		txid := transaction.Link(id)
+
+		// a conflicting record mined elsewhere may have removed it
+		if _, found := txid.State(); !found {
+			continue
+		}
 		txid.SetState(transaction.MinedTransaction)
 	}
 
-	messagebus.Send(block.Mined(blk))
+	// only now can the next job be assembled without these
+	messagebus.Notify(messagebus.EventBlockSaved)
 
-	return nil
+	messagebus.Send(block.Mined(blk))
 }
 
 // --------------------
@@ -232,18 +310,19 @@ func (mining *Mining) Submit(arguments SubmitArguments, reply *bool) error {
 //    ntime         - Current ntime.
 //    clean_jobs    - When true, server indicates that submitting shares from previous jobs don't have a sense and such shares will be rejected.
 //                    When this flag is set, miner should also drop all previous jobs, so job_ids can be eventually rotated.
+//
+// the difficulty sent is the miner's share target, which follows its
+// share rate and never exceeds the network difficulty
 func backgroundNotifier(conn Notifier, stop <-chan bool, argument interface{}) {
 
-	serverArgument := argument.(*ServerArgument)
-	log := serverArgument.Log
+	mining := argument.(*Mining)
+	log := mining.log
+	shares := mining.registration.shares
 
 	log.Info("backgroundNotifier: starting…")
 	interval := 6 * time.Second // one tenth of a minute
 
-	// send out difficulty
-	difficultyValue := difficulty.Current.Pdiff()
-	conn.Notify("mining.set_difficulty", []interface{}{difficultyValue})
-
+	difficultyValue := 0.0
 	currentJobId := jobIdentifierNil
 
 loop:
@@ -251,13 +330,19 @@ loop:
 		select {
 		case <-stop:
 			break loop
+		case <-jobQueue.changed(): // send new work at once
 		case <-time.After(interval):
 		}
 
+		// nothing is sent until a worker has logged in
+		if !mining.registration.authorised.any() {
+			continue loop
+		}
+
 		difficultySent := false
 
-		// if difficulty changed, re-send
-		if d := difficulty.Current.Pdiff(); d != difficultyValue {
+		// if share difficulty changed, re-send
+		if d, changed := shares.retarget(time.Now(), difficulty.Current.Pdiff()); changed {
 			difficultyValue = d
 			log.Infof("set difficulty: %v", d)
 			conn.Notify("mining.set_difficulty", []interface{}{difficultyValue})
@@ -274,7 +359,7 @@ loop:
 			log.Infof("job id: %v  minMerkle: %v  addresses: %#v  clean: %v  ok: %v", jobId, minMerkle, addresses, clean, ok)
 
 			if clean && !difficultySent {
-				conn.Notify("mining.set_difficulty", []interface{}{difficulty.Current.Pdiff()})
+				conn.Notify("mining.set_difficulty", []interface{}{difficultyValue})
 			}
 
 			cb1, cb2 := block.CurrentCoinbase(timestamp, extraNonce1Size+extraNonce2Size, addresses)
@@ -302,6 +387,7 @@ loop:
 
 			log.Infof("mining.notify data: %v", notificationData)
 			conn.Notify("mining.notify", notificationData)
+			shares.jobSent()
 		}
 	}
 
@@ -337,7 +423,10 @@ func (mining *Mining) T(arguments AB, reply *CC) error {
 
 // the argument passed to the callback
 type ServerArgument struct {
-	Log *logger.L
+	Log               *logger.L
+	Workers           *Workers      // accounts for Authorize
+	ShareInterval     time.Duration // desired time between shares from one miner
+	MinimumDifficulty float64       // lowest share difficulty
 }
 
 // listener callback
@@ -355,8 +444,23 @@ func Callback(conn io.ReadWriteCloser, argument interface{}) {
 
 	log := serverArgument.Log
 
+	// an unidentified client would escape the failure throttle
+	client, err := util.ClientAddress(conn)
+	if nil != err {
+		log.Errorf("client address: error: %v", err)
+		return
+	}
+
 	mining := &Mining{
 		log: log,
+		registration: &minerRegistration{
+			shares:     newVarDiff(serverArgument.ShareInterval, serverArgument.MinimumDifficulty),
+			authorised: newAuthorisedWorkers(),
+		},
+		workers:    serverArgument.Workers,
+		conn:       conn,
+		client:     client,
+		statistics: newMinerStatistics(client, time.Now()),
 	}
 
 	//server := rpc.NewServer()
@@ -368,5 +472,11 @@ func Callback(conn io.ReadWriteCloser, argument interface{}) {
 	atomic.AddInt64(&globalMinerCount, 1)
 	defer atomic.AddInt64(&globalMinerCount, -1)
 
-	ServeConnection(conn, server, backgroundNotifier, serverArgument)
+	addMiner(mining)
+	defer removeMiner(mining)
+
+	ServeConnection(conn, server, backgroundNotifier, mining)
+
+	// keep the registration for a while in case the miner reconnects
+	activeRegistrations.release(mining.registration, time.Now())
 }
@@ -0,0 +1,195 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hashes needed on average for a share of pool difficulty 1
+const hashesPerShare = 1 << 32
+
+// reasons a share is rejected
+const (
+	rejectStale         = "stale"
+	rejectLowDifficulty = "low-difficulty"
+	rejectUnauthorised  = "unauthorised"
+	rejectDuplicate     = "duplicate"
+	rejectInvalid       = "invalid"
+)
+
+// statistics for a single miner connection
+type minerStatistics struct {
+	sync.Mutex
+	address   string
+	connected time.Time
+	submitted uint64
+	accepted  uint64
+	rejected  map[string]uint64
+	work      float64 // sum of the pool difficulty of accepted shares
+	lastShare time.Time
+	blocks    uint64
+}
+
+// the connected miners
+var connectedMiners = struct {
+	sync.RWMutex
+	miners map[*Mining]struct{}
+}{
+	miners: make(map[*Mining]struct{}),
+}
+
+// blocks found by all miners since start
+var globalBlocksFound uint64
+
+// create the statistics for a new connection
+func newMinerStatistics(address string, now time.Time) *minerStatistics {
+	return &minerStatistics{
+		address:   address,
+		connected: now,
+		rejected:  make(map[string]uint64),
+	}
+}
+
+// record the result of a submit
+//
+// pdiff is the difficulty of the share target that was met
+func (s *minerStatistics) submit(err error, pdiff float64, block bool, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.submitted += 1
+	if nil != err {
+		s.rejected[rejectReason(err)] += 1
+		return
+	}
+	s.accepted += 1
+	s.work += pdiff
+	s.lastShare = now
+	if block {
+		s.blocks += 1
+		atomic.AddUint64(&globalBlocksFound, 1)
+	}
+}
+
+// classify a submit error
+func rejectReason(err error) string {
+	switch err {
+	case ErrJobNotFound:
+		return rejectStale
+	case ErrLowDifficultyShare:
+		return rejectLowDifficulty
+	case ErrUnauthorizedWorker:
+		return rejectUnauthorised
+	case ErrDuplicateShare:
+		return rejectDuplicate
+	default:
+		return rejectInvalid
+	}
+}
+
+// add a connection to the statistics
+func addMiner(mining *Mining) {
+	connectedMiners.Lock()
+	connectedMiners.miners[mining] = struct{}{}
+	connectedMiners.Unlock()
+}
+
+// remove a connection from the statistics
+func removeMiner(mining *Mining) {
+	connectedMiners.Lock()
+	delete(connectedMiners.miners, mining)
+	connectedMiners.Unlock()
+}
+
+// the statistics of one miner connection
+type MinerStatistics struct {
+	Workers    []string          `json:"workers"`
+	Address    string            `json:"address"`
+	Connected  time.Time         `json:"connected"`
+	Submitted  uint64            `json:"submitted"`
+	Accepted   uint64            `json:"accepted"`
+	Rejected   map[string]uint64 `json:"rejected"`
+	HashRate   float64           `json:"hashRate"` // hashes per second estimated from accepted shares
+	LastShare  *time.Time        `json:"lastShare"`
+	Difficulty float64           `json:"difficulty"` // current share difficulty
+	Blocks     uint64            `json:"blocks"`
+}
+
+// the statistics of all miners
+type PoolStatistics struct {
+	Connections int64             `json:"connections"`
+	Blocks      uint64            `json:"blocks"`   // found since start
+	JobQueue    int               `json:"jobQueue"` // jobs that can be submitted
+	Miners      []MinerStatistics `json:"miners"`
+}
+
+// get a snapshot of the mining statistics
+//
+// the miners are in the order they connected
+func Statistics() PoolStatistics {
+
+	now := time.Now()
+
+	connectedMiners.RLock()
+	miners := make([]MinerStatistics, 0, len(connectedMiners.miners))
+	for mining := range connectedMiners.miners {
+		miners = append(miners, mining.statistics.snapshot(now))
+		i := len(miners) - 1
+		miners[i].Workers = mining.registration.authorised.list()
+		miners[i].Difficulty = mining.registration.shares.pdiff()
+	}
+	connectedMiners.RUnlock()
+
+	sort.Sort(byConnected(miners))
+
+	depth := 0
+	if nil != jobQueue {
+		depth = jobQueue.depth()
+	}
+
+	return PoolStatistics{
+		Connections: atomic.LoadInt64(&globalMinerCount),
+		Blocks:      atomic.LoadUint64(&globalBlocksFound),
+		JobQueue:    depth,
+		Miners:      miners,
+	}
+}
+
+// copy the statistics of a connection
+func (s *minerStatistics) snapshot(now time.Time) MinerStatistics {
+	s.Lock()
+	defer s.Unlock()
+
+	m := MinerStatistics{
+		Address:   s.address,
+		Connected: s.connected,
+		Submitted: s.submitted,
+		Accepted:  s.accepted,
+		Rejected:  make(map[string]uint64, len(s.rejected)),
+		Blocks:    s.blocks,
+	}
+	for reason, n := range s.rejected {
+		m.Rejected[reason] = n
+	}
+	if elapsed := now.Sub(s.connected).Seconds(); elapsed > 0 {
+		m.HashRate = s.work * hashesPerShare / elapsed
+	}
+	if !s.lastShare.IsZero() {
+		lastShare := s.lastShare
+		m.LastShare = &lastShare
+	}
+	return m
+}
+
+// to sort miners by connection time
+type byConnected []MinerStatistics
+
+func (a byConnected) Len() int           { return len(a) }
+func (a byConnected) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byConnected) Less(i, j int) bool { return a[i].Connected.Before(a[j].Connected) }
@@ -0,0 +1,47 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"testing"
+	"time"
+)
+
+// test share counting and the hash rate estimate
+func TestMinerStatistics(t *testing.T) {
+
+	start := time.Now()
+	s := newMinerStatistics("127.0.0.1", start)
+
+	s.submit(nil, 2.0, false, start.Add(time.Second))
+	s.submit(nil, 2.0, true, start.Add(2*time.Second))
+	s.submit(ErrLowDifficultyShare, 0, false, start.Add(3*time.Second))
+	s.submit(ErrJobNotFound, 0, false, start.Add(4*time.Second))
+	s.submit(ErrJobNotFound, 0, false, start.Add(5*time.Second))
+
+	m := s.snapshot(start.Add(16 * time.Second))
+
+	if 5 != m.Submitted || 2 != m.Accepted || 1 != m.Blocks {
+		t.Errorf("submitted: %d  accepted: %d  blocks: %d", m.Submitted, m.Accepted, m.Blocks)
+	}
+	if 1 != m.Rejected[rejectLowDifficulty] || 2 != m.Rejected[rejectStale] {
+		t.Errorf("rejected: %v", m.Rejected)
+	}
+	if nil == m.LastShare || !m.LastShare.Equal(start.Add(2*time.Second)) {
+		t.Errorf("last share: %v", m.LastShare)
+	}
+
+	// 4 difficulty 1 shares in 16 seconds
+	expected := 4.0 * hashesPerShare / 16
+	if expected != m.HashRate {
+		t.Errorf("hash rate: %v  expected: %v", m.HashRate, expected)
+	}
+
+	// the snapshot is a copy
+	m.Rejected[rejectStale] = 99
+	if 2 != s.rejected[rejectStale] {
+		t.Errorf("snapshot shares the rejected map")
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/difficulty"
+	"github.com/bitmark-inc/bitmarkd/util"
+	"github.com/bitmark-inc/logger"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// getblocktemplate style mining over HTTP
+// ---------------------------------------
+//
+// for solo mining software that does not speak stratum, each HTTP
+// POST carries one JSON-RPC 1.0 request and workers log in with
+// basic authentication or a client certificate
+//
+// get work:
+//   {"id": 1, "method": "getblocktemplate", "params": []}
+//   {"id": 1, "error": null, "result": {
+//      "version": 2,
+//      "previousblockhash": "00000000440b…",  -> big endian hex
+//      "workid": "001a",                       -> job id to return with the solution
+//      "coinbase1": "0100…",                   -> initial part of coinbase, ends with a random nonce prefix
+//      "coinbase2": "072f…",                   -> final part of coinbase
+//      "extranoncesize": 4,                    -> bytes the miner inserts between coinbase1 and coinbase2
+//      "merklebranch": ["…"],                  -> same as the stratum merkle_branch
+//      "bits": "1c2ac4af",
+//      "target": "00000000ffff…",              -> big endian hex
+//      "curtime": 1347323577,                  -> ntime for the header
+//      "height": 1234}}
+//
+// submit a solution: the 80 byte header followed by the full coinbase
+//   {"id": 2, "method": "submitblock", "params": ["0200…", {"workid": "001a"}]}
+//   {"id": 2, "error": null, "result": null}         -> block accepted
+//   {"id": 2, "error": null, "result": "high-hash"}  -> rejected, BIP22 style reason
+
+// limits
+const (
+	blockHeaderSize     = 80        // Bitcoin compatible header
+	maximumTemplateBody = 64 * 1024 // largest request accepted
+)
+
+// reasons a solution is rejected
+const (
+	rejectBadSolution   = "rejected"
+	rejectStaleWork     = "stale-work"
+	rejectStalePrevious = "stale-prevblk"
+	rejectBadVersion    = "bad-version"
+	rejectBadBits       = "bad-diffbits"
+	rejectBadCoinbase   = "bad-cb"
+	rejectBadMerkleRoot = "bad-txnmrklroot"
+	rejectHighHash      = "high-hash"
+)
+
+// the work sent to a miner
+type BlockTemplate struct {
+	Version           uint32   `json:"version"`
+	PreviousBlockHash string   `json:"previousblockhash"`
+	WorkId            string   `json:"workid"`
+	Coinbase1         string   `json:"coinbase1"`
+	Coinbase2         string   `json:"coinbase2"`
+	ExtraNonceSize    int      `json:"extranoncesize"`
+	MerkleBranch      []string `json:"merklebranch"`
+	Bits              string   `json:"bits"`
+	Target            string   `json:"target"`
+	CurTime           int64    `json:"curtime"`
+	Height            uint64   `json:"height"`
+}
+
+// state of one HTTP connection
+type templateSession struct {
+	log     *logger.L
+	workers *Workers
+	conn    io.ReadWriteCloser
+	client  string
+
+	// the last successful log in, to avoid checking the hash on
+	// every request
+	username string
+	password string
+}
+
+// listener callback for getblocktemplate connections
+func TemplateCallback(conn io.ReadWriteCloser, argument interface{}) {
+
+	defer conn.Close()
+
+	serverArgument := argument.(*ServerArgument)
+	if nil == serverArgument {
+		panic("mine: nil serverArgument")
+	}
+	if nil == serverArgument.Log {
+		panic("mine: nil serverArgument.Log")
+	}
+
+	// an unidentified client would escape the failure throttle
+	client, err := util.ClientAddress(conn)
+	if nil != err {
+		serverArgument.Log.Errorf("client address: error: %v", err)
+		return
+	}
+
+	session := &templateSession{
+		log:     serverArgument.Log,
+		workers: serverArgument.Workers,
+		conn:    conn,
+		client:  client,
+	}
+
+	// so that jobs are assembled
+	atomic.AddInt64(&globalMinerCount, 1)
+	defer atomic.AddInt64(&globalMinerCount, -1)
+
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := http.ReadRequest(reader)
+		if nil != err {
+			if io.EOF != err {
+				session.log.Debugf("template: client: %s  read error: %v", session.client, err)
+			}
+			return
+		}
+
+		status, body, closing := session.serve(request)
+
+		response := &http.Response{
+			StatusCode:    status,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Request:       request,
+			Header:        make(http.Header),
+			ContentLength: int64(len(body)),
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			Close:         closing || request.Close,
+		}
+		response.Header.Set("Content-Type", "application/json")
+		if http.StatusUnauthorized == status {
+			response.Header.Set("WWW-Authenticate", `Basic realm="bitmarkd"`)
+		}
+
+		err = response.Write(conn)
+		if nil != err || response.Close {
+			return
+		}
+	}
+}
+
+// handle one HTTP request
+//
+// returns the status, the response body and whether to close the connection
+func (session *templateSession) serve(request *http.Request) (int, []byte, bool) {
+
+	// the whole body must be read to reach the next request
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, maximumTemplateBody+1))
+	request.Body.Close()
+	if nil != err {
+		return http.StatusBadRequest, nil, true
+	}
+	if len(body) > maximumTemplateBody {
+		return http.StatusRequestEntityTooLarge, nil, true
+	}
+
+	if "POST" != request.Method {
+		return http.StatusMethodNotAllowed, nil, false
+	}
+
+	username, password, _ := request.BasicAuth()
+	if !session.authorise(username, password) {
+		return http.StatusUnauthorized, nil, false
+	}
+
+	rpc := rpcRequest{}
+	err = json.Unmarshal(body, &rpc)
+	if nil != err {
+		return http.StatusBadRequest, nil, false
+	}
+
+	var result interface{}
+	switch rpc.Method {
+	case "getblocktemplate":
+		result, err = session.getBlockTemplate()
+	case "submitblock":
+		result, err = session.submitBlock(rpc.Params)
+	default:
+		return http.StatusNotFound, nil, false
+	}
+
+	buffer := &bytes.Buffer{}
+	if nil != err {
+		errorReply(buffer, rpc.ID, rpcMapError(err))
+	} else {
+		reply(buffer, rpc.ID, result)
+	}
+	return http.StatusOK, buffer.Bytes(), false
+}
+
+// check the worker log in
+func (session *templateSession) authorise(username string, password string) bool {
+
+	if "" != session.username && username == session.username && password == session.password {
+		return true
+	}
+
+	err := session.workers.authorise(username, password, util.ClientFingerprint(session.conn), session.client, time.Now())
+	if nil != err {
+		session.log.Warnf("worker: %q  client: %s  authorisation failed", username, session.client)
+		return false
+	}
+
+	session.log.Infof("worker: %q  client: %s  authorised", username, session.client)
+	session.username = username
+	session.password = password
+	return true
+}
+
+// the current job as a block template
+func (session *templateSession) getBlockTemplate() (interface{}, error) {
+
+	jobId, minMerkle, addresses, timestamp, _, ok := jobQueue.top()
+	if !ok {
+		session.log.Info("template: no work available")
+		return nil, ErrOtherUnknown
+	}
+
+	// random prefix so that solo miners do not repeat each other's work
+	prefix := make([]byte, extraNonce1Size)
+	_, err := io.ReadFull(rand.Reader, prefix)
+	if nil != err {
+		return nil, ErrOtherUnknown
+	}
+
+	height := block.Number()
+	cb1, cb2 := block.NewCoinbase(height, timestamp, extraNonceSize, addresses)
+
+	merkleBranch := make([]string, len(minMerkle))
+	for i, h := range minMerkle {
+		merkleBranch[i] = h.MinerHex()
+	}
+
+	return &BlockTemplate{
+		Version:           block.Version,
+		PreviousBlockHash: block.PreviousLink().String(),
+		WorkId:            jobId.String(),
+		Coinbase1:         hex.EncodeToString(cb1) + hex.EncodeToString(prefix),
+		Coinbase2:         hex.EncodeToString(cb2),
+		ExtraNonceSize:    extraNonce2Size,
+		MerkleBranch:      merkleBranch,
+		Bits:              difficulty.Current.String(),
+		Target:            fmt.Sprintf("%064x", difficulty.Current.BigInt()),
+		CurTime:           timestamp.Unix(),
+		Height:            height,
+	}, nil
+}
+
+// accept a solution
+//
+// result is nil if the block was accepted, otherwise the reason
+func (session *templateSession) submitBlock(params []interface{}) (interface{}, error) {
+
+	if len(params) < 2 {
+		return nil, ErrOtherUnknown
+	}
+	data, ok := params[0].(string)
+	if !ok {
+		return nil, ErrOtherUnknown
+	}
+	options, ok := params[1].(map[string]interface{})
+	if !ok {
+		return nil, ErrOtherUnknown
+	}
+	workId, ok := options["workid"].(string)
+	if !ok {
+		return nil, ErrOtherUnknown
+	}
+	solution, err := hex.DecodeString(data)
+	if nil != err {
+		return nil, ErrOtherUnknown
+	}
+
+	reason := session.solve(stringToJobId(workId), solution)
+	if "" != reason {
+		session.log.Warnf("submitblock: worker: %q  rejected: %s", session.username, reason)
+		return reason, nil
+	}
+	return nil, nil
+}
+
+// check and save a solution
+//
+// returns the reason for rejection or empty string if the block was saved
+func (session *templateSession) solve(jobId jobIdentifier, solution []byte) string {
+
+	if len(solution) <= blockHeaderSize {
+		return rejectBadSolution
+	}
+	header := block.Header{}
+	err := block.PackedHeader(solution[:blockHeaderSize]).Unpack(&header)
+	if nil != err {
+		return rejectBadSolution
+	}
+	coinbase := solution[blockHeaderSize:]
+
+	ids, addresses, timestamp, ok := jobQueue.getIds(jobId)
+	if !ok {
+		return rejectStaleWork
+	}
+
+	if block.Version != header.Version {
+		return rejectBadVersion
+	}
+	if block.PreviousLink() != header.PreviousBlock {
+		return rejectStalePrevious
+	}
+	if difficulty.Current.Bits() != header.Bits.Bits() {
+		return rejectBadBits
+	}
+
+	cb1, cb2 := block.NewCoinbase(block.Number(), timestamp, extraNonceSize, addresses)
+	extraNonce, ok := splitCoinbase(coinbase, cb1, cb2)
+	if !ok {
+		return rejectBadCoinbase
+	}
+
+	root := block.MerkleRootFromBranch(block.NewDigest(coinbase), 0, block.MinimumMerkleTree(ids))
+	if root != header.MerkleRoot {
+		return rejectBadMerkleRoot
+	}
+
+	digest, blk, ok := block.MinerCheckIn(timestamp, header.Time, header.Nonce, extraNonce, addresses, ids)
+	if !ok {
+		return rejectHighHash
+	}
+
+	session.log.Infof("submitblock: worker: %q  difficulty met: digest: %s", session.username, digest)
+	atomic.AddUint64(&globalBlocksFound, 1)
+
+	blockFound(jobId, blk)
+
+	return ""
+}
+
+// extract the nonce from a coinbase made from the template parts
+func splitCoinbase(coinbase []byte, cb1 []byte, cb2 []byte) ([]byte, bool) {
+	if len(cb1)+extraNonceSize+len(cb2) != len(coinbase) {
+		return nil, false
+	}
+	if !bytes.HasPrefix(coinbase, cb1) || !bytes.HasSuffix(coinbase, cb2) {
+		return nil, false
+	}
+	return coinbase[len(cb1) : len(cb1)+extraNonceSize], true
+}
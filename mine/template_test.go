@@ -0,0 +1,62 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"bytes"
+	"github.com/bitmark-inc/bitmarkd/block"
+	"testing"
+	"time"
+)
+
+// test a coinbase built from the template parts matches the block
+func TestTemplateCoinbase(t *testing.T) {
+
+	addresses := []block.MinerAddress{
+		{Currency: "bitcoin", Address: "n1CuYF7iKoAxUicVT2CmyJTQdXTtMWTPNd"},
+	}
+	timestamp := time.Now().UTC()
+	nonce := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	cb1, cb2 := block.NewCoinbase(1234, timestamp, extraNonceSize, addresses)
+
+	coinbase := make([]byte, 0, len(cb1)+len(nonce)+len(cb2))
+	coinbase = append(coinbase, cb1...)
+	coinbase = append(coinbase, nonce...)
+	coinbase = append(coinbase, cb2...)
+
+	full := block.NewFullCoinbase(1234, timestamp, nonce, addresses)
+	if !bytes.Equal(full, coinbase) {
+		t.Fatalf("coinbase: %x  expected: %x", coinbase, full)
+	}
+
+	extraNonce, ok := splitCoinbase(coinbase, cb1, cb2)
+	if !ok || !bytes.Equal(nonce, extraNonce) {
+		t.Errorf("nonce: %x  ok: %v  expected: %x", extraNonce, ok, nonce)
+	}
+
+	// wrong nonce size or altered parts are rejected
+	if _, ok := splitCoinbase(coinbase[1:], cb1, cb2); ok {
+		t.Errorf("short coinbase accepted")
+	}
+	altered := append([]byte{}, coinbase...)
+	altered[0] ^= 0xff
+	if _, ok := splitCoinbase(altered, cb1, cb2); ok {
+		t.Errorf("altered coinbase accepted")
+	}
+
+	// the root from the branch matches the full tree
+	ids := []block.Digest{
+		block.NewDigest([]byte("one")),
+		block.NewDigest([]byte("two")),
+		block.NewDigest([]byte("three")),
+	}
+	digest := block.NewDigest(coinbase)
+	tree := block.FullMerkleTree(digest, ids)
+	root := block.MerkleRootFromBranch(digest, 0, block.MinimumMerkleTree(ids))
+	if tree[len(tree)-1] != root {
+		t.Errorf("merkle root: %s  expected: %s", root, tree[len(tree)-1])
+	}
+}
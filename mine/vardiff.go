@@ -0,0 +1,160 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/difficulty"
+	"sync"
+	"time"
+)
+
+// vardiff tuning
+const (
+	defaultShareInterval = 10 * time.Second // desired time between shares
+	retargetInterval     = 60 * time.Second // minimum time between adjustments
+	maximumAdjustment    = 4.0              // largest change in one step
+	adjustmentDeadband   = 0.2              // ignore changes smaller than this fraction
+)
+
+// the share target of a single miner
+//
+// the difficulty is adjusted so that the miner submits about one
+// share per interval; a share at the previous difficulty is still
+// accepted until the miner has been sent a job at the new one
+type varDiff struct {
+	sync.Mutex
+	interval time.Duration
+	minimum  float64
+
+	current  *difficulty.Difficulty
+	previous *difficulty.Difficulty // nil once a job at current was sent
+	pending  bool                   // current not yet sent to the miner
+
+	start  time.Time // of the current measurement period
+	shares int       // accepted in the current period
+}
+
+// create a share target starting at the minimum difficulty
+func newVarDiff(interval time.Duration, minimum float64) *varDiff {
+	if interval <= 0 {
+		interval = defaultShareInterval
+	}
+	if minimum < 1.0 {
+		minimum = 1.0
+	}
+	d := difficulty.New()
+	d.SetPdiff(minimum)
+	return &varDiff{
+		interval: interval,
+		minimum:  minimum,
+		current:  d,
+		pending:  true,
+		start:    time.Now(),
+	}
+}
+
+// check a submitted digest against the share target
+//
+// returns:
+//   the pool difficulty of the target that was met
+//   true if it meets the current or still valid previous target
+func (v *varDiff) accept(digest block.Digest) (float64, bool) {
+	v.Lock()
+	defer v.Unlock()
+
+	target := v.current
+	ok := digest.Cmp(target.BigInt()) <= 0
+	if !ok && nil != v.previous {
+		target = v.previous
+		ok = digest.Cmp(target.BigInt()) <= 0
+	}
+	if !ok {
+		return 0, false
+	}
+	v.shares += 1
+	return target.Pdiff(), true
+}
+
+// adjust the target from the share rate
+//
+// the target never exceeds the network difficulty so that every
+// block candidate is also a share
+//
+// returns:
+//   the pool difficulty to send
+//   true if it must be sent to the miner
+func (v *varDiff) retarget(now time.Time, network float64) (float64, bool) {
+	v.Lock()
+	defer v.Unlock()
+
+	pdiff := v.current.Pdiff()
+	target := pdiff
+
+	elapsed := now.Sub(v.start)
+	if elapsed >= retargetInterval {
+		k := 1.0 / maximumAdjustment
+		if v.shares > 0 {
+			k = float64(v.shares) * v.interval.Seconds() / elapsed.Seconds()
+		}
+		if k > maximumAdjustment {
+			k = maximumAdjustment
+		} else if k < 1.0/maximumAdjustment {
+			k = 1.0 / maximumAdjustment
+		}
+		if k > 1.0+adjustmentDeadband || k < 1.0-adjustmentDeadband {
+			target = pdiff * k
+		}
+		v.start = now
+		v.shares = 0
+	}
+
+	if target < v.minimum {
+		target = v.minimum
+	}
+	if target > network {
+		target = network
+	}
+
+	if target != pdiff {
+		if nil == v.previous {
+			v.previous = v.current
+		}
+		v.current = difficulty.New()
+		v.current.SetPdiff(target)
+		v.pending = true
+	}
+
+	send := v.pending
+	v.pending = false
+	return v.current.Pdiff(), send
+}
+
+// the miner has been sent a job at the current target
+func (v *varDiff) jobSent() {
+	v.Lock()
+	v.previous = nil
+	v.Unlock()
+}
+
+// the current pool difficulty
+func (v *varDiff) pdiff() float64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.current.Pdiff()
+}
+
+// continue from the difficulty of an earlier connection
+func (v *varDiff) restore(pdiff float64) {
+	v.Lock()
+	defer v.Unlock()
+	if pdiff < v.minimum {
+		pdiff = v.minimum
+	}
+	v.current = difficulty.New()
+	v.current.SetPdiff(pdiff)
+	v.previous = nil
+	v.pending = true
+}
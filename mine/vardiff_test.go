@@ -0,0 +1,69 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"github.com/bitmark-inc/bitmarkd/block"
+	"testing"
+	"time"
+)
+
+// test the share target follows the share rate
+func TestVarDiff(t *testing.T) {
+
+	v := newVarDiff(10*time.Second, 1.0)
+	start := v.start
+	network := 1000.0
+
+	// first call always sends
+	d, send := v.retarget(start, network)
+	if 1.0 != d || !send {
+		t.Fatalf("initial: %v  send: %v", d, send)
+	}
+
+	// nothing changes before the retarget interval
+	d, send = v.retarget(start.Add(time.Second), network)
+	if 1.0 != d || send {
+		t.Errorf("early: %v  send: %v", d, send)
+	}
+
+	// a digest of all zeros meets any target
+	zero := block.Digest{}
+	for i := 0; i < 60; i += 1 {
+		if d, ok := v.accept(zero); !ok || 1.0 != d {
+			t.Fatalf("zero digest: %v  ok: %v", d, ok)
+		}
+	}
+
+	// 60 shares in 60s is ten times too fast so limit to 4×
+	d, send = v.retarget(start.Add(retargetInterval), network)
+	if 4.0 != d || !send {
+		t.Errorf("fast: %v  send: %v", d, send)
+	}
+
+	// the network difficulty is the upper limit
+	for i := 0; i < 60; i += 1 {
+		v.accept(zero)
+	}
+	d, send = v.retarget(start.Add(2*retargetInterval), 10.0)
+	if 10.0 != d || !send {
+		t.Errorf("network limit: %v  send: %v", d, send)
+	}
+
+	// no shares reduces the target
+	d, send = v.retarget(start.Add(3*retargetInterval), network)
+	if 2.5 != d || !send {
+		t.Errorf("slow: %v  send: %v", d, send)
+	}
+
+	// a digest of all ones meets no target
+	high := block.Digest{}
+	for i := range high {
+		high[i] = 0xff
+	}
+	if _, ok := v.accept(high); ok {
+		t.Errorf("high digest accepted")
+	}
+}
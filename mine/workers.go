@@ -0,0 +1,212 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"github.com/bitmark-inc/bitmarkd/util"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// throttling of failed log ins
+const (
+	failureWindow   = 5 * time.Minute // period over which failures are counted
+	maximumFailures = 5               // failures from one client address before throttling
+)
+
+// one way for a worker to log in
+//
+// either a bcrypt password hash or the fingerprint of a client
+// certificate, a worker can have several
+type WorkerCredential struct {
+	Name        string
+	Password    []byte                 // bcrypt hash
+	Fingerprint *util.FingerprintBytes // SHA256 of client certificate
+	Disabled    bool
+}
+
+// the worker accounts
+//
+// shared by all connections so that failed log ins are counted for
+// each client address
+type Workers struct {
+	sync.Mutex
+	credentials map[string][]WorkerCredential
+	failures    map[string]*failureCount
+	purged      time.Time
+}
+
+// failed log ins in the current window of one client
+type failureCount struct {
+	start time.Time
+	count int
+}
+
+// create the worker accounts
+//
+// with no credentials any worker is accepted
+func NewWorkers(credentials []WorkerCredential) *Workers {
+	workers := &Workers{
+		credentials: make(map[string][]WorkerCredential),
+		failures:    make(map[string]*failureCount),
+	}
+	for _, c := range credentials {
+		workers.credentials[c.Name] = append(workers.credentials[c.Name], c)
+	}
+	return workers
+}
+
+// true if any worker is accepted
+func (workers *Workers) open() bool {
+	return nil == workers || 0 == len(workers.credentials)
+}
+
+// check a worker log in
+//
+// a worker is accepted if it is not disabled and either the
+// connection has a matching client certificate or the password
+// matches; failures are counted for each client address and once
+// throttled no password is checked until the window expires
+func (workers *Workers) authorise(name string, password string, fingerprint *util.FingerprintBytes, client string, now time.Time) error {
+	if workers.open() {
+		return nil
+	}
+
+	workers.Lock()
+	throttled := workers.throttled(client, now)
+	credentials := workers.credentials[name]
+	workers.Unlock()
+
+	if throttled {
+		return ErrUnauthorizedWorker
+	}
+
+	disabled := false
+	for _, c := range credentials {
+		if c.Disabled {
+			disabled = true
+			break
+		}
+	}
+
+	ok := false
+	if !disabled {
+	loop:
+		for _, c := range credentials {
+			switch {
+			case nil != c.Fingerprint:
+				if nil != fingerprint && *fingerprint == *c.Fingerprint {
+					ok = true
+					break loop
+				}
+			case nil != c.Password:
+				if nil == bcrypt.CompareHashAndPassword(c.Password, []byte(password)) {
+					ok = true
+					break loop
+				}
+			}
+		}
+	}
+	if ok {
+		return nil
+	}
+
+	workers.Lock()
+	workers.fail(client, now)
+	workers.Unlock()
+	return ErrUnauthorizedWorker
+}
+
+// true if a client may not log in at present
+func (workers *Workers) blocked(client string, now time.Time) bool {
+	if workers.open() {
+		return false
+	}
+	workers.Lock()
+	defer workers.Unlock()
+	return workers.throttled(client, now)
+}
+
+// true if a client has too many recent failures
+//
+// only call while locked
+func (workers *Workers) throttled(client string, now time.Time) bool {
+	f, found := workers.failures[client]
+	return found && now.Sub(f.start) < failureWindow && f.count >= maximumFailures
+}
+
+// count a failure
+//
+// only call while locked
+func (workers *Workers) fail(client string, now time.Time) {
+
+	// discard clients that have been quiet for a whole window
+	if now.Sub(workers.purged) >= failureWindow {
+		for c, f := range workers.failures {
+			if now.Sub(f.start) >= failureWindow {
+				delete(workers.failures, c)
+			}
+		}
+		workers.purged = now
+	}
+
+	f, found := workers.failures[client]
+	if !found || now.Sub(f.start) >= failureWindow {
+		f = &failureCount{
+			start: now,
+		}
+		workers.failures[client] = f
+	}
+	f.count += 1
+}
+
+// the workers logged in on one connection
+type authorisedWorkers struct {
+	sync.RWMutex
+	names map[string]struct{}
+}
+
+// create an empty set of workers
+func newAuthorisedWorkers() *authorisedWorkers {
+	return &authorisedWorkers{
+		names: make(map[string]struct{}),
+	}
+}
+
+// record a successful log in
+func (a *authorisedWorkers) add(name string) {
+	a.Lock()
+	a.names[name] = struct{}{}
+	a.Unlock()
+}
+
+// true if the worker has logged in
+func (a *authorisedWorkers) has(name string) bool {
+	a.RLock()
+	defer a.RUnlock()
+	_, found := a.names[name]
+	return found
+}
+
+// true if any worker has logged in
+func (a *authorisedWorkers) any() bool {
+	a.RLock()
+	defer a.RUnlock()
+	return 0 != len(a.names)
+}
+
+// the names of the logged in workers in order
+func (a *authorisedWorkers) list() []string {
+	a.RLock()
+	names := make([]string, 0, len(a.names))
+	for name := range a.names {
+		names = append(names, name)
+	}
+	a.RUnlock()
+	sort.Strings(names)
+	return names
+}
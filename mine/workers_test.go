@@ -0,0 +1,84 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mine
+
+import (
+	"github.com/bitmark-inc/bitmarkd/util"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+// test worker log in and throttling
+func TestWorkers(t *testing.T) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if nil != err {
+		t.Fatalf("hash error: %v", err)
+	}
+	fingerprint := util.Fingerprint([]byte("certificate"))
+	other := util.Fingerprint([]byte("other"))
+
+	workers := NewWorkers([]WorkerCredential{
+		{Name: "one", Password: hash},
+		{Name: "two", Fingerprint: &fingerprint},
+		{Name: "three", Password: hash, Disabled: true},
+	})
+
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		password    string
+		fingerprint *util.FingerprintBytes
+		ok          bool
+	}{
+		{"one", "secret", nil, true},
+		{"one", "wrong", nil, false},
+		{"one", "secret", &other, true},
+		{"two", "", &fingerprint, true},
+		{"two", "secret", &other, false},
+		{"two", "secret", nil, false},
+		{"three", "secret", nil, false},
+		{"four", "secret", nil, false},
+	}
+
+	for i, test := range tests {
+		err := workers.authorise(test.name, test.password, test.fingerprint, "client-"+test.name, now)
+		if test.ok != (nil == err) {
+			t.Errorf("%d: worker: %q  error: %v  expected ok: %v", i, test.name, err, test.ok)
+		}
+	}
+
+	// after the maximum failures even a correct password fails
+	for i := 0; i < maximumFailures; i += 1 {
+		workers.authorise("one", "wrong", nil, "attacker", now)
+	}
+	if err := workers.authorise("one", "secret", nil, "attacker", now); nil == err {
+		t.Errorf("throttled client was accepted")
+	}
+	if !workers.blocked("attacker", now) {
+		t.Errorf("throttled client not blocked")
+	}
+
+	// other clients are not affected
+	if err := workers.authorise("one", "secret", nil, "client", now); nil != err {
+		t.Errorf("other client error: %v", err)
+	}
+
+	// throttling ends with the window
+	later := now.Add(failureWindow)
+	if workers.blocked("attacker", later) {
+		t.Errorf("client still blocked after window")
+	}
+	if err := workers.authorise("one", "secret", nil, "attacker", later); nil != err {
+		t.Errorf("after window error: %v", err)
+	}
+
+	// no accounts accepts anyone
+	if err := NewWorkers(nil).authorise("any", "", nil, "client", now); nil != err {
+		t.Errorf("open workers error: %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"github.com/bitmark-inc/bitmarkd/background"
 	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/transaction"
@@ -28,11 +29,14 @@ const (
 	bitcoinCurrencyName   = "bitcoin"       // all lowercase currency string
 	bitcoinBlockRange     = 200             // number of blocks to consider as relevant
 	bitcoinConfirmations  = 3               // stop processing this many blocks back from most recent block
-
-	// this is how far back in the bitcoin block chain to star when process begins
-	bitcoinBlockOffset = bitcoinBlockRange + bitcoinConfirmations
 )
 
+// a payment seen before all of its transactions arrived
+type bitcoinDeferred struct {
+	links []transaction.Link
+	total uint64 // Satoshis paid to miners
+}
+
 // globals for background proccess
 type bitcoinData struct {
 	sync.RWMutex // to allow locking
@@ -53,12 +57,19 @@ type bitcoinData struct {
 
 	// payment info
 	minerAddress      string
-	fee               uint64 // value in Satoshis avoid float because of rounding errors
+	fees              *feeTable // values in Satoshis avoid float because of rounding errors
 	latestBlockNumber uint64
 
+	// how far back in the bitcoin block chain to start when process
+	// begins, scaled to the payment expiry time
+	blockOffset uint64
+
 	// for garbage collection
 	expire map[uint64][]transaction.Link
 
+	// payments waiting for their transactions, by block number
+	deferred map[uint64][]bitcoinDeferred
+
 	// for background
 	background *background.T
 
@@ -80,11 +91,11 @@ var bitcoinProcesses = background.Processes{
 // initialise for bitcoin payments
 // also calls the internal initialisePayment() and register()
 //
-// Note fee is a string value and is converted to Satoshis to avoid rounding errors
-func BitcoinInitialise(url string, username string, password string, minerAddress string, fee string, start uint64) error {
+// Note fees are string values and are converted to Satoshis to avoid rounding errors
+func BitcoinInitialise(url string, username string, password string, minerAddress string, fees *FeeSchedule, start uint64) error {
 
 	// ensure payments are initialised
-	if err := paymentInitialise(); nil != err {
+	if err := paymentInitialise(0, 0); nil != err {
 		return err
 	}
 
@@ -106,14 +117,21 @@ func BitcoinInitialise(url string, username string, password string, minerAddres
 	}
 	globalBitcoinData.log.Info("starting…")
 
+	var err error
+
 	globalBitcoinData.id = 0
 	globalBitcoinData.username = username
 	globalBitcoinData.password = password
 	globalBitcoinData.url = url
 	globalBitcoinData.minerAddress = minerAddress
-	globalBitcoinData.fee = convertToSatoshi([]byte(fee))
+	globalBitcoinData.fees, err = newFeeTable(fees, convertToSatoshi)
+	if nil != err {
+		return err
+	}
 	globalBitcoinData.latestBlockNumber = 0
+	globalBitcoinData.blockOffset = scaleToExpiry(bitcoinBlockRange, currentExpiryTime()) + bitcoinConfirmations
 	globalBitcoinData.expire = make(map[uint64][]transaction.Link, bitcoinBlockRange)
+	globalBitcoinData.deferred = make(map[uint64][]bitcoinDeferred)
 
 	globalBitcoinData.client = new(http.Client)
 
@@ -126,7 +144,7 @@ func BitcoinInitialise(url string, username string, password string, minerAddres
 		Version uint64 `json:"version"`
 		Blocks  uint64 `json:"blocks"`
 	}
-	err := bitcoinCall("getinfo", []interface{}{}, &reply)
+	err = bitcoinCall("getinfo", []interface{}{}, &reply)
 	if nil != err {
 		return err
 	}
@@ -150,6 +168,7 @@ func BitcoinInitialise(url string, username string, password string, minerAddres
 	register(bitcoinCurrencyName, &callType{
 		pay:   bitcoinPay,
 		miner: bitcoinAddress,
+		quote: bitcoinQuote,
 	})
 
 	globalBitcoinData.log.Info("about to return")
@@ -255,6 +274,38 @@ func bitcoinAddress() string {
 	return globalBitcoinData.minerAddress
 }
 
+// the fee in Satoshi for a single record
+//
+// zero if bitcoin payments have not been initialised
+func BitcoinFee(record interface{}) uint64 {
+	globalBitcoinData.RLock()
+	defer globalBitcoinData.RUnlock()
+
+	if !globalBitcoinData.initialised {
+		return 0
+	}
+	return globalBitcoinData.fees.recordFee(record)
+}
+
+// to fill in the bitcoin specific parts of a payment quote
+//
+// each payload is a counted "OP_RETURN count=36 txid" output script
+// as accepted by bitcoinValidateTransaction
+func bitcoinQuote(txIds []transaction.Link, quote *CurrencyQuote) {
+	globalBitcoinData.RLock()
+	defer globalBitcoinData.RUnlock()
+
+	fees, total, _ := globalBitcoinData.fees.amounts(txIds)
+
+	quote.Total = convertFromSatoshi(total)
+	quote.Fees = make([]string, len(txIds))
+	quote.Payloads = make([]string, len(txIds))
+	for i, txId := range txIds {
+		quote.Fees[i] = convertFromSatoshi(fees[i])
+		quote.Payloads[i] = "6a24" + txId.PrefixedHex()
+	}
+}
+
 // Payment confirmation functions
 // ------------------------------
 
@@ -265,8 +316,8 @@ func bitcoinPay(payment []byte, count int) error {
 	if err := bitcoinDecodeRawTransaction(payment, &reply); nil != err {
 		return err
 	}
-	links, addresses, ok := bitcoinValidateTransaction(&reply)
-	if !ok {
+	links, addresses, total := bitcoinValidateTransaction(&reply)
+	if ok, _ := bitcoinSufficientFee(links, total); !ok {
 		return fault.ErrInsufficientPayment
 	}
 
@@ -287,11 +338,16 @@ func bitcoinPay(payment []byte, count int) error {
 }
 
 // validate and extract data from a decoded bitcoin transaction
-func bitcoinValidateTransaction(tx *bitcoinTransaction) ([]transaction.Link, []string, bool) {
+//
+// returns:
+//   the linked records
+//   the miner addresses that were paid
+//   total Satoshis paid to those miners
+func bitcoinValidateTransaction(tx *bitcoinTransaction) ([]transaction.Link, []string, uint64) {
 
 	transactionCount := len(tx.Vout)
 	if transactionCount < 1 {
-		return nil, nil, false
+		return nil, nil, 0
 	}
 
 	txIds := make([]transaction.Link, transactionCount)
@@ -346,14 +402,21 @@ func bitcoinValidateTransaction(tx *bitcoinTransaction) ([]transaction.Link, []s
 		}
 	}
 
-	// check sufficient fee
-	expectedFee := globalBitcoinData.fee * uint64(idIndex)
-	feeOk := total >= expectedFee
+	return txIds[0:idIndex], minerAddresses, total
+}
 
-	globalBitcoinData.log.Debugf("total:  BTC %d  expected:  BTC %d  ok: %v", total, expectedFee, feeOk)
+// check sufficient fee for the type of each linked record
+//
+// returns:
+//   true if the total covers the fees
+//   false if any record is not yet known, so the fee is incomplete
+func bitcoinSufficientFee(links []transaction.Link, total uint64) (bool, bool) {
+	_, expectedFee, known := globalBitcoinData.fees.amounts(links)
+	feeOk := total >= expectedFee
 
-	return txIds[0:idIndex], minerAddresses, feeOk
+	globalBitcoinData.log.Debugf("total:  BTC %d  expected:  BTC %d  ok: %v  known: %v", total, expectedFee, feeOk, known)
 
+	return feeOk, known
 }
 
 // low level RPC
@@ -488,25 +551,63 @@ func bitcoinScanBlock(number uint64) error {
 		log.Debugf("  tx data: %v", reply)
 
 		// validate transactiona and extract paid items
-		links, miners, ok := bitcoinValidateTransaction(&reply)
-		if !ok || len(links) < 1 {
+		links, miners, total := bitcoinValidateTransaction(&reply)
+		if len(links) < 1 {
 			continue
 		}
 		log.Debugf("  links: %#v  miners: %#v", links, miners)
 
-		// save for expiry
-		globalBitcoinData.expire[number] = links
-
-		// mark each ID as paid
-		for _, txId := range links {
-			markPaid(txId) // ***** Require miners to be stored? ***
+		// the fee cannot be checked until all records have arrived
+		ok, known := bitcoinSufficientFee(links, total)
+		if !known {
+			log.Infof("  deferred: links: %#v", links)
+			globalBitcoinData.deferred[number] = append(globalBitcoinData.deferred[number], bitcoinDeferred{
+				links: links,
+				total: total,
+			})
+			continue
+		}
+		if !ok {
+			continue
 		}
 
+		bitcoinMarkPaid(number, links)
 	}
 
 	return nil
 }
 
+// check deferred payments again as their records may have arrived
+func bitcoinRetryDeferred(log *logger.L) {
+	for number, payments := range globalBitcoinData.deferred {
+		remaining := payments[:0]
+		for _, p := range payments {
+			ok, known := bitcoinSufficientFee(p.links, p.total)
+			if !known {
+				remaining = append(remaining, p)
+				continue
+			}
+			log.Infof("deferred: links: %#v  ok: %v", p.links, ok)
+			if ok {
+				bitcoinMarkPaid(number, p.links)
+			}
+		}
+		if 0 == len(remaining) {
+			delete(globalBitcoinData.deferred, number)
+		} else {
+			globalBitcoinData.deferred[number] = remaining
+		}
+	}
+}
+
+// mark each ID as paid and save for expiry
+func bitcoinMarkPaid(number uint64, links []transaction.Link) {
+	globalBitcoinData.expire[number] = append(globalBitcoinData.expire[number], links...)
+	for _, txId := range links {
+		markPaid(txId) // ***** Require miners to be stored? ***
+	}
+}
+
 // background to fetch blocks and verify them
 // and save info about paid transactions
 func bitcoinBackground(args interface{}, shutdown <-chan bool, finished chan<- bool) {
@@ -514,9 +615,10 @@ func bitcoinBackground(args interface{}, shutdown <-chan bool, finished chan<- b
 	log := args.(*logger.L)
 
 	// set up the starting block number
+	blockOffset := globalBitcoinData.blockOffset
 	currentBlockNumber := globalBitcoinData.latestBlockNumber
-	if currentBlockNumber > bitcoinBlockOffset {
-		currentBlockNumber -= bitcoinBlockOffset
+	if currentBlockNumber > blockOffset {
+		currentBlockNumber -= blockOffset
 	}
 
 loop:
@@ -575,12 +677,13 @@ loop:
 			}
 
 			// expire old payments records (garbage collection)
-			if currentBlockNumber > bitcoinBlockOffset {
-				n := currentBlockNumber - bitcoinBlockOffset
+			if currentBlockNumber > blockOffset {
+				n := currentBlockNumber - blockOffset
 				if txIds, ok := globalBitcoinData.expire[n]; ok {
 					markExpired(txIds)
 					delete(globalBitcoinData.expire, n)
 				}
+				delete(globalBitcoinData.deferred, n)
 			}
 		}
 
@@ -593,6 +696,8 @@ loop:
 			case <-time.After(bitcoinPollingTime):
 			}
 
+			bitcoinRetryDeferred(log)
+
 			// update the current block number
 			n := bitcoinLatestBlockNumber()
 
@@ -654,3 +759,13 @@ func convertToSatoshi(btc []byte) uint64 {
 
 	return s
 }
+
+// convert a Satoshi value to a string
+//
+// i.e. uint64(1) will convert to "0.00000001"
+//
+// Note: always produces 8 decimal places so that the result
+//       will round trip through convertToSatoshi
+func convertFromSatoshi(satoshi uint64) string {
+	return fmt.Sprintf("%d.%08d", satoshi/100000000, satoshi%100000000)
+}
@@ -55,3 +55,29 @@ func TestStringToSatoshi(t *testing.T) {
 		}
 	}
 }
+
+// check the Satoshi conversion to string
+func TestSatoshiToString(t *testing.T) {
+	tests := []struct {
+		satoshi uint64
+		btc     string
+	}{
+		{0, "0.00000000"},
+		{1, "0.00000001"},
+		{100000000, "1.00000000"},
+		{110000000, "1.10000000"},
+		{100000001, "1.00000001"},
+		{199999999, "1.99999999"},
+		{9999999999999999, "99999999.99999999"},
+	}
+
+	for i, item := range tests {
+		s := convertFromSatoshi(item.satoshi)
+		if item.btc != s {
+			t.Errorf("%d: satoshi: %d → %q  expected: %q", i, item.satoshi, s, item.btc)
+		}
+		if item.satoshi != convertToSatoshi([]byte(s)) {
+			t.Errorf("%d: BTC: %q did not round trip", i, s)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package payment
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fee schedule as configured
+//
+// all values are decimal strings in the usual units of the currency
+// (e.g. BTC) and any empty value uses Default
+//
+// there is no asset fee: an asset record never needs payment and is
+// mined with the first issue of it
+type FeeSchedule struct {
+	Default         string
+	BitmarkIssue    string
+	BitmarkTransfer string
+
+	// volume discounts for issues paid together as "count:percent"
+	// e.g. "10:5" => each issue is 5% cheaper if 10 or more
+	// issues are in the same payment
+	IssueDiscounts []string
+}
+
+// one tier of volume discount
+type discount struct {
+	count   int
+	percent uint64
+}
+
+// the converted fee schedule - all values are in the smallest unit
+// of the currency (e.g. Satoshi)
+type feeTable struct {
+	bitmarkIssue    uint64
+	bitmarkTransfer uint64
+	discounts       []discount // sorted highest count first
+}
+
+// convert a schedule using the currency specific conversion
+func newFeeTable(schedule *FeeSchedule, convert func([]byte) uint64) (*feeTable, error) {
+
+	value := func(s string) uint64 {
+		if "" == s {
+			s = schedule.Default
+		}
+		return convert([]byte(s))
+	}
+
+	table := &feeTable{
+		bitmarkIssue:    value(schedule.BitmarkIssue),
+		bitmarkTransfer: value(schedule.BitmarkTransfer),
+		discounts:       make([]discount, 0, len(schedule.IssueDiscounts)),
+	}
+
+	for _, d := range schedule.IssueDiscounts {
+		parts := strings.Split(d, ":")
+		if 2 != len(parts) {
+			return nil, fault.ErrInvalidDiscount
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if nil != err || count < 2 {
+			return nil, fault.ErrInvalidDiscount
+		}
+		percent, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if nil != err || percent > 100 {
+			return nil, fault.ErrInvalidDiscount
+		}
+		table.discounts = append(table.discounts, discount{
+			count:   count,
+			percent: percent,
+		})
+	}
+
+	sort.Sort(byCount(table.discounts))
+
+	return table, nil
+}
+
+// to sort discounts so the largest tier is first
+type byCount []discount
+
+func (a byCount) Len() int           { return len(a) }
+func (a byCount) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byCount) Less(i, j int) bool { return a[i].count > a[j].count }
+
+// the price of a single issue when count issues are paid together
+func (table *feeTable) issueFee(count int) uint64 {
+	for _, d := range table.discounts {
+		if count >= d.count {
+			return table.bitmarkIssue - table.bitmarkIssue*d.percent/100
+		}
+	}
+	return table.bitmarkIssue
+}
+
+// compute the fee for each of a set of transactions that are to be
+// paid together
+//
+// returns:
+//   fee for each transaction
+//   total of all fees
+//   false if any transaction cannot be found locally
+//
+// a transaction that cannot be found locally is quoted at the highest
+// rate, a batch issue is charged for each bitmark it issues
+func (table *feeTable) amounts(txIds []transaction.Link) ([]uint64, uint64, bool) {
+
+	tags := make([]int, len(txIds))
+	counts := make([]uint64, len(txIds))
+	issues := 0
+	known := true
+	for i, txId := range txIds {
+		tags[i], counts[i] = recordTag(txId)
+		switch tags[i] {
+		case transaction.BitmarkIssueTag:
+			issues += int(counts[i])
+		case transaction.NullTag:
+			known = false
+		}
+	}
+
+	fees := make([]uint64, len(txIds))
+	total := uint64(0)
+	for i, tag := range tags {
+		switch tag {
+		case transaction.AssetDataTag:
+			fees[i] = 0
+		case transaction.BitmarkIssueTag:
+			fees[i] = table.issueFee(issues) * counts[i]
+		case transaction.BitmarkTransferTag:
+			fees[i] = table.bitmarkTransfer
+		default:
+			fees[i] = table.maximum()
+		}
+		total += fees[i]
+	}
+	return fees, total, known
+}
+
+// the fee for a single record
+//
+// used to rank unpaid transactions, so no discount is applied
+func (table *feeTable) recordFee(record interface{}) uint64 {
+	switch tag, count := unpackedTag(record); tag {
+	case transaction.AssetDataTag:
+		return 0
+	case transaction.BitmarkIssueTag:
+		return table.bitmarkIssue * count
+	case transaction.BitmarkTransferTag:
+		return table.bitmarkTransfer
+	default:
+		return table.maximum()
+	}
+}
+
+// the highest single fee
+func (table *feeTable) maximum() uint64 {
+	m := table.bitmarkIssue
+	if table.bitmarkTransfer > m {
+		m = table.bitmarkTransfer
+	}
+	return m
+}
+
+// determine the record type of a transaction
+//
+// returns:
+//   the record type, transaction.NullTag if the record is not available
+//   number of items, only greater than one for a batch issue
+//
+// a batch issue is reported as transaction.BitmarkIssueTag, a burn and
+// a countersigned transfer are charged as a transfer
+func recordTag(txId transaction.Link) (int, uint64) {
+	_, packed, found := txId.Read()
+	if !found {
+		return transaction.NullTag, 1
+	}
+	record, err := packed.Unpack()
+	if nil != err {
+		return transaction.NullTag, 1
+	}
+	return unpackedTag(record)
+}
+
+// determine the record type of an unpacked record
+func unpackedTag(record interface{}) (int, uint64) {
+	switch record.(type) {
+	case *transaction.AssetData:
+		return transaction.AssetDataTag, 1
+	case *transaction.BitmarkIssue:
+		return transaction.BitmarkIssueTag, 1
+	case *transaction.BitmarkBatchIssue:
+		return transaction.BitmarkIssueTag, record.(*transaction.BitmarkBatchIssue).Count
+	case *transaction.BitmarkTransfer, *transaction.BitmarkCountersignedTransfer, *transaction.BitmarkBurn:
+		return transaction.BitmarkTransferTag, 1
+	default:
+		return transaction.NullTag, 1
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package payment
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"testing"
+)
+
+// check the fee schedule conversion
+func TestFeeTable(t *testing.T) {
+	schedule := FeeSchedule{
+		Default:        "0.0002",
+		BitmarkIssue:   "0.0001",
+		IssueDiscounts: []string{"10:5", "100:20"},
+	}
+
+	table, err := newFeeTable(&schedule, convertToSatoshi)
+	if nil != err {
+		t.Fatalf("newFeeTable error: %v", err)
+	}
+
+	if 10000 != table.bitmarkIssue {
+		t.Errorf("issue fee: %d  expected: %d", table.bitmarkIssue, 10000)
+	}
+	if 20000 != table.bitmarkTransfer {
+		t.Errorf("transfer fee: %d  expected: %d", table.bitmarkTransfer, 20000)
+	}
+	if 20000 != table.maximum() {
+		t.Errorf("maximum fee: %d  expected: %d", table.maximum(), 20000)
+	}
+
+	tests := []struct {
+		count int
+		fee   uint64
+	}{
+		{0, 10000},
+		{1, 10000},
+		{9, 10000},
+		{10, 9500},
+		{99, 9500},
+		{100, 8000},
+		{1000, 8000},
+	}
+
+	for i, item := range tests {
+		fee := table.issueFee(item.count)
+		if item.fee != fee {
+			t.Errorf("%d: count: %d → %d  expected: %d", i, item.count, fee, item.fee)
+		}
+	}
+
+	records := []struct {
+		record interface{}
+		fee    uint64
+	}{
+		{&transaction.AssetData{}, 0},
+		{&transaction.BitmarkIssue{}, 10000},
+		{&transaction.BitmarkBatchIssue{Count: 5}, 50000},
+		{&transaction.BitmarkTransfer{}, 20000},
+		{&transaction.BitmarkBurn{}, 20000},
+	}
+
+	for i, item := range records {
+		fee := table.recordFee(item.record)
+		if item.fee != fee {
+			t.Errorf("%d: record: %T → %d  expected: %d", i, item.record, fee, item.fee)
+		}
+	}
+}
+
+// check invalid discounts are rejected
+func TestInvalidDiscount(t *testing.T) {
+	invalid := []string{
+		"",
+		"10",
+		"10:",
+		":5",
+		"1:5",    // no discount for a single item
+		"10:101", // more than 100%
+		"10:-1",
+		"ten:5",
+		"10:5:1",
+	}
+
+	for i, d := range invalid {
+		schedule := FeeSchedule{
+			Default:        "0.0002",
+			IssueDiscounts: []string{d},
+		}
+		_, err := newFeeTable(&schedule, convertToSatoshi)
+		if fault.ErrInvalidDiscount != err {
+			t.Errorf("%d: discount: %q  expected ErrInvalidDiscount but got: %v", i, d, err)
+		}
+	}
+}
@@ -17,11 +17,11 @@ import (
 
 // global constants
 const (
-	paymentVerifyInterval = 2 * time.Minute // block time of currency with lowest block mining time
-	paymentExpiryTime     = 2 * time.Hour   // how long to keep unpaid items
+	paymentVerifyInterval = 2 * time.Minute // default: block time of currency with lowest block mining time
+	paymentExpiryTime     = 2 * time.Hour   // default: how long to keep unpaid items
 	paymentChunkSize      = 100             // maximum transactions to process in one interval
 
-	maximumAddresses         = 60 // keep addresses from this many blocks (2 minutes/block => 2 hours == 2 * record expiry)
+	maximumAddresses         = 60 // keep addresses from this many blocks (2 minutes/block => 2 hours == default record expiry)
 	forkProtection           = 10 // keep this far behind on bitmark block chain
 	currencyAddressSeparator = ":"
 	panicMessage             = "payment module is not initialised"
@@ -30,7 +30,25 @@ const (
 // for currency specific methods
 type callType struct {
 	pay   func(paymentData []byte, count int) error
-	miner func() string // returns string form of address in that currencies usual encoding
+	miner func() string                                        // returns string form of address in that currencies usual encoding
+	quote func(txIds []transaction.Link, quote *CurrencyQuote) // fills in the currency specific fee and payloads
+}
+
+// expiry details of a single transaction in a quote
+type QuoteItem struct {
+	TxId    transaction.Link  `json:"txid"`
+	State   transaction.State `json:"state"`
+	Unpaid  bool              `json:"unpaid"`            // true if included in the payment
+	Expires *time.Time        `json:"expires,omitempty"` // only present for unpaid items
+}
+
+// payment instructions for one currency
+type CurrencyQuote struct {
+	Currency  string   `json:"currency"`
+	Addresses []string `json:"addresses"` // pay the total to any one of these
+	Fees      []string `json:"fees"`      // required fee for each unpaid transaction
+	Total     string   `json:"total"`     // sum of all fees
+	Payloads  []string `json:"payloads"`  // one hex output script for each unpaid transaction
 }
 
 // globals for background proccess
@@ -43,6 +61,10 @@ type paymentData struct {
 	// counter to detect when to finalise
 	nestingLevel int
 
+	// configurable timing
+	expiryTime     time.Duration
+	verifyInterval time.Duration
+
 	// data pools
 	paid map[transaction.Link]struct{}
 
@@ -75,7 +97,10 @@ var paymentProcesses = background.Processes{
 // ------------------------------------------------------------
 
 // all payment methods call this
-func paymentInitialise() error {
+//
+// a zero duration keeps the corresponding default, only the first
+// call sets the timing
+func paymentInitialise(expiry time.Duration, verify time.Duration) error {
 	globalData.Lock()
 	defer globalData.Unlock()
 
@@ -95,11 +120,23 @@ func paymentInitialise() error {
 	// initialise
 	globalData.calls = make(map[string]*callType)
 
+	// timing
+	globalData.expiryTime = paymentExpiryTime
+	if 0 != expiry {
+		globalData.expiryTime = expiry
+	}
+	globalData.verifyInterval = paymentVerifyInterval
+	if 0 != verify {
+		globalData.verifyInterval = verify
+	}
+	globalData.log.Infof("expiry time: %v  verify interval: %v", globalData.expiryTime, globalData.verifyInterval)
+
 	// map of paid transaction ids
 	globalData.paid = make(map[transaction.Link]struct{})
 
-	// initialise the circular buffer of miner addresses
-	globalData.validMiners = newCircular(maximumAddresses)
+	// initialise the circular buffer of miner addresses so that
+	// payments are accepted for the whole expiry time
+	globalData.validMiners = newCircular(int(scaleToExpiry(maximumAddresses, globalData.expiryTime)))
 
 	// all data initialised
 	globalData.initialised = true
@@ -226,9 +263,45 @@ func isPaid(txId transaction.Link) bool {
 	return nil == globalData.currentPaymentAddresses
 }
 
+// scale a count that covers the default expiry time to cover the
+// configured expiry time, never less than the count
+func scaleToExpiry(n uint64, expiry time.Duration) uint64 {
+	if expiry <= paymentExpiryTime {
+		return n
+	}
+	return (n*uint64(expiry) + uint64(paymentExpiryTime) - 1) / uint64(paymentExpiryTime)
+}
+
+// the current expiry time
+func currentExpiryTime() time.Duration {
+	globalData.RLock()
+	defer globalData.RUnlock()
+	return globalData.expiryTime
+}
+
+// the current verify interval
+func currentVerifyInterval() time.Duration {
+	globalData.RLock()
+	defer globalData.RUnlock()
+	return globalData.verifyInterval
+}
+
 // external APIs
 // -------------
 
+// initialise the payment timing
+// must be called before any currency initialise
+//
+// a zero duration keeps the corresponding default
+func Initialise(expiry time.Duration, verify time.Duration) error {
+	return paymentInitialise(expiry, verify)
+}
+
+// finalise - matches Initialise above
+func Finalise() error {
+	return paymentFinalise()
+}
+
 // make a payment - primary payment API
 // detects currency and makes payment
 func Pay(currency string, paymentData []byte, count int) error {
@@ -267,6 +340,72 @@ func MinerAddresses() []block.MinerAddress {
 	return m
 }
 
+// prepare a payment quote for a set of transactions
+//
+// only the Unpaid transactions are included in the payment, the
+// others are just returned with their current state
+func Quote(txIds []transaction.Link) ([]QuoteItem, []CurrencyQuote) {
+
+	globalData.RLock()
+	defer globalData.RUnlock()
+
+	if !globalData.initialised {
+		fault.Panic(panicMessage)
+	}
+
+	items := make([]QuoteItem, len(txIds))
+	unpaid := make([]transaction.Link, 0, len(txIds))
+
+	for i, txId := range txIds {
+		items[i].TxId = txId
+		state, found := txId.State()
+		if !found {
+			items[i].State = transaction.ExpiredTransaction
+			continue
+		}
+		items[i].State = state
+		if transaction.UnpaidTransaction != state {
+			continue
+		}
+		timestamp, found := txId.UnpaidTimestamp()
+		if !found {
+			continue
+		}
+		expires := timestamp.Add(globalData.expiryTime)
+		items[i].Unpaid = true
+		items[i].Expires = &expires
+		unpaid = append(unpaid, txId)
+	}
+
+	if 0 == len(unpaid) {
+		return items, nil
+	}
+
+	quotes := make([]CurrencyQuote, 0, len(globalData.calls))
+	for currency, call := range globalData.calls {
+		quote := CurrencyQuote{
+			Currency: currency,
+		}
+
+		// payee addresses from the recent blocks
+		for _, a := range globalData.currentPaymentAddresses {
+			if currency == strings.ToLower(a.Currency) {
+				quote.Addresses = append(quote.Addresses, a.Address)
+			}
+		}
+
+		// no blocks with addresses yet - so only this node can be paid
+		if 0 == len(quote.Addresses) {
+			quote.Addresses = []string{call.miner()}
+		}
+
+		call.quote(unpaid, &quote)
+		quotes = append(quotes, quote)
+	}
+
+	return items, quotes
+}
+
 // for RPC to get payment addresses - if any
 func PaymentAddresses() []block.MinerAddress {
 
@@ -412,7 +551,7 @@ loop:
 		case <-shutdown:
 			break loop
 
-		case <-time.After(paymentVerifyInterval):
+		case <-time.After(currentVerifyInterval()):
 		}
 
 		log.Info("verify: process")
@@ -431,7 +570,7 @@ loop:
 			}
 
 			// any unpaid tx older that this will be expired
-			expiryTime := time.Now().UTC().Add(-paymentExpiryTime)
+			expiryTime := time.Now().UTC().Add(-currentExpiryTime())
 
 			for _, item := range results {
 				txId := item.Link
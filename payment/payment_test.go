@@ -0,0 +1,34 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package payment
+
+import (
+	"testing"
+	"time"
+)
+
+// check counts are scaled to cover a longer expiry time
+func TestScaleToExpiry(t *testing.T) {
+	tests := []struct {
+		n      uint64
+		expiry time.Duration
+		result uint64
+	}{
+		{maximumAddresses, 0, maximumAddresses},
+		{maximumAddresses, time.Hour, maximumAddresses},
+		{maximumAddresses, paymentExpiryTime, maximumAddresses},
+		{maximumAddresses, 2 * paymentExpiryTime, 2 * maximumAddresses},
+		{maximumAddresses, 24 * time.Hour, 720},
+		{bitcoinBlockRange, 3 * time.Hour, 300},
+		{bitcoinBlockRange, 2*time.Hour + time.Minute, 202},
+	}
+
+	for i, item := range tests {
+		result := scaleToExpiry(item.n, item.expiry)
+		if item.result != result {
+			t.Errorf("%d: %d for %v → %d  expected: %d", i, item.n, item.expiry, result, item.result)
+		}
+	}
+}
@@ -24,8 +24,9 @@ func (peer *peerData) announcer(t *thread) {
 
 	server := peer.server
 
-	// for sending out RPCs
+	// for sending out RPCs and peers
 	rpcCursor := &gnomon.Cursor{}
+	peerCursor := &gnomon.Cursor{}
 
 loop:
 	for {
@@ -34,6 +35,7 @@ loop:
 			break loop
 		case <-time.After(announceTime):
 			t.announceToAll(server, &rpcCursor)
+			t.announcePeers(server, &peerCursor)
 		}
 	}
 
@@ -116,3 +118,35 @@ func (t *thread) announceOne(server *bilateralrpc.Bilateral, recent *announce.Re
 	}
 
 }
+
+// pass on peer listeners
+//
+// only new or re-announced entries are sent as the cursor moves
+// through the pool, so each one is only passed on once
+func (t *thread) announcePeers(server *bilateralrpc.Bilateral, peerCursor **gnomon.Cursor) {
+
+	peers, nextStart, err := announce.RecentPeers(*peerCursor, announceCount, announce.TypePeer)
+	if nil != err {
+		t.log.Errorf("recent peers: error: %v", err)
+		return
+	}
+
+	for _, d := range peers {
+		recent := d.(announce.RecentData)
+		if "" == recent.Data.PublicKey {
+			continue
+		}
+
+		t.log.Infof("announce peer at: %s", recent.Address)
+
+		putArguments := PeerArguments{
+			Address:   recent.Address,
+			PublicKey: recent.Data.PublicKey,
+		}
+		if err := server.Cast(bilateralrpc.SendToAll, "Peer.Put", &putArguments); nil != err {
+			// if remote does not accept it is not really a problem for this node - just warn
+			t.log.Warnf("Peer.Put err = %v", err)
+		}
+	}
+	*peerCursor = nextStart
+}
@@ -29,11 +29,17 @@ func (a ByBlockNumber) Less(i, j int) bool { return a[i].Reply.Number > a[j].Rep
 
 // get the highest block number from peers
 // return it and the peers name
-func highestBlockNumber(server *bilateralrpc.Bilateral, log *logger.L) (uint64, string, bool) {
+func highestBlockNumber(server *bilateralrpc.Bilateral, to []string, log *logger.L) (uint64, string, bool) {
+
+	// an empty list would send to all
+	if 0 == len(to) {
+		log.Infof("highestBlockNumber: no peers")
+		return 0, "", false
+	}
 
 	args := BlockNumberArguments{}
 	var result []BlockNumberResult
-	if err := server.Call(bilateralrpc.SendToAll, "Block.Number", args, &result, 0); nil != err {
+	if err := server.Call(to, "Block.Number", args, &result, 0); nil != err {
 		log.Errorf("highestBlockNumber: err = %v", err)
 		return 0, "", false
 	}
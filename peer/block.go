@@ -8,6 +8,7 @@ import (
 	"github.com/bitmark-inc/bitmarkd/block"
 	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/messagebus"
+	"github.com/bitmark-inc/bitmarkd/transaction"
 	"github.com/bitmark-inc/logger"
 )
 
@@ -88,3 +89,85 @@ func (t *Block) Get(arguments *BlockGetArguments, reply *BlockGetReply) error {
 	reply.Data = data
 	return nil
 }
+
+// ------------------------------------------------------------
+
+// a block sent as its header, coinbase and a short id for each
+// transaction, the receiver finds most transactions in its own
+// pool and only fetches the rest
+type BlockCompactArguments struct {
+	From     string // public key of the sender, to fetch missing transactions from
+	Number   uint64
+	Header   []byte
+	Coinbase []byte
+	ShortIds []uint64
+}
+
+type BlockCompactReply struct {
+}
+
+// new incoming compact block
+func (t *Block) Compact(arguments *BlockCompactArguments, reply *BlockCompactReply) error {
+
+	t.log.Infof("received compact block: %d  transactions: %d  from: %q", arguments.Number, len(arguments.ShortIds), arguments.From)
+
+	if !validPublicKey(arguments.From) {
+		return fault.ErrInvalidPublicKey
+	}
+
+	// only a possible next block is reconstructed
+	if arguments.Number < block.Number() {
+		t.log.Infof("ignore compact block: %d", arguments.Number)
+		return nil
+	}
+
+	messagebus.Send(*arguments)
+	return nil
+}
+
+// ------------------------------------------------------------
+
+type BlockMissingArguments struct {
+	Number  uint64
+	Digest  block.Digest
+	Indexes []int // positions in the block's transaction ids
+}
+
+type BlockMissingReply struct {
+	Transactions [][]byte
+}
+
+// read the transactions of a block that a compact block receiver
+// does not have
+func (t *Block) Missing(arguments *BlockMissingArguments, reply *BlockMissingReply) error {
+
+	packed, found := block.Get(arguments.Number)
+	if !found {
+		return fault.ErrBlockNotFound
+	}
+
+	var blk block.Block
+	err := packed.Unpack(&blk)
+	if nil != err {
+		return err
+	}
+	if arguments.Digest != blk.Digest {
+		return fault.ErrBlockNotFound
+	}
+	if len(arguments.Indexes) > len(blk.TxIds) {
+		return fault.ErrInvalidCount
+	}
+
+	reply.Transactions = make([][]byte, len(arguments.Indexes))
+	for i, index := range arguments.Indexes {
+		if index < 0 || index >= len(blk.TxIds) {
+			return fault.ErrInvalidCount
+		}
+		_, data, found := transaction.Link(blk.TxIds[index]).Read()
+		if !found {
+			return fault.ErrLinkNotFound
+		}
+		reply.Transactions[i] = data
+	}
+	return nil
+}
@@ -47,13 +47,15 @@ loop:
 				break loop
 			default:
 			}
-			if highest, from, ok := highestBlockNumber(server, t.log); ok {
+			// banned peers are not asked
+			to := t.reputation.allowed(server.ActiveConnections(), time.Now())
+			if highest, from, ok := highestBlockNumber(server, to, t.log); ok {
 				t.log.Infof("highest bn = %d  from: %q", highest, from)
 				retries = resynchroniseAttempts
 				n := block.Number() // the number of block being mined
 				if highest >= n {   // equal because we need block 'n' if it is available
 					mode.Set(mode.Resynchronise)
-					t.resynchronise(server, n, highest, []string{from})
+					t.resynchronise(server, n, highest, downloadPeers(from, to))
 					continue getBlocks
 				}
 				if mode.Is(mode.Resynchronise) {
@@ -74,7 +76,7 @@ loop:
 			break getBlocks
 		}
 
-		t.rebroadcastTransactions(server)
+		t.announceTransactions()
 
 	}
 
@@ -83,3 +85,15 @@ loop:
 
 	close(t.done)
 }
+
+// the peers to download from, starting with the one that has the
+// highest block
+func downloadPeers(from string, to []string) []string {
+	peers := []string{from}
+	for _, peer := range to {
+		if peer != from {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
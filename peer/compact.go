@@ -0,0 +1,230 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"github.com/bitmark-inc/bilateralrpc"
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"time"
+)
+
+// various constants
+const (
+	shortIdSize     = 6   // bytes of a short transaction id
+	compactScanSize = 100 // available transactions read at a time
+)
+
+// the short id of a transaction in a compact block
+//
+// derived from the block digest so that transactions with colliding
+// short ids cannot be prepared in advance
+func shortTxId(key block.Digest, txId block.Digest) uint64 {
+	d := block.NewDigest(append(key[:], txId[:]...))
+	id := uint64(0)
+	for i := shortIdSize - 1; i >= 0; i -= 1 {
+		id = id<<8 | uint64(d[i])
+	}
+	return id
+}
+
+// for sending compact blocks
+type BlockCompactResult struct {
+	From  string
+	Reply BlockCompactReply
+	Err   error
+}
+
+// send a saved block to all peers as a compact block
+//
+// a peer that does not accept the compact block (e.g. an older node
+// without Block.Compact) or does not reply is sent the whole block
+// with Block.Put
+func (t *thread) castCompact(server *bilateralrpc.Bilateral, self string, packed block.Packed, blk *block.Block) {
+
+	shortIds := make([]uint64, len(blk.TxIds))
+	for i, txId := range blk.TxIds {
+		shortIds[i] = shortTxId(blk.Digest, txId)
+	}
+
+	arguments := BlockCompactArguments{
+		From:     self,
+		Number:   blk.Number,
+		Header:   packed.Header(),
+		Coinbase: blk.Coinbase,
+		ShortIds: shortIds,
+	}
+	var result []BlockCompactResult
+	if err := server.Call(bilateralrpc.SendToAll, "Block.Compact", &arguments, &result, 0); nil != err {
+		// if remote does not accept it is not really a problem for this node - just warn
+		t.log.Warnf("Block.Compact err = %v", err)
+	}
+
+	accepted := make(map[string]struct{}, len(result))
+	for _, r := range result {
+		if nil == r.Err {
+			accepted[r.From] = struct{}{}
+		}
+	}
+	whole := []string{}
+	for _, peer := range server.ActiveConnections() {
+		if _, found := accepted[peer]; !found {
+			whole = append(whole, peer)
+		}
+	}
+	if 0 == len(whole) {
+		return
+	}
+
+	t.log.Debugf("Block.Put: %d  to: %q", blk.Number, whole)
+
+	blockArguments := BlockPutArguments{
+		Block: []byte(packed),
+	}
+	if err := server.Cast(whole, "Block.Put", &blockArguments); nil != err {
+		// if remote does not accept it is not really a problem for this node - just warn
+		t.log.Warnf("Block.Put err = %v", err)
+	}
+}
+
+// rebuild a block from a compact block
+//
+// transactions are matched against the available pool and the rest
+// are fetched from the sender in one request, if the block cannot
+// be rebuilt the whole block is fetched from the sender
+//
+// the sender cannot be identified, From may name any peer, so no
+// offence is scored against it: the block is only accepted once its
+// merkle root and proof of work are correct
+func (t *thread) reconstruct(server *bilateralrpc.Bilateral, compact *BlockCompactArguments, blk *block.Block) (block.Packed, bool) {
+
+	log := t.log
+
+	if t.reputation.banned(compact.From, time.Now()) {
+		return nil, false
+	}
+
+	packed, err := t.rebuild(server, compact, blk)
+	if nil == err {
+		return packed, true
+	}
+	log.Warnf("compact block: %d  from: %q  error: %v", compact.Number, compact.From, err)
+
+	// fall back to the whole block
+	r := t.fetchBlock(server, compact.From, compact.Number, false)
+	if !r.ok {
+		return nil, false
+	}
+	if err := r.packed.Unpack(blk); nil != err {
+		return nil, false
+	}
+	return r.packed, true
+}
+
+// match the short ids and fetch the missing transactions
+func (t *thread) rebuild(server *bilateralrpc.Bilateral, compact *BlockCompactArguments, blk *block.Block) (block.Packed, error) {
+
+	log := t.log
+
+	header := block.PackedHeader(compact.Header)
+	digest := header.Digest()
+
+	// short ids of the available transactions, an id shared by
+	// more than one is not used
+	local := make(map[uint64]block.Digest)
+	ambiguous := make(map[uint64]struct{})
+	cursor := transaction.NewAvailableCursor()
+	for {
+		txIds := cursor.FetchAvailable(compactScanSize)
+		if 0 == len(txIds) {
+			break
+		}
+		for _, txId := range txIds {
+			id := shortTxId(digest, txId)
+			if _, found := local[id]; found {
+				ambiguous[id] = struct{}{}
+			}
+			local[id] = txId
+		}
+	}
+
+	txIds := make([]block.Digest, len(compact.ShortIds))
+	missing := []int{}
+	for i, id := range compact.ShortIds {
+		txId, found := local[id]
+		if _, duplicate := ambiguous[id]; !found || duplicate {
+			missing = append(missing, i)
+			continue
+		}
+		txIds[i] = txId
+	}
+
+	log.Infof("compact block: %d  transactions: %d  missing: %d", compact.Number, len(txIds), len(missing))
+
+	// fetch the missing ones in one request
+	fetched := make([]transaction.Packed, 0, len(missing))
+	if len(missing) > 0 {
+		arguments := BlockMissingArguments{
+			Number:  compact.Number,
+			Digest:  digest,
+			Indexes: missing,
+		}
+		var result []struct {
+			From  string
+			Reply BlockMissingReply
+			Err   error
+		}
+		if err := server.Call([]string{compact.From}, "Block.Missing", &arguments, &result, 0); nil != err {
+			return nil, err
+		}
+		if 0 == len(result) {
+			return nil, fault.ErrBlockNotFound
+		}
+		if nil != result[0].Err {
+			return nil, result[0].Err
+		}
+		if len(missing) != len(result[0].Reply.Transactions) {
+			return nil, fault.ErrInvalidCount
+		}
+
+		for i, data := range result[0].Reply.Transactions {
+			packedTransaction := transaction.Packed(data)
+			if _, err := packedTransaction.Unpack(); nil != err {
+				return nil, err
+			}
+			index := missing[i]
+			txIds[index] = block.Digest(packedTransaction.MakeLink())
+			if compact.ShortIds[index] != shortTxId(digest, txIds[index]) {
+				return nil, fault.ErrInvalidBlock
+			}
+			fetched = append(fetched, packedTransaction)
+		}
+	}
+
+	// the merkle root and proof of work are checked before anything
+	// is written
+	packed, err := block.NewPacked(header, compact.Coinbase, txIds)
+	if nil != err {
+		return nil, err
+	}
+	if err := packed.Unpack(blk); nil != err {
+		return nil, err
+	}
+	if compact.Number != blk.Number {
+		return nil, fault.ErrInvalidBlock
+	}
+
+	for _, packedTransaction := range fetched {
+		var txId transaction.Link
+		switch err := packedTransaction.WriteMined(&txId); err {
+		case nil, fault.ErrTransactionAlreadyExists:
+		default:
+			return nil, err
+		}
+	}
+
+	return packed, nil
+}
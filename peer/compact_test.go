@@ -0,0 +1,37 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"github.com/bitmark-inc/bitmarkd/block"
+	"testing"
+)
+
+// test short ids fit their size and depend on the block
+func TestShortTxId(t *testing.T) {
+
+	key1 := block.NewDigest([]byte("block one"))
+	key2 := block.NewDigest([]byte("block two"))
+
+	seen := make(map[uint64]int)
+	for n := 0; n < 1000; n += 1 {
+		txId := block.Digest(testTxId(n))
+
+		id := shortTxId(key1, txId)
+		if id >= 1<<(8*shortIdSize) {
+			t.Fatalf("%d: short id: %x  exceeds %d bytes", n, id, shortIdSize)
+		}
+		if id != shortTxId(key1, txId) {
+			t.Fatalf("%d: short id not repeatable", n)
+		}
+		if id == shortTxId(key2, txId) {
+			t.Errorf("%d: short id: %x  same for different blocks", n, id)
+		}
+		if previous, found := seen[id]; found {
+			t.Errorf("%d: short id: %x  same as: %d", n, id, previous)
+		}
+		seen[id] = n
+	}
+}
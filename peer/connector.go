@@ -0,0 +1,265 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"github.com/bitmark-inc/bilateralrpc"
+	"github.com/bitmark-inc/bitmarkd/announce"
+	"github.com/bitmark-inc/bitmarkd/gnomon"
+	"sync"
+	"time"
+)
+
+// various constants
+const (
+	initialConnectDelay = 10 * time.Second
+	connectTime         = 1 * time.Minute // interval between checks for more peers
+	connectGrace        = 2 * time.Minute // time for a new connection to become active
+	redialDelay         = 1 * time.Hour   // before trying a peer that did not become active
+	discoverCount       = 50              // peers read from the pool or requested from neighbours
+)
+
+// a remote peer listener
+type Remote struct {
+	PublicKey string
+	Address   string
+}
+
+// peers this node has connected to
+type outgoing struct {
+	sync.Mutex
+	dialled map[string]time.Time // public key -> time of connection
+
+	// public key -> address, until the connection becomes active
+	pending map[string]string
+}
+
+// record a connection
+func (o *outgoing) add(publicKey string, address string, now time.Time) {
+	o.Lock()
+	defer o.Unlock()
+	o.dialled[publicKey] = now
+	o.pending[publicKey] = address
+}
+
+// the addresses of connections that did not become active within
+// the grace time, each is only returned once
+func (o *outgoing) failed(active map[string]struct{}, now time.Time) map[string]string {
+	o.Lock()
+	defer o.Unlock()
+
+	result := make(map[string]string)
+	for publicKey, address := range o.pending {
+		if _, ok := active[publicKey]; ok {
+			delete(o.pending, publicKey)
+		} else if now.Sub(o.dialled[publicKey]) >= connectGrace {
+			result[publicKey] = address
+			delete(o.pending, publicKey)
+		}
+	}
+	return result
+}
+
+// number of connections that are active or still connecting
+func (o *outgoing) count(active map[string]struct{}, now time.Time) int {
+	o.Lock()
+	defer o.Unlock()
+
+	n := 0
+	for publicKey, dialled := range o.dialled {
+		if _, ok := active[publicKey]; ok || now.Sub(dialled) < connectGrace {
+			n += 1
+		}
+	}
+	return n
+}
+
+// true if a peer may be dialled
+func (o *outgoing) wanted(publicKey string, now time.Time) bool {
+	o.Lock()
+	defer o.Unlock()
+
+	dialled, found := o.dialled[publicKey]
+	return !found || now.Sub(dialled) >= redialDelay
+}
+
+// set the outgoing connection limit and the peers to connect to
+// when no others are known
+//
+// must be called before Initialise
+func SetDiscovery(remotes int, seeds []Remote) {
+	globalData.Lock()
+	defer globalData.Unlock()
+
+	globalData.remotes = remotes
+	globalData.seeds = seeds
+}
+
+// loop to make outgoing connections
+func (peer *peerData) connector(t *thread) {
+
+	t.log.Info("starting…")
+
+	server := peer.server
+
+	// position in the peer pool
+	cursor := &gnomon.Cursor{}
+
+	delay := initialConnectDelay
+loop:
+	for {
+		select {
+		case <-t.stop:
+			break loop
+		case <-time.After(delay):
+			delay = connectTime
+			t.connectMore(server, peer, &cursor)
+		}
+	}
+
+	t.log.Info("shutting down…")
+	t.log.Flush()
+
+	close(t.done)
+}
+
+// dial more peers if below the limit
+func (t *thread) connectMore(server *bilateralrpc.Bilateral, peer *peerData, cursor **gnomon.Cursor) {
+
+	now := time.Now()
+
+	active := make(map[string]struct{})
+	for _, publicKey := range server.ActiveConnections() {
+		active[publicKey] = struct{}{}
+	}
+
+	// so that the address can be announced again with another key
+	for publicKey, address := range peer.outgoing.failed(active, now) {
+		t.forgetPeer(address, publicKey)
+	}
+
+	wanted := peer.remotes - peer.outgoing.count(active, now)
+	if wanted <= 0 {
+		return
+	}
+
+	// learn of more peers from the neighbours
+	if len(active) > 0 {
+		t.requestPeers(server, peer.publicKey)
+	}
+
+	// the seeds are only used when no other peer can be dialled
+	remotes := t.candidates(peer, cursor, active, now)
+	if 0 == len(remotes) {
+		for _, r := range peer.seeds {
+			if _, ok := active[r.PublicKey]; !ok && peer.outgoing.wanted(r.PublicKey, now) {
+				remotes = append(remotes, r)
+			}
+		}
+	}
+
+	for _, r := range remotes {
+		if wanted <= 0 {
+			break
+		}
+		if t.reputation.banned(r.PublicKey, now) {
+			continue
+		}
+		if err := server.ConnectTo(r.PublicKey, "tcp://"+r.Address); nil != err {
+			t.log.Warnf("connect to: %q  at: %s  error: %v", r.PublicKey, r.Address, err)
+			continue
+		}
+		t.log.Infof("connected to: %q  at: %s", r.PublicKey, r.Address)
+		peer.outgoing.add(r.PublicKey, r.Address, now)
+		wanted -= 1
+	}
+}
+
+// remove the announcement of a peer that could not be connected to,
+// unless the address has already been announced with another key
+func (t *thread) forgetPeer(address string, publicKey string) {
+	data, err := announce.GetPeer(address, announce.TypePeer)
+	if nil != err || publicKey != data.PublicKey {
+		return
+	}
+	if _, err := announce.RemovePeer(address, announce.TypePeer); nil != err {
+		t.log.Errorf("remove peer: %q  at: %s  error: %v", publicKey, address, err)
+		return
+	}
+	t.log.Infof("not active, removed peer: %q  at: %s", publicKey, address)
+}
+
+// ask the neighbours for the peers they know
+func (t *thread) requestPeers(server *bilateralrpc.Bilateral, self string) {
+
+	arguments := NeighbourArguments{
+		Count: discoverCount,
+	}
+	var result []struct {
+		From  string
+		Reply NeighbourReply
+		Err   error
+	}
+	if err := server.Call(bilateralrpc.SendToAll, "Peer.List", &arguments, &result, 0); nil != err {
+		t.log.Warnf("Peer.List err = %v", err)
+		return
+	}
+
+	for _, r := range result {
+		if nil != r.Err {
+			continue
+		}
+		for _, p := range r.Reply.Peers {
+			if nil == p.Data {
+				continue
+			}
+			if _, err := addPeer(p.Address, p.Data.PublicKey, self); nil != err {
+				t.log.Debugf("peer from: %q  address: %q  error: %v", r.From, p.Address, err)
+			}
+		}
+	}
+}
+
+// read the next peers from the pool that are not connected
+//
+// the pool is read in turn, starting again at the oldest
+// announcement after the newest has been read
+func (t *thread) candidates(peer *peerData, cursor **gnomon.Cursor, active map[string]struct{}, now time.Time) []Remote {
+
+	peers, nextStart, err := announce.RecentPeers(*cursor, discoverCount, announce.TypePeer)
+	if nil != err {
+		t.log.Errorf("recent peers: error: %v", err)
+		return nil
+	}
+	if len(peers) < discoverCount {
+		*cursor = &gnomon.Cursor{}
+	} else {
+		*cursor = nextStart
+	}
+
+	remotes := []Remote{}
+	seen := make(map[string]struct{})
+	for _, d := range peers {
+		recent := d.(announce.RecentData)
+		publicKey := recent.Data.PublicKey
+		if "" == publicKey || peer.publicKey == publicKey {
+			continue
+		}
+		if _, ok := active[publicKey]; ok {
+			continue
+		}
+		if _, ok := seen[publicKey]; ok {
+			continue
+		}
+		seen[publicKey] = struct{}{}
+		if peer.outgoing.wanted(publicKey, now) {
+			remotes = append(remotes, Remote{
+				PublicKey: publicKey,
+				Address:   recent.Address,
+			})
+		}
+	}
+	return remotes
+}
@@ -6,4 +6,9 @@
 //
 // This used RPC to send message to connected peers using the
 // bilateralrpc module.
+//
+// Peers are scored for invalid blocks, bad transactions and timeouts
+// in replies to requests made by this node and are banned when the
+// score reaches a threshold.  Incoming requests are not rate limited
+// for each peer, as the caller of a service method is not known.
 package peer
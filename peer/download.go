@@ -0,0 +1,193 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"time"
+)
+
+// limits for the block download
+const (
+	downloadWindow  = 64               // blocks ahead of the next block to be applied that may be requested
+	requestsPerPeer = 2                // outstanding requests to one peer
+	stallTimeout    = 15 * time.Second // time before a request is also sent to another peer
+)
+
+// a block number to be requested from a peer
+type blockRequest struct {
+	peer   string
+	number uint64
+}
+
+// the state of one block in the window
+type pendingBlock struct {
+	requested time.Time           // time of the latest request
+	asked     map[string]struct{} // peers with a request outstanding
+	tried     map[string]struct{} // peers that failed to supply it
+	received  bool
+}
+
+// decides which peer to ask for each block
+//
+// blocks are requested in a window starting at the next block to be
+// applied so that all peers are busy while blocks are applied in
+// order, a block that has not arrived by stallTimeout is also
+// requested from another peer and a block that no peer can supply
+// ends the download
+type downloadScheduler struct {
+	peers   []string
+	busy    map[string]int
+	blocks  map[uint64]*pendingBlock
+	next    uint64 // the next block to be applied
+	highest uint64 // the last block to request
+}
+
+// create a scheduler for blocks next…highest
+func newDownloadScheduler(peers []string, next uint64, highest uint64) *downloadScheduler {
+	return &downloadScheduler{
+		peers:   peers,
+		busy:    make(map[string]int),
+		blocks:  make(map[uint64]*pendingBlock),
+		next:    next,
+		highest: highest,
+	}
+}
+
+// the requests to send now
+//
+// peers for which allowed returns false are not used
+func (s *downloadScheduler) assign(now time.Time, allowed func(peer string) bool) []blockRequest {
+
+	requests := []blockRequest{}
+
+	last := s.next + downloadWindow - 1
+	if last > s.highest {
+		last = s.highest
+	}
+
+	for n := s.next; n <= last; n += 1 {
+		b := s.blocks[n]
+		if nil == b {
+			b = &pendingBlock{
+				asked: make(map[string]struct{}),
+				tried: make(map[string]struct{}),
+			}
+			s.blocks[n] = b
+		}
+		if b.received {
+			continue
+		}
+
+		// only repeat a request when the previous one has stalled
+		if len(b.asked) > 0 && now.Sub(b.requested) < stallTimeout {
+			continue
+		}
+
+		peer, ok := s.choose(b, allowed)
+		if !ok {
+			continue
+		}
+		s.busy[peer] += 1
+		b.asked[peer] = struct{}{}
+		b.requested = now
+		requests = append(requests, blockRequest{
+			peer:   peer,
+			number: n,
+		})
+	}
+	return requests
+}
+
+// pick the least busy peer that has not already been asked for this block
+func (s *downloadScheduler) choose(b *pendingBlock, allowed func(peer string) bool) (string, bool) {
+	best := ""
+	found := false
+	for _, peer := range s.peers {
+		if _, failed := b.tried[peer]; failed {
+			continue
+		}
+		if _, waiting := b.asked[peer]; waiting {
+			continue
+		}
+		if s.busy[peer] >= requestsPerPeer || !allowed(peer) {
+			continue
+		}
+		if !found || s.busy[peer] < s.busy[best] {
+			best = peer
+			found = true
+		}
+	}
+	return best, found
+}
+
+// record the response to a request
+//
+// returns true if the block is wanted, false if it was already
+// received or is no longer in the window
+func (s *downloadScheduler) completed(peer string, number uint64, ok bool) bool {
+
+	if s.busy[peer] > 0 {
+		s.busy[peer] -= 1
+	}
+
+	b := s.blocks[number]
+	if nil == b {
+		return false
+	}
+	delete(b.asked, peer)
+	if !ok {
+		b.tried[peer] = struct{}{}
+		return false
+	}
+	if b.received {
+		return false
+	}
+	b.received = true
+	return true
+}
+
+// the next block was applied
+func (s *downloadScheduler) applied() {
+	delete(s.blocks, s.next)
+	s.next += 1
+}
+
+// request a received block again
+func (s *downloadScheduler) discard(number uint64) {
+	if b := s.blocks[number]; nil != b {
+		b.received = false
+	}
+}
+
+// step back to replace the block before the next one
+func (s *downloadScheduler) back() {
+	if s.next > 1 {
+		s.next -= 1
+	}
+}
+
+// true if no peer can supply the next block
+func (s *downloadScheduler) exhausted(allowed func(peer string) bool) bool {
+	b := s.blocks[s.next]
+	if nil != b && (b.received || len(b.asked) > 0) {
+		return false
+	}
+	for _, peer := range s.peers {
+		if nil != b {
+			if _, failed := b.tried[peer]; failed {
+				continue
+			}
+		}
+		if allowed(peer) {
+			return false
+		}
+	}
+	return true
+}
+
+// true when all blocks are applied
+func (s *downloadScheduler) finished() bool {
+	return s.next > s.highest
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+func allowAll(peer string) bool { return true }
+
+// test requests are spread over the peers and limited by the window
+func TestDownloadAssign(t *testing.T) {
+
+	now := time.Now()
+	peers := []string{"a", "b", "c"}
+	s := newDownloadScheduler(peers, 10, 10+2*downloadWindow)
+
+	requests := s.assign(now, allowAll)
+	if len(peers)*requestsPerPeer != len(requests) {
+		t.Fatalf("requests: %d  expected: %d", len(requests), len(peers)*requestsPerPeer)
+	}
+	count := make(map[string]int)
+	for i, r := range requests {
+		if uint64(10+i) != r.number {
+			t.Errorf("%d: number: %d  expected: %d", i, r.number, 10+i)
+		}
+		count[r.peer] += 1
+	}
+	for _, peer := range peers {
+		if requestsPerPeer != count[peer] {
+			t.Errorf("peer: %q  requests: %d  expected: %d", peer, count[peer], requestsPerPeer)
+		}
+	}
+
+	// all peers busy
+	if n := len(s.assign(now, allowAll)); 0 != n {
+		t.Errorf("requests: %d  while all peers busy", n)
+	}
+
+	// a response frees the peer for the next block
+	r := requests[0]
+	if !s.completed(r.peer, r.number, true) {
+		t.Errorf("block: %d  not wanted", r.number)
+	}
+	more := s.assign(now, allowAll)
+	if 1 != len(more) || r.peer != more[0].peer || uint64(10+len(requests)) != more[0].number {
+		t.Errorf("requests: %v  expected: one from: %q", more, r.peer)
+	}
+
+	// never beyond the highest block
+	s = newDownloadScheduler(peers, 10, 11)
+	if n := len(s.assign(now, allowAll)); 2 != n {
+		t.Errorf("requests: %d  expected: 2", n)
+	}
+}
+
+// test a failed or stalled block is requested from another peer
+func TestDownloadRetry(t *testing.T) {
+
+	now := time.Now()
+	s := newDownloadScheduler([]string{"a", "b"}, 1, 1)
+
+	requests := s.assign(now, allowAll)
+	if 1 != len(requests) || "a" != requests[0].peer {
+		t.Fatalf("requests: %v  expected: one from: a", requests)
+	}
+
+	// not repeated until stalled
+	if n := len(s.assign(now.Add(stallTimeout/2), allowAll)); 0 != n {
+		t.Fatalf("requests: %d  before stall", n)
+	}
+	requests = s.assign(now.Add(stallTimeout), allowAll)
+	if 1 != len(requests) || "b" != requests[0].peer {
+		t.Fatalf("requests: %v  expected: one from: b", requests)
+	}
+
+	// both fail so no peer can supply it
+	s.completed("b", 1, false)
+	if s.exhausted(allowAll) {
+		t.Errorf("exhausted while request outstanding")
+	}
+	s.completed("a", 1, false)
+	if !s.exhausted(allowAll) {
+		t.Errorf("not exhausted after all peers failed")
+	}
+
+	// the response to a stalled request is not wanted twice
+	s = newDownloadScheduler([]string{"a", "b"}, 1, 1)
+	s.assign(now, allowAll)
+	s.assign(now.Add(stallTimeout), allowAll)
+	if !s.completed("b", 1, true) {
+		t.Errorf("first response not wanted")
+	}
+	if s.completed("a", 1, true) {
+		t.Errorf("second response wanted")
+	}
+
+	// a banned peer is not asked
+	s = newDownloadScheduler([]string{"a", "b"}, 1, 1)
+	notA := func(peer string) bool { return "a" != peer }
+	requests = s.assign(now, notA)
+	if 1 != len(requests) || "b" != requests[0].peer {
+		t.Fatalf("requests: %v  expected: one from: b", requests)
+	}
+	s.completed("b", 1, false)
+	if !s.exhausted(notA) {
+		t.Errorf("not exhausted with only a banned peer left")
+	}
+}
+
+// test applying, discarding and stepping back
+func TestDownloadApply(t *testing.T) {
+
+	now := time.Now()
+	s := newDownloadScheduler([]string{"a"}, 5, 6)
+
+	s.assign(now, allowAll)
+	s.completed("a", 5, true)
+	s.completed("a", 6, true)
+
+	// fork: block 5 is fetched again after block 4
+	s.discard(5)
+	s.back()
+	requests := s.assign(now, allowAll)
+	if 2 != len(requests) || 4 != requests[0].number || 5 != requests[1].number {
+		t.Fatalf("requests: %v  expected: 4 and 5", requests)
+	}
+	s.completed("a", 4, true)
+	s.completed("a", 5, true)
+
+	for n := uint64(4); n <= 6; n += 1 {
+		if s.finished() {
+			t.Fatalf("finished before block: %d", n)
+		}
+		s.applied()
+	}
+	if !s.finished() {
+		t.Errorf("not finished")
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"fmt" // ***** DEBUG: IPv6 listen on fails ***** see printf below
 	"github.com/bitmark-inc/bilateralrpc"
 	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/pool"
 	"github.com/bitmark-inc/logger"
 	"sync"
+	"time"
 )
 
 // globals for background proccess
@@ -26,24 +28,40 @@ type peerData struct {
 	//background *background.T
 	threads []*thread
 
+	// misbehaviour scores and bans
+	reputation *reputation
+
+	// transactions known to each peer
+	inventory *inventory
+
+	// for discovery of peers
+	publicKey string   // of this node
+	remotes   int      // maximum outgoing connections
+	seeds     []Remote // dialled when no peers are known
+	outgoing  outgoing
+
 	// set once during initialise
 	initialised bool
 }
 
 // local threads
 type thread struct {
-	name    string
-	log     *logger.L
-	stop    chan bool
-	done    chan bool
-	handler func(*thread)
+	name       string
+	log        *logger.L
+	stop       chan bool
+	done       chan bool
+	handler    func(*thread)
+	reputation *reputation
+	inventory  *inventory
 }
 
 // global data
 var globalData peerData
 
 // start up the peer communications system
-func Initialise(addresses []string, networkName string, publicKey string, privateKey string) error {
+//
+// peers that misbehave are banned for banDuration
+func Initialise(addresses []string, networkName string, publicKey string, privateKey string, banDuration time.Duration) error {
 
 	globalData.Lock()
 	defer globalData.Unlock()
@@ -57,13 +75,23 @@ func Initialise(addresses []string, networkName string, publicKey string, privat
 		{name: "client", handler: globalData.client},
 		{name: "responder", handler: globalData.responder},
 		{name: "announcer", handler: globalData.announcer},
+		{name: "connector", handler: globalData.connector},
+		{name: "relay", handler: globalData.relay},
 	}
 
+	globalData.publicKey = publicKey
+	globalData.outgoing.dialled = make(map[string]time.Time)
+	globalData.outgoing.pending = make(map[string]string)
+
 	log := logger.New("peer")
 	if nil == log {
 		return fault.ErrInvalidLoggerChannel
 	}
 
+	// restore saved bans
+	globalData.reputation = newReputation(log, banDuration, pool.New(pool.PeerBans, banCacheSize), time.Now())
+	globalData.inventory = newInventory()
+
 	for _, t := range globalData.threads {
 
 		t.log = logger.New(t.name)
@@ -72,6 +100,8 @@ func Initialise(addresses []string, networkName string, publicKey string, privat
 		}
 		t.stop = make(chan bool)
 		t.done = make(chan bool)
+		t.reputation = globalData.reputation
+		t.inventory = globalData.inventory
 	}
 
 	// create the server
@@ -91,10 +121,10 @@ func Initialise(addresses []string, networkName string, publicKey string, privat
 	// register server objects
 	// -----------------------
 
-	// not yet....see below....
-	// peer := &Peer{
-	// 	log: log,
-	// }
+	peer := &Peer{
+		log:       log,
+		publicKey: publicKey,
+	}
 
 	rpcs := &RPCs{
 		log: log,
@@ -113,10 +143,11 @@ func Initialise(addresses []string, networkName string, publicKey string, privat
 	}
 
 	transaction := &Transaction{
-		log: log,
+		log:       log,
+		inventory: globalData.inventory,
 	}
 
-	//globalData.server.Register(peer) // need some fixes first
+	globalData.server.Register(peer)
 	globalData.server.Register(rpcs)
 	globalData.server.Register(cert)
 	globalData.server.Register(asset)
@@ -143,7 +174,15 @@ func ConnectTo(publicKey string, address string) error {
 		return fault.ErrNotInitialised
 	}
 
-	return globalData.server.ConnectTo(publicKey, "tcp://"+address)
+	if globalData.reputation.banned(publicKey, time.Now()) {
+		return fault.ErrPeerBanned
+	}
+
+	err := globalData.server.ConnectTo(publicKey, "tcp://"+address)
+	if nil == err {
+		globalData.outgoing.add(publicKey, address, time.Now())
+	}
+	return err
 }
 
 // finialise - stop all background tasks
@@ -0,0 +1,299 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"github.com/bitmark-inc/bilateralrpc"
+	"github.com/bitmark-inc/bitmarkd/messagebus"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"sync"
+	"time"
+)
+
+// various constants
+const (
+	inventoryInterval  = time.Second // maximum delay before new transactions are announced
+	inventoryBatchSize = 100         // maximum transaction ids in one announcement
+	inventoryQueueSize = 1000        // new transactions waiting to be announced
+	knownInventorySize = 5000        // transaction ids remembered for each peer
+	wantedQueueSize    = 1000        // transactions waiting to be fetched
+	inventoryFetchers  = 4           // transactions fetched at the same time
+	inventoryRetryTime = time.Minute // before a transaction is requested again
+)
+
+// a transaction to fetch from the peer that announced it
+type wantedTransaction struct {
+	peer string
+	txId transaction.Link
+}
+
+// transaction inventory shared by the relay thread and the
+// Transaction service
+type inventory struct {
+	sync.Mutex
+	known     map[string]*knownSet           // peer -> transactions it has
+	requested map[transaction.Link]time.Time // transactions being fetched
+	queue     chan transaction.Link          // to be announced
+	wanted    chan wantedTransaction         // to be fetched
+}
+
+// create an empty inventory
+func newInventory() *inventory {
+	return &inventory{
+		known:     make(map[string]*knownSet),
+		requested: make(map[transaction.Link]time.Time),
+		queue:     make(chan transaction.Link, inventoryQueueSize),
+		wanted:    make(chan wantedTransaction, wantedQueueSize),
+	}
+}
+
+// queue a transaction to be announced to the peers
+//
+// never blocks, a transaction that does not fit in the queue will
+// be announced with the next announcement of all available
+// transactions
+func (inv *inventory) add(txId transaction.Link) bool {
+	select {
+	case inv.queue <- txId:
+		return true
+	default:
+		return false
+	}
+}
+
+// record transactions that a peer has
+func (inv *inventory) markKnown(peer string, txIds []transaction.Link) {
+	inv.Lock()
+	defer inv.Unlock()
+
+	inv.peerSet(peer).add(txIds...)
+}
+
+// the transactions that a peer does not have, which are then
+// recorded as known to it
+func (inv *inventory) unknown(peer string, txIds []transaction.Link) []transaction.Link {
+	inv.Lock()
+	defer inv.Unlock()
+
+	s := inv.peerSet(peer)
+	result := make([]transaction.Link, 0, len(txIds))
+	for _, txId := range txIds {
+		if !s.has(txId) {
+			s.add(txId)
+			result = append(result, txId)
+		}
+	}
+	return result
+}
+
+// only call while locked
+func (inv *inventory) peerSet(peer string) *knownSet {
+	s, found := inv.known[peer]
+	if !found {
+		s = newKnownSet(knownInventorySize)
+		inv.known[peer] = s
+	}
+	return s
+}
+
+// forget peers that are no longer connected
+func (inv *inventory) prune(active []string) {
+	inv.Lock()
+	defer inv.Unlock()
+
+	current := make(map[string]struct{}, len(active))
+	for _, peer := range active {
+		current[peer] = struct{}{}
+	}
+	for peer := range inv.known {
+		if _, found := current[peer]; !found {
+			delete(inv.known, peer)
+		}
+	}
+}
+
+// queue a transaction to be fetched unless already requested
+//
+// returns true if it was queued
+func (inv *inventory) request(peer string, txId transaction.Link, now time.Time) bool {
+	inv.Lock()
+	defer inv.Unlock()
+
+	if requested, found := inv.requested[txId]; found && now.Sub(requested) < inventoryRetryTime {
+		return false
+	}
+
+	// discard old requests
+	if len(inv.requested) >= wantedQueueSize {
+		for id, requested := range inv.requested {
+			if now.Sub(requested) >= inventoryRetryTime {
+				delete(inv.requested, id)
+			}
+		}
+	}
+
+	select {
+	case inv.wanted <- wantedTransaction{peer: peer, txId: txId}:
+		inv.requested[txId] = now
+		return true
+	default:
+		return false
+	}
+}
+
+// a fetch failed so the transaction can be requested from the next
+// peer that announces it
+func (inv *inventory) failed(txId transaction.Link) {
+	inv.Lock()
+	defer inv.Unlock()
+
+	delete(inv.requested, txId)
+}
+
+// a set of transaction ids that forgets the oldest when full
+type knownSet struct {
+	ids   map[transaction.Link]struct{}
+	order []transaction.Link // circular buffer of the ids in the order added
+	next  int
+}
+
+func newKnownSet(size int) *knownSet {
+	return &knownSet{
+		ids:   make(map[transaction.Link]struct{}, size),
+		order: make([]transaction.Link, 0, size),
+	}
+}
+
+func (s *knownSet) has(txId transaction.Link) bool {
+	_, found := s.ids[txId]
+	return found
+}
+
+func (s *knownSet) add(txIds ...transaction.Link) {
+	for _, txId := range txIds {
+		if s.has(txId) {
+			continue
+		}
+		if len(s.order) < cap(s.order) {
+			s.order = append(s.order, txId)
+		} else {
+			delete(s.ids, s.order[s.next])
+			s.order[s.next] = txId
+			s.next = (s.next + 1) % len(s.order)
+		}
+		s.ids[txId] = struct{}{}
+	}
+}
+
+// loop to announce and fetch transactions
+func (peer *peerData) relay(t *thread) {
+
+	t.log.Info("starting…")
+
+	server := peer.server
+	inv := peer.inventory
+
+	// fetch wanted transactions
+	wg := sync.WaitGroup{}
+	for i := 0; i < inventoryFetchers; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-t.stop:
+					return
+				case w := <-inv.wanted:
+					t.fetchWanted(server, w)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(inventoryInterval)
+	defer ticker.Stop()
+
+	pending := make([]transaction.Link, 0, inventoryBatchSize)
+loop:
+	for {
+		select {
+		case <-t.stop:
+			break loop
+		case txId := <-inv.queue:
+			pending = append(pending, txId)
+			if len(pending) < inventoryBatchSize {
+				continue loop
+			}
+		case <-ticker.C:
+			if 0 == len(pending) {
+				continue loop
+			}
+		}
+		t.announceInventory(server, peer.publicKey, pending)
+		pending = pending[:0]
+	}
+
+	wg.Wait()
+
+	t.log.Info("shutting down…")
+	t.log.Flush()
+
+	close(t.done)
+}
+
+// send each peer the transaction ids it does not have
+func (t *thread) announceInventory(server *bilateralrpc.Bilateral, self string, txIds []transaction.Link) {
+
+	active := server.ActiveConnections()
+	t.inventory.prune(active)
+
+	for _, peer := range t.reputation.allowed(active, time.Now()) {
+		ids := t.inventory.unknown(peer, txIds)
+		if 0 == len(ids) {
+			continue
+		}
+
+		t.log.Debugf("inventory: %d  to: %q", len(ids), peer)
+
+		arguments := TransactionInventoryArguments{
+			From:  self,
+			TxIds: ids,
+		}
+		if err := server.Cast([]string{peer}, "Transaction.Inventory", &arguments); nil != err {
+			// if remote does not accept it is not really a problem for this node - just warn
+			t.log.Warnf("Transaction.Inventory err = %v", err)
+		}
+	}
+}
+
+// fetch an announced transaction and process it like one that was put
+func (t *thread) fetchWanted(server *bilateralrpc.Bilateral, w wantedTransaction) {
+
+	if _, found := w.txId.State(); found {
+		return
+	}
+	if t.reputation.banned(w.peer, time.Now()) {
+		t.inventory.failed(w.txId)
+		return
+	}
+
+	// the peer is only named by the inventory From field so it is
+	// not scored for a bad reply
+	packedTransaction, ok := t.getTransaction(server, w.peer, w.txId, false)
+	if !ok {
+		t.inventory.failed(w.txId)
+		return
+	}
+	if w.txId != packedTransaction.MakeLink() {
+		t.log.Errorf("txid: %#v changed to: %#v", w.txId, packedTransaction.MakeLink())
+		t.inventory.failed(w.txId)
+		return
+	}
+
+	// it is now certain that the peer has it, so do not announce it back
+	t.inventory.markKnown(w.peer, []transaction.Link{w.txId})
+
+	messagebus.Send(packedTransaction)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"testing"
+	"time"
+)
+
+// a distinct transaction id for each number
+func testTxId(n int) transaction.Link {
+	link := transaction.Link{}
+	link[0] = byte(n)
+	link[1] = byte(n >> 8)
+	return link
+}
+
+// test the oldest ids are forgotten when the set is full
+func TestKnownSet(t *testing.T) {
+
+	s := newKnownSet(3)
+	s.add(testTxId(1), testTxId(2), testTxId(2), testTxId(3))
+	for n := 1; n <= 3; n += 1 {
+		if !s.has(testTxId(n)) {
+			t.Errorf("missing: %d", n)
+		}
+	}
+
+	s.add(testTxId(4), testTxId(5))
+	for n := 1; n <= 5; n += 1 {
+		expected := n > 2
+		if expected != s.has(testTxId(n)) {
+			t.Errorf("%d: has: %v  expected: %v", n, !expected, expected)
+		}
+	}
+	if 3 != len(s.ids) {
+		t.Errorf("size: %d  expected: 3", len(s.ids))
+	}
+}
+
+// test each peer is only sent the ids it does not have
+func TestInventoryUnknown(t *testing.T) {
+
+	inv := newInventory()
+	ids := []transaction.Link{testTxId(1), testTxId(2), testTxId(3)}
+
+	// received from a
+	inv.markKnown("a", ids[:2])
+
+	unknown := inv.unknown("a", ids)
+	if 1 != len(unknown) || testTxId(3) != unknown[0] {
+		t.Errorf("a: unknown: %v  expected: [3]", unknown)
+	}
+	if unknown := inv.unknown("b", ids); 3 != len(unknown) {
+		t.Errorf("b: unknown: %d  expected: 3", len(unknown))
+	}
+
+	// not sent again
+	if unknown := inv.unknown("a", ids); 0 != len(unknown) {
+		t.Errorf("a: repeated: %v", unknown)
+	}
+
+	// a disconnected peer is forgotten
+	inv.prune([]string{"b"})
+	if unknown := inv.unknown("a", ids); 3 != len(unknown) {
+		t.Errorf("a: after prune unknown: %d  expected: 3", len(unknown))
+	}
+}
+
+// test a transaction is only fetched once at a time
+func TestInventoryRequest(t *testing.T) {
+
+	now := time.Now()
+	inv := newInventory()
+
+	if !inv.request("a", testTxId(1), now) {
+		t.Fatalf("first request not queued")
+	}
+	if inv.request("b", testTxId(1), now) {
+		t.Errorf("second request queued")
+	}
+
+	// retried after a failure or after a while
+	inv.failed(testTxId(1))
+	if !inv.request("b", testTxId(1), now) {
+		t.Errorf("request after failure not queued")
+	}
+	if !inv.request("c", testTxId(1), now.Add(inventoryRetryTime)) {
+		t.Errorf("request after retry time not queued")
+	}
+
+	for i, expected := range []string{"a", "b", "c"} {
+		w := <-inv.wanted
+		if expected != w.peer || testTxId(1) != w.txId {
+			t.Errorf("%d: wanted: %q  expected: %q", i, w.peer, expected)
+		}
+	}
+}
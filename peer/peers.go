@@ -6,14 +6,18 @@ package peer
 
 import (
 	"github.com/bitmark-inc/bitmarkd/announce"
+	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/gnomon"
 	"github.com/bitmark-inc/bitmarkd/util"
 	"github.com/bitmark-inc/logger"
+	"net"
+	"strings"
 )
 
 // type to hold Peer
 type Peer struct {
-	log *logger.L
+	log       *logger.L
+	publicKey string // of this node
 }
 
 // ------------------------------------------------------------
@@ -61,45 +65,129 @@ func (t *Peer) RPCs(arguments *NeighbourArguments, reply *NeighbourReply) error
 // ------------------------------------------------------------
 
 type PeerArguments struct {
-	Address     string
-	Fingerprint util.FingerprintBytes
+	Address   string
+	PublicKey string
 }
 
 type PeerReply struct {
-	Added           bool
-	NeedCertificate bool
+	Added bool
 }
 
+// receive a peer announcement
 func (t *Peer) Put(arguments *PeerArguments, reply *PeerReply) error {
 
-	panic("not yet")
-
-	// reply.Added = false
-	// reply.NeedCertificate = false
-
-	// address, err := CanonicalIPandPort(arguments.Address)
-	// if nil != err {
-	// 	return err
-	// }
-
-	// // already have it?
-	// _, err = announce.GetPeer(address, listenType)
-	// if nil == err {
-	// 	return nil
-	// }
-
-	// _, found := announce.GetCertificate(&arguments.Fingerprint)
-	// if !found {
-	// 	reply.NeedCertificate = true
-	// 	return nil
-	// }
-
-	// peerData := announce.PeerData{
-	// 	Fingerprint: &arguments.Fingerprint,
-	// }
-	// justAdded, err := announce.AddPeer(address, listenType, &peerData)
-	// if nil == err {
-	// 	reply.Added = justAdded
-	// }
-	// return err
+	added, err := addPeer(arguments.Address, arguments.PublicKey, t.publicKey)
+	if nil != err {
+		t.log.Debugf("Peer.Put: %q  error: %v", arguments.Address, err)
+		return err
+	}
+	if added {
+		t.log.Infof("new peer: %q  at: %s", arguments.PublicKey, arguments.Address)
+	}
+	reply.Added = added
+	return nil
+}
+
+// validate and store a peer listener
+//
+// the announcement is not signed, so the public key of an address is
+// not replaced, otherwise any peer could make connections to all
+// known addresses fail; the connector removes an announcement whose
+// key never became active so the address can then be announced again
+//
+// returns true if it was not already known
+func addPeer(address string, publicKey string, self string) (bool, error) {
+
+	if !validPublicKey(publicKey) {
+		return false, fault.ErrInvalidPublicKey
+	}
+
+	// do not connect to this node
+	if self == publicKey {
+		return false, nil
+	}
+
+	address, err := util.CanonicalIPandPort(address)
+	if nil != err {
+		return false, err
+	}
+	if !routable(address) {
+		return false, fault.ErrAddressNotRoutable
+	}
+
+	// already have it? do not refresh so announcements are not
+	// endlessly repeated between peers
+	if _, err := announce.GetPeer(address, announce.TypePeer); nil == err {
+		return false, nil
+	}
+
+	peerData := announce.PeerData{
+		PublicKey: publicKey,
+	}
+	return announce.AddPeer(address, announce.TypePeer, &peerData)
+}
+
+// networks that must not be dialled because of an announcement
+var nonRoutable = []*net.IPNet{}
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // unspecified
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier-grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link-local
+		"172.16.0.0/12",  // private
+		"192.168.0.0/16", // private
+		"224.0.0.0/3",    // multicast and reserved
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link-local
+		"ff00::/8",       // multicast
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if nil != err {
+			panic("invalid network: " + cidr)
+		}
+		nonRoutable = append(nonRoutable, network)
+	}
+}
+
+// true if a canonical IP:port can be reached over the internet
+func routable(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if nil != err {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if nil == ip {
+		return false
+	}
+	for _, network := range nonRoutable {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// the characters of Z85 encoding
+// see: http://rfc.zeromq.org/spec:32
+const z85Characters = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+// length of a Z85 encoded 32 byte curve key
+const publicKeyLength = 40
+
+// check for a Z85 encoded curve public key
+func validPublicKey(publicKey string) bool {
+	if publicKeyLength != len(publicKey) {
+		return false
+	}
+	for _, c := range publicKey {
+		if !strings.ContainsRune(z85Characters, c) {
+			return false
+		}
+	}
+	return true
 }
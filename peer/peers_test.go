@@ -0,0 +1,148 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"github.com/bitmark-inc/bitmarkd/announce"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	databaseFileName = "peers.leveldb"
+	testSelf         = "hR}n^Uv:4b3!zI<jfgg6Wrhhy.ssgk2S/s+t%rQE"
+	testPublicKey    = "rq:rM>}U?@Lns47E1/ll{dDnp-6QN%L-6+d1g.*g"
+)
+
+// test the public key format
+func TestValidPublicKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{testSelf, true},
+		{testPublicKey, true},
+		{"", false},
+		{testSelf[1:], false},
+		{testSelf + "0", false},
+		{"hR}n^Uv:4b3!zI<jfgg6Wrhhy.ssgk2S/s+t%rQ\"", false},
+		{"hR}n^Uv:4b3!zI<jfgg6Wrhhy.ssgk2S/s+t%rQ ", false},
+	}
+
+	for i, item := range tests {
+		if item.valid != validPublicKey(item.key) {
+			t.Errorf("%d: %q  valid: %v  expected: %v", i, item.key, !item.valid, item.valid)
+		}
+	}
+}
+
+// test announcements are validated and only stored once
+func TestAddPeer(t *testing.T) {
+	os.RemoveAll(databaseFileName)
+	pool.Initialise(databaseFileName)
+	announce.Initialise()
+	defer func() {
+		announce.Finalise()
+		pool.Finalise()
+		os.RemoveAll(databaseFileName)
+	}()
+
+	tests := []struct {
+		address   string
+		publicKey string
+		added     bool
+		err       error
+	}{
+		{"192.0.2.1:2135", testPublicKey, true, nil},
+		{"192.0.2.1:2135", testPublicKey, false, nil}, // already known
+		{" 192.0.2.1:2135", testPublicKey, false, nil},
+		{"192.0.2.1:2135", testSelf, false, nil}, // a different key does not replace it
+		{"[2001:db8::1]:2135", testPublicKey, true, nil},
+		{"192.0.2.2:2136", testSelf, false, nil}, // this node
+		{"192.0.2.3:2137", "short", false, fault.ErrInvalidPublicKey},
+		{"127.0.0.1:2135", testPublicKey, false, fault.ErrAddressNotRoutable},
+		{"[::1]:2135", testPublicKey, false, fault.ErrAddressNotRoutable},
+		{"0.0.0.0:2135", testPublicKey, false, fault.ErrAddressNotRoutable},
+		{"10.1.2.3:2135", testPublicKey, false, fault.ErrAddressNotRoutable},
+		{"192.168.1.1:2135", testPublicKey, false, fault.ErrAddressNotRoutable},
+		{"[fd00::1]:2135", testPublicKey, false, fault.ErrAddressNotRoutable},
+	}
+
+	for i, item := range tests {
+		added, err := addPeer(item.address, item.publicKey, testSelf)
+		if item.err != err || item.added != added {
+			t.Errorf("%d: %q  added: %v  error: %v  expected: %v  %v", i, item.address, added, err, item.added, item.err)
+		}
+	}
+
+	// an invalid address
+	if _, err := addPeer("localhost", testPublicKey, testSelf); nil == err {
+		t.Errorf("invalid address accepted")
+	}
+
+	for _, address := range []string{"192.0.2.1:2135", "[2001:db8::1]:2135"} {
+		data, err := announce.GetPeer(address, announce.TypePeer)
+		if nil != err {
+			t.Fatalf("get peer: %q  error: %v", address, err)
+		}
+		if testPublicKey != data.PublicKey {
+			t.Errorf("%q  public key: %q  expected: %q", address, data.PublicKey, testPublicKey)
+		}
+	}
+}
+
+// test an announced key that never became active can be replaced
+func TestFailedPeer(t *testing.T) {
+	os.RemoveAll(databaseFileName)
+	pool.Initialise(databaseFileName)
+	announce.Initialise()
+	defer func() {
+		announce.Finalise()
+		pool.Finalise()
+		os.RemoveAll(databaseFileName)
+	}()
+
+	otherKey := "rq:rM>}U?@Lns47E1/ll{dDnp-6QN%L-6+d1g.*h"
+	address := "192.0.2.1:2135"
+	if _, err := addPeer(address, testPublicKey, testSelf); nil != err {
+		t.Fatalf("add peer error: %v", err)
+	}
+
+	o := outgoing{
+		dialled: make(map[string]time.Time),
+		pending: make(map[string]string),
+	}
+	now := time.Now()
+	o.add(testPublicKey, address, now)
+	o.add(otherKey, "[2001:db8::1]:2135", now)
+	active := map[string]struct{}{
+		otherKey: {},
+	}
+
+	if failed := o.failed(active, now.Add(connectGrace/2)); 0 != len(failed) {
+		t.Errorf("failed within grace: %v", failed)
+	}
+	failed := o.failed(active, now.Add(connectGrace))
+	if 1 != len(failed) || address != failed[testPublicKey] {
+		t.Errorf("failed: %v  expected: %q", failed, address)
+	}
+	if failed := o.failed(active, now.Add(connectGrace)); 0 != len(failed) {
+		t.Errorf("failed again: %v", failed)
+	}
+
+	// once removed the address can be announced with another key
+	if added, err := addPeer(address, otherKey, testSelf); nil != err || added {
+		t.Errorf("replaced before removal: %v  error: %v", added, err)
+	}
+	if _, err := announce.RemovePeer(address, announce.TypePeer); nil != err {
+		t.Fatalf("remove peer error: %v", err)
+	}
+	if added, err := addPeer(address, otherKey, testSelf); nil != err || !added {
+		t.Errorf("not replaced: %v  error: %v", added, err)
+	}
+}
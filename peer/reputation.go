@@ -0,0 +1,274 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"encoding/binary"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"github.com/bitmark-inc/logger"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// misbehaviour of a peer
+//
+// only replies to requests made by this node can be scored as the
+// bilateral RPC does not identify the sender of an incoming request
+//
+// ***** FIX THIS: there is no excessive request rate offence, the
+// Block, Transaction and Peer services cannot count requests for each
+// connection until bilateralrpc passes the authenticated public key of
+// the caller to the service methods; a From field in the arguments is
+// not authenticated so it must not be used instead
+type Offence int
+
+const (
+	OffenceInvalidBlock   = Offence(iota) // block that cannot be unpacked
+	OffenceBadTransaction = Offence(iota) // transaction that cannot be unpacked or has a different id
+	OffenceTimeout        = Offence(iota) // no reply to a request
+)
+
+// score added for each offence
+var offenceScores = [...]float64{
+	OffenceInvalidBlock:   100,
+	OffenceBadTransaction: 25,
+	OffenceTimeout:        10,
+}
+
+// scoring limits
+const (
+	banThreshold  = 100.0     // score at which a peer is banned
+	scoreHalfLife = time.Hour // scores decay so occasional faults are forgiven
+	banFetchSize  = 100       // bans read at a time when loading
+	banCacheSize  = 100
+	banExpirySize = 8 // bytes of the expiry time
+)
+
+// a banned peer
+type Ban struct {
+	Peer  string    `json:"peer"`
+	Until time.Time `json:"until"`
+}
+
+// the misbehaviour of all peers
+type reputation struct {
+	sync.Mutex
+	log      *logger.L
+	duration time.Duration
+	scores   map[string]*peerScore
+	bans     map[string]time.Time
+	pool     *pool.Pool // nil if bans are not saved
+}
+
+// the decaying score of one peer
+type peerScore struct {
+	value   float64
+	updated time.Time
+}
+
+// create the reputation and load any saved bans
+func newReputation(log *logger.L, duration time.Duration, p *pool.Pool, now time.Time) *reputation {
+	r := &reputation{
+		log:      log,
+		duration: duration,
+		scores:   make(map[string]*peerScore),
+		bans:     make(map[string]time.Time),
+		pool:     p,
+	}
+	if nil == p {
+		return r
+	}
+
+	key := []byte{}
+loop:
+	for {
+		elements, err := p.Fetch(key, banFetchSize)
+		if nil != err {
+			fault.PanicWithError("peer.newReputation", err)
+		}
+		for _, e := range elements {
+			if banExpirySize != len(e.Value) {
+				continue
+			}
+			until := time.Unix(int64(binary.BigEndian.Uint64(e.Value)), 0)
+			if now.Before(until) {
+				r.bans[string(e.Key)] = until
+			} else {
+				p.Remove(e.Key)
+			}
+		}
+		if len(elements) < banFetchSize {
+			break loop
+		}
+		key = append(elements[len(elements)-1].Key, 0) // just after the last key
+	}
+	return r
+}
+
+// score an offence
+//
+// returns true if the peer is now banned
+func (r *reputation) offence(peer string, offence Offence, now time.Time) bool {
+	if "" == peer {
+		return false
+	}
+
+	score, banned := r.score(peer, offence, now)
+	r.log.Warnf("peer: %q  offence: %d  score: %.1f", peer, offence, score)
+	if banned {
+		r.log.Warnf("peer: %q  banned for: %s", peer, r.duration)
+	}
+	return banned
+}
+
+// add an offence to the decayed score, banning at the threshold
+func (r *reputation) score(peer string, offence Offence, now time.Time) (float64, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	s, found := r.scores[peer]
+	if !found {
+		s = &peerScore{
+			updated: now,
+		}
+		r.scores[peer] = s
+	}
+	s.decay(now)
+	s.value += offenceScores[offence]
+
+	score := s.value
+	if score < banThreshold {
+		return score, false
+	}
+
+	delete(r.scores, peer)
+	until := now.Add(r.duration)
+	r.bans[peer] = until
+	if nil != r.pool {
+		expiry := make([]byte, banExpirySize)
+		binary.BigEndian.PutUint64(expiry, uint64(until.Unix()))
+		r.pool.Add([]byte(peer), expiry)
+	}
+	return score, true
+}
+
+// reduce a score for the time since it was last updated
+func (s *peerScore) decay(now time.Time) {
+	elapsed := now.Sub(s.updated)
+	if elapsed > 0 {
+		s.value *= math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+		s.updated = now
+	}
+}
+
+// true if a peer is banned
+func (r *reputation) banned(peer string, now time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.isBanned(peer, now)
+}
+
+// remove banned peers from a list
+func (r *reputation) allowed(peers []string, now time.Time) []string {
+	r.Lock()
+	defer r.Unlock()
+
+	result := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if !r.isBanned(peer, now) {
+			result = append(result, peer)
+		}
+	}
+	return result
+}
+
+// check for a ban and discard it if expired
+//
+// only call while locked
+func (r *reputation) isBanned(peer string, now time.Time) bool {
+	until, found := r.bans[peer]
+	if !found {
+		return false
+	}
+	if now.Before(until) {
+		return true
+	}
+	r.unban(peer)
+	return false
+}
+
+// the current bans in peer order
+func (r *reputation) list(now time.Time) []Ban {
+	r.Lock()
+	defer r.Unlock()
+
+	bans := make([]Ban, 0, len(r.bans))
+	for peer, until := range r.bans {
+		if r.isBanned(peer, now) {
+			bans = append(bans, Ban{
+				Peer:  peer,
+				Until: until,
+			})
+		}
+	}
+	sort.Sort(byPeer(bans))
+	return bans
+}
+
+// remove a ban and forget the score
+//
+// returns true if the peer was banned
+func (r *reputation) clear(peer string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	_, found := r.bans[peer]
+	r.unban(peer)
+	delete(r.scores, peer)
+	return found
+}
+
+// only call while locked
+func (r *reputation) unban(peer string) {
+	delete(r.bans, peer)
+	if nil != r.pool {
+		r.pool.Remove([]byte(peer))
+	}
+}
+
+// to sort bans
+type byPeer []Ban
+
+func (a byPeer) Len() int           { return len(a) }
+func (a byPeer) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byPeer) Less(i, j int) bool { return a[i].Peer < a[j].Peer }
+
+// list the banned peers
+func Bans() ([]Ban, error) {
+	globalData.RLock()
+	defer globalData.RUnlock()
+
+	if !globalData.initialised {
+		return nil, fault.ErrNotInitialised
+	}
+	return globalData.reputation.list(time.Now()), nil
+}
+
+// remove the ban on a peer
+//
+// returns true if the peer was banned
+func Unban(peer string) (bool, error) {
+	globalData.RLock()
+	defer globalData.RUnlock()
+
+	if !globalData.initialised {
+		return false, fault.ErrNotInitialised
+	}
+	return globalData.reputation.clear(peer), nil
+}
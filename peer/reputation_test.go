@@ -0,0 +1,103 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+// test scores accumulate and a peer is banned at the threshold
+func TestReputationBan(t *testing.T) {
+
+	now := time.Now()
+	r := newReputation(nil, time.Hour, nil, now)
+
+	for i := 0; i < 3; i += 1 {
+		if _, banned := r.score("a", OffenceBadTransaction, now); banned {
+			t.Fatalf("%d: banned below threshold", i)
+		}
+	}
+	if _, banned := r.score("a", OffenceBadTransaction, now); !banned {
+		t.Fatalf("not banned at threshold")
+	}
+	if !r.banned("a", now) {
+		t.Errorf("banned peer not reported")
+	}
+	if r.banned("b", now) {
+		t.Errorf("unknown peer reported as banned")
+	}
+
+	allowed := r.allowed([]string{"a", "b", "c"}, now)
+	if 2 != len(allowed) || "b" != allowed[0] || "c" != allowed[1] {
+		t.Errorf("allowed: %v  expected: [b c]", allowed)
+	}
+
+	// ban expires
+	later := now.Add(time.Hour)
+	if r.banned("a", later) {
+		t.Errorf("ban did not expire")
+	}
+	if 0 != len(r.list(later)) {
+		t.Errorf("expired ban still listed")
+	}
+}
+
+// test scores decay so that occasional faults do not ban
+func TestReputationDecay(t *testing.T) {
+
+	now := time.Now()
+	r := newReputation(nil, time.Hour, nil, now)
+
+	score, _ := r.score("a", OffenceTimeout, now)
+	if 10 != score {
+		t.Fatalf("score: %f  expected: 10", score)
+	}
+
+	// one half life later the old score is halved
+	score, _ = r.score("a", OffenceTimeout, now.Add(scoreHalfLife))
+	if 15 != score {
+		t.Errorf("score: %f  expected: 15", score)
+	}
+
+	// a timeout every half life never reaches the threshold
+	for i := 2; i < 100; i += 1 {
+		if _, banned := r.score("a", OffenceTimeout, now.Add(time.Duration(i)*scoreHalfLife)); banned {
+			t.Fatalf("%d: banned for occasional timeouts", i)
+		}
+	}
+}
+
+// test listing and clearing bans
+func TestReputationList(t *testing.T) {
+
+	now := time.Now()
+	r := newReputation(nil, time.Hour, nil, now)
+
+	r.score("c", OffenceInvalidBlock, now)
+	r.score("a", OffenceInvalidBlock, now)
+	r.score("b", OffenceTimeout, now)
+
+	bans := r.list(now)
+	if 2 != len(bans) || "a" != bans[0].Peer || "c" != bans[1].Peer {
+		t.Fatalf("bans: %v  expected: a, c", bans)
+	}
+	if !now.Add(time.Hour).Equal(bans[0].Until) {
+		t.Errorf("until: %s  expected: %s", bans[0].Until, now.Add(time.Hour))
+	}
+
+	if !r.clear("a") {
+		t.Errorf("clear did not find ban")
+	}
+	if r.clear("b") {
+		t.Errorf("clear found ban for peer that was not banned")
+	}
+	if r.banned("a", now) {
+		t.Errorf("cleared peer still banned")
+	}
+	if 1 != len(r.list(now)) {
+		t.Errorf("bans: %v  expected: c", r.list(now))
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/messagebus"
 	"github.com/bitmark-inc/bitmarkd/payment"
+	"github.com/bitmark-inc/bitmarkd/policy"
 	"github.com/bitmark-inc/bitmarkd/transaction"
+	"time"
 )
 
 // loop to read queue
@@ -23,7 +25,7 @@ loop:
 	for {
 		select {
 		case item := <-queue:
-			go t.processItem(peer.server, item)
+			go t.processItem(peer.server, peer.publicKey, item)
 
 		case <-t.stop:
 			break loop
@@ -43,7 +45,7 @@ type BlockPair struct {
 }
 
 // process an item
-func (t *thread) processItem(server *bilateralrpc.Bilateral, item interface{}) {
+func (t *thread) processItem(server *bilateralrpc.Bilateral, self string, item interface{}) {
 	log := t.log
 
 decode:
@@ -74,55 +76,41 @@ decode:
 
 	case BlockPair: // a block sent from a connected peer
 		pair := item.(BlockPair)
-		// see  if block number is useful
-		if pair.unpacked.Number < block.Number() {
-			log.Infof("ignore block: %d\n", pair.unpacked.Number)
-			break decode
-		}
+		t.processBlock(server, self, pair.packed, &pair.unpacked)
 
-		// if matching "next" block save, otherwise ignore
-		if pair.unpacked.Number != block.Number() || pair.unpacked.Header.PreviousBlock != block.PreviousLink() {
-			log.Infof("ignore non-next block: %d\n", pair.unpacked.Number)
-			// ignore blocks too far ahead or fork occured
-			// (previous digests mismatch), then rely on
-			// synchronise to catch up.  Do not forward
-			// these blocks to other bitmarkds since we
-			// cannot verify the chain integrity.
+	case BlockCompactArguments: // a compact block sent from a connected peer
+		compact := item.(BlockCompactArguments)
+
+		// only the next block is useful, see processBlock
+		var header block.Header
+		if err := block.PackedHeader(compact.Header).Unpack(&header); nil != err {
+			log.Errorf("compact block: %d  error: %v", compact.Number, err)
 			break decode
 		}
-
-		// ensure have all transactions
-		active := server.ActiveConnections()
-		if !t.fetchAndMarkAssociatedTransactions(server, &pair.unpacked, active) {
-			log.Errorf("missed some transactions from: %q", active)
-			break decode // cannot continue
+		if compact.Number != block.Number() || header.PreviousBlock != block.PreviousLink() {
+			log.Infof("ignore non-next compact block: %d", compact.Number)
+			break decode
 		}
 
-		// save block only if sucessfully obtained all transactions
-		log.Infof("save block: %d\n", pair.unpacked.Number)
-		pair.packed.Save(pair.unpacked.Number, &pair.unpacked.Digest, pair.unpacked.Timestamp)
-
-		// send to everyone else - now local data is all saved
-		blockArguments := BlockPutArguments{
-			Block: []byte(pair.packed),
-		}
-		if err := server.Cast(bilateralrpc.SendToAll, "Block.Put", &blockArguments); nil != err {
-			// if remote does not accept it is not really a problem for this node - just warn
-			log.Warnf("Block.Put err = %v", err)
+		var blk block.Block
+		packed, ok := t.reconstruct(server, &compact, &blk)
+		if !ok {
+			log.Errorf("compact block: %d  could not be rebuilt", compact.Number)
+			break decode
 		}
+		t.processBlock(server, self, packed, &blk)
 
 	case block.Mined: // block created by local miner thread
-		packedBlock := item.(block.Mined)
+		packedBlock := block.Packed(item.(block.Mined))
 		log.Infof("incoming block.Mined = %x...", packedBlock[:32]) // only shows first 32 bytes
 
 		// our block, so send right away (since we must have all tx already saved)
-		blockArguments := BlockPutArguments{
-			Block: []byte(packedBlock),
-		}
-		if err := server.Cast(bilateralrpc.SendToAll, "Block.Put", &blockArguments); nil != err {
-			// if remote does not accept it is not really a problem for this node - just warn
-			log.Warnf("Block.Put err = %v", err)
+		var blk block.Block
+		if err := packedBlock.Unpack(&blk); nil != err {
+			log.Errorf("mined block: error: %v", err)
+			break decode
 		}
+		t.castCompact(server, self, packedBlock, &blk)
 
 	case transaction.Packed: // any incoming Tx either from peers or client RPC
 		log.Debugf("incoming Transaction.Packed = %x", item)
@@ -137,20 +125,29 @@ decode:
 		case fault.ErrTransactionAlreadyExists:
 			log.Infof("duplicate, ignoring incoming TxId = %#v", txId)
 
+		case fault.ErrBitmarkBurned:
+			log.Infof("burned bitmark, ignoring incoming TxId = %#v", txId)
+
+		case fault.ErrDoubleSpend:
+			log.Infof("bitmark already has a pending transfer, ignoring incoming TxId = %#v", txId)
+
+		case fault.ErrTransferExpired:
+			log.Infof("expired transfer, ignoring incoming TxId = %#v", txId)
+
+		case fault.ErrUnpaidPoolFull, fault.ErrRegistrantQuotaExceeded:
+			log.Warnf("unpaid limit: %v, ignoring incoming TxId = %#v", err, txId)
+
 		case nil: // send out as this is a newly stored transaction
 			log.Infof("new TxId = %#v", txId)
 
-			// set paid immediately if possible
-			payment.CheckPaid(txId)
-
-			transactionArguments := TransactionPutArguments{
-				Tx: item.(transaction.Packed),
+			// prepaid by contract, otherwise set paid immediately if possible
+			if !policy.CheckFree(txId) {
+				payment.CheckPaid(txId)
 			}
-			log.Debugf("put TxId: %#v", txId)
 
-			if err := server.Cast(bilateralrpc.SendToAll, "Transaction.Put", &transactionArguments); nil != err {
-				// if remote does not accept it is not really a problem for this node - just warn
-				log.Warnf("Transaction.Put err = %v", err)
+			// peers fetch it after the announcement
+			if !t.inventory.add(txId) {
+				log.Warnf("inventory full, delaying TxId = %#v", txId)
 			}
 		}
 
@@ -158,3 +155,40 @@ decode:
 		log.Errorf("Spurious message: %v", item)
 	}
 }
+
+// save the next block once all its transactions are on file and
+// pass it on
+func (t *thread) processBlock(server *bilateralrpc.Bilateral, self string, packed block.Packed, blk *block.Block) {
+	log := t.log
+
+	// see  if block number is useful
+	if blk.Number < block.Number() {
+		log.Infof("ignore block: %d\n", blk.Number)
+		return
+	}
+
+	// if matching "next" block save, otherwise ignore
+	if blk.Number != block.Number() || blk.Header.PreviousBlock != block.PreviousLink() {
+		log.Infof("ignore non-next block: %d\n", blk.Number)
+		// ignore blocks too far ahead or fork occured
+		// (previous digests mismatch), then rely on
+		// synchronise to catch up.  Do not forward
+		// these blocks to other bitmarkds since we
+		// cannot verify the chain integrity.
+		return
+	}
+
+	// ensure have all transactions
+	active := t.reputation.allowed(server.ActiveConnections(), time.Now())
+	if !t.fetchAndMarkAssociatedTransactions(server, blk, active) {
+		log.Errorf("missed some transactions from: %q", active)
+		return // cannot continue
+	}
+
+	// save block only if sucessfully obtained all transactions
+	log.Infof("save block: %d\n", blk.Number)
+	packed.Save(blk.Number, &blk.Digest, blk.Timestamp)
+
+	// send to everyone else - now local data is all saved
+	t.castCompact(server, self, packed, blk)
+}
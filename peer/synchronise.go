@@ -19,134 +19,197 @@ type BlockGetResult struct {
 }
 
 const (
-	retryCount     = 5    // attempts to retrieve block befor failing
-	blockRateLimit = 5.0  // maximum blocks per second to fetch
-	txRateLimit    = 15.0 // maximum transactions per second to put/get
-	txBatchSize    = 10   // number of transactions to fetch from database per loop
+	retryCount  = 5    // attempts to apply a block before failing
+	txRateLimit = 15.0 // maximum transactions per second to put/get
+	txBatchSize = 10   // number of transactions to fetch from database per loop
 )
 
+// a block fetched by a download worker
+type blockResponse struct {
+	peer   string
+	number uint64
+	packed block.Packed
+	block  *block.Block
+	ok     bool // false if the peer did not supply a valid block
+}
+
 // resync process
+//
+// blocks are requested from all the peers in parallel and are
+// validated and saved in order
 func (t *thread) resynchronise(server *bilateralrpc.Bilateral, n uint64, highest uint64, to []string) {
 
 	log := t.log
-	log.Info("resynchronise start")
+	log.Infof("resynchronise start: blocks: %d to %d  peers: %q", n, highest, to)
 
-	retries := 0
-	success := true
+	allowed := func(peer string) bool {
+		return !t.reputation.banned(peer, time.Now())
+	}
 
-	startTime := time.Now()
-	blockCount := 0
+	// the buffers hold every outstanding request so that neither
+	// side blocks
+	requests := make(map[string]chan uint64, len(to))
+	responses := make(chan blockResponse, len(to)*requestsPerPeer)
+	for _, peer := range to {
+		requests[peer] = make(chan uint64, requestsPerPeer)
+		for i := 0; i < requestsPerPeer; i += 1 {
+			go t.fetchBlocks(server, peer, requests[peer], responses)
+		}
+	}
+	defer func() {
+		for _, c := range requests {
+			close(c)
+		}
+	}()
+
+	scheduler := newDownloadScheduler(to, n, highest)
+	received := make(map[uint64]blockResponse)
+	retries := 0
 
 loop:
-	for {
-		if !success {
-			retries += 1
-			if retries > retryCount {
-				break loop
-			}
-		} else {
-			retries = 0
+	for !scheduler.finished() {
+
+		for _, r := range scheduler.assign(time.Now(), allowed) {
+			log.Debugf("request block: %d  from: %q", r.number, r.peer)
+			requests[r.peer] <- r.number
 		}
 
-		// compute block rate
-		blockCount += 1
-		rate := float64(blockCount) / time.Since(startTime).Seconds()
+		if scheduler.exhausted(allowed) {
+			log.Infof("no peer can supply block: %d", scheduler.next)
+			break loop
+		}
 
-		if rate > blockRateLimit {
-			select {
-			case <-t.stop:
-				break loop
-			case <-time.After(time.Second): // rate limit
+		select {
+		case <-t.stop:
+			break loop
+		case <-time.After(time.Second): // check for stalled requests
+		case r := <-responses:
+			if scheduler.completed(r.peer, r.number, r.ok) {
+				received[r.number] = r
 			}
-		} else {
-			select {
-			case <-t.stop:
+		}
+
+		// apply received blocks in order
+	apply:
+		for {
+			number := scheduler.next
+			r, found := received[number]
+			if !found {
+				break apply
+			}
+			blk := r.block
+
+			if retries > retryCount {
 				break loop
-			default:
 			}
-		}
+			retries += 1
 
-		log.Infof("resynchronisation get block: %d", n)
+			log.Infof("block: %d  digest: %#v", number, blk.Digest)
 
-		// assume failed
-		success = false
+			// fetch the previous block from local storage and see if needs to be replaced
+			previousPackedBlock, found := block.Get(number - 1)
+			if !found {
+				log.Errorf("missing previous block: %d", number-1)
+				scheduler.back()
+				continue apply
+			}
+			var previousBlock block.Block
+			err := previousPackedBlock.Unpack(&previousBlock)
+			if nil != err {
+				log.Errorf("faulty local previous block: error: %v", err)
+				scheduler.back() // just try to fetch again
+				continue apply
+			}
 
-		args := BlockGetArguments{
-			Number: n,
-		}
-		var result []BlockGetResult
-		if err := server.Call(to, "Block.Get", args, &result, 0); nil != err {
-			log.Errorf("Block.Get: error: %v", err)
-			if n >= highest {
-				break loop
+			if previousBlock.Digest != blk.Header.PreviousBlock {
+				log.Infof("fork detected: digest: %#v  expected: %#v", blk.Header.PreviousBlock, previousBlock.Digest)
+				delete(received, number)
+				scheduler.discard(number)
+				scheduler.back()
+				continue apply
 			}
-			continue loop
-		}
 
-		if 0 == len(result) {
-			log.Errorf("Block.Get: no reply from: %q", to)
-			if n >= highest {
-				break loop
+			// get transactions and mark as mined
+			if !t.fetchAndMarkAssociatedTransactions(server, blk, to) {
+				log.Errorf("missed some transactions from: %q", to)
+				break apply
 			}
-			continue loop
-		}
-		if nil != result[0].Err {
-			log.Infof("Block.Get error: %v", result[0].Err)
-			break loop
+
+			// save block
+			r.packed.Save(number, &blk.Digest, blk.Timestamp)
+			delete(received, number)
+			scheduler.applied()
+			retries = 0
 		}
+	}
 
-		// this outputs a lot of data…
-		log.Tracef("result: %v", result)
+	log.Info("resynchronisation complete")
+}
 
-		// validate
-		packedBlock := block.Packed(result[0].Reply.Data)
+// fetch the blocks requested from one peer
+func (t *thread) fetchBlocks(server *bilateralrpc.Bilateral, peer string, requests <-chan uint64, responses chan<- blockResponse) {
+	for n := range requests {
+		responses <- t.fetchBlock(server, peer, n, true)
+	}
+}
 
-		var blk block.Block
-		err := packedBlock.Unpack(&blk)
-		if nil != err {
-			log.Errorf("bad result: %v", result)
-			log.Errorf("received block from: %q  error: %v", to, err)
-			continue loop
-		}
+// fetch and unpack one block
+//
+// score is false when the peer was named by an unauthenticated
+// request so a bad reply must not count against it
+func (t *thread) fetchBlock(server *bilateralrpc.Bilateral, peer string, n uint64, score bool) blockResponse {
 
-		log.Infof("block: %d  digest: %#v", blk.Number, blk.Digest)
+	log := t.log
 
-		// fetch the previous block from local storage and see if needs to be replaced
-		previousPackedBlock, found := block.Get(n - 1)
-		if !found {
-			log.Errorf("missing previous block: %d", n-1)
-			n -= 1
-			continue loop
-		}
-		var previousBlock block.Block
-		err = previousPackedBlock.Unpack(&previousBlock)
-		if nil != err {
-			log.Errorf("faulty local previous block: error: %v", err)
-			n -= 1 // just try to fetch again
-			continue loop
-		}
+	response := blockResponse{
+		peer:   peer,
+		number: n,
+	}
 
-		if previousBlock.Digest != blk.Header.PreviousBlock {
-			log.Infof("fork detected: digest: %#v  expected: %#v", blk.Header.PreviousBlock, previousBlock.Digest)
-			n -= 1
-			continue loop
-		}
+	args := BlockGetArguments{
+		Number: n,
+	}
+	var result []BlockGetResult
+	if err := server.Call([]string{peer}, "Block.Get", args, &result, 0); nil != err {
+		log.Errorf("Block.Get: error: %v", err)
+		return response
+	}
 
-		// get transactions and mark as mined
-		if !t.fetchAndMarkAssociatedTransactions(server, &blk, to) {
-			log.Errorf("missed some transactions from: %q", to)
-			continue loop
+	if 0 == len(result) {
+		log.Errorf("Block.Get: no reply from: %q", peer)
+		if score {
+			t.reputation.offence(peer, OffenceTimeout, time.Now())
 		}
+		return response
+	}
+	if nil != result[0].Err {
+		log.Infof("Block.Get: %d  from: %q  error: %v", n, peer, result[0].Err)
+		return response
+	}
+
+	// this outputs a lot of data…
+	log.Tracef("result: %v", result)
 
-		// save block
-		packedBlock.Save(n, &blk.Digest, blk.Timestamp)
+	// validate
+	packedBlock := block.Packed(result[0].Reply.Data)
 
-		// success want next block
-		success = true
-		n += 1
+	blk := &block.Block{}
+	err := packedBlock.Unpack(blk)
+	if nil == err && n != blk.Number {
+		err = fault.ErrInvalidBlock
+	}
+	if nil != err {
+		log.Errorf("received block: %d  from: %q  error: %v", n, peer, err)
+		if score {
+			t.reputation.offence(peer, OffenceInvalidBlock, time.Now())
+		}
+		return response
 	}
 
-	log.Info("resynchronisation complete")
+	response.packed = packedBlock
+	response.block = blk
+	response.ok = true
+	return response
 }
 
 // for getting transactions
@@ -204,33 +267,19 @@ loop:
 			continue
 		}
 
-		// fetch the transaction
-		args := TransactionGetArguments{
-			TxId: txid,
-		}
-
 		// fetch from just from one peer from the list
 	fetchOne:
-		for _, to := range addresses {
-			var result []TransactionGetResult
-			if err := server.Call([]string{to}, "Transaction.Get", args, &result, 0); nil != err {
-				log.Errorf("Transaction.Get: error: %v", err)
-				success = false
-				continue fetchOne
-			}
-
-			if 0 == len(result) {
-				log.Errorf("Transaction.Get: no reply from: %q", to)
+		for _, to := range t.reputation.allowed(addresses, time.Now()) {
+			packedTransaction, ok := t.getTransaction(server, to, txid, true)
+			if !ok {
 				success = false
 				continue fetchOne
 			}
 
-			// validate
-			packedTransaction := transaction.Packed(result[0].Reply.Data)
-
-			_, err := packedTransaction.Unpack()
-			if nil != err {
-				log.Errorf("received transaction from: %q  error: %v", to, err)
+			// must be the requested transaction before it is stored
+			if txid != packedTransaction.MakeLink() {
+				log.Errorf("txid: %#v changed to: %#v", txid, packedTransaction.MakeLink())
+				t.reputation.offence(to, OffenceBadTransaction, time.Now())
 				success = false
 				continue fetchOne
 			}
@@ -238,18 +287,13 @@ loop:
 			// write the transaction
 			log.Infof("txid: %#v", txid)
 			var txid2 transaction.Link
-			switch err := packedTransaction.Write(&txid2); err {
-			case nil:
-				fallthrough
-			case fault.ErrTransactionAlreadyExists:
-				if txid != txid2 {
-					log.Errorf("txid: %#v changed to: %#v", txid, txid2)
-					success = false
-					continue fetchOne
-				}
+			switch err := packedTransaction.WriteMined(&txid2); err {
+			case nil, fault.ErrTransactionAlreadyExists:
 			default:
-				log.Criticalf("write tx error: %v", err)
-				fault.PanicWithError("synchronise.fetchAndMarkAssociatedTransactions", err)
+				log.Errorf("txid: %#v  write tx error: %v", txid, err)
+				t.reputation.offence(to, OffenceBadTransaction, time.Now())
+				success = false
+				continue fetchOne
 			}
 
 			// got a valid tx - flag as mined
@@ -279,6 +323,49 @@ loop:
 	return success
 }
 
+// fetch and unpack one transaction from a peer
+//
+// score is false when the peer was named by an unauthenticated
+// request so a bad reply must not count against it
+func (t *thread) getTransaction(server *bilateralrpc.Bilateral, to string, txid transaction.Link, score bool) (transaction.Packed, bool) {
+
+	log := t.log
+
+	args := TransactionGetArguments{
+		TxId: txid,
+	}
+	var result []TransactionGetResult
+	if err := server.Call([]string{to}, "Transaction.Get", args, &result, 0); nil != err {
+		log.Errorf("Transaction.Get: error: %v", err)
+		return nil, false
+	}
+
+	if 0 == len(result) {
+		log.Errorf("Transaction.Get: no reply from: %q", to)
+		if score {
+			t.reputation.offence(to, OffenceTimeout, time.Now())
+		}
+		return nil, false
+	}
+	if nil != result[0].Err {
+		log.Infof("Transaction.Get from: %q  error: %v", to, result[0].Err)
+		return nil, false
+	}
+
+	// validate
+	packedTransaction := transaction.Packed(result[0].Reply.Data)
+
+	_, err := packedTransaction.Unpack()
+	if nil != err {
+		log.Errorf("received transaction from: %q  error: %v", to, err)
+		if score {
+			t.reputation.offence(to, OffenceBadTransaction, time.Now())
+		}
+		return nil, false
+	}
+	return packedTransaction, true
+}
+
 // for putting transactions
 type TransactionPutResult struct {
 	From  string
@@ -286,71 +373,35 @@ type TransactionPutResult struct {
 	Err   error
 }
 
-// rebroadcast all available transactions
-func (t *thread) rebroadcastTransactions(server *bilateralrpc.Bilateral) {
+// announce all available transactions
+//
+// the inventory only sends each peer the ones it does not have, so
+// this reaches newly connected peers and any that were missed
+func (t *thread) announceTransactions() {
 
 	log := t.log
 
-	log.Info("rebroadcast tx start")
+	log.Info("announce tx start")
 
 	cursor := transaction.NewAvailableCursor()
-
-	startTime := time.Now()
-	rate := 0.0
 	txCount := 0
 
 loop:
 	for {
-
-		if rate > txRateLimit {
-			select {
-			case <-t.stop:
-				break loop
-			case <-time.After(time.Second): // rate limit
-			}
-		} else {
-			select {
-			case <-t.stop:
-				break loop
-			default:
-			}
-		}
-
 		txIds := cursor.FetchAvailable(txBatchSize)
 		if 0 == len(txIds) {
 			break loop
 		}
-		log.Infof("rebroadcast count: %d", len(txIds))
-
-		for i, txId := range txIds {
 
+		for _, txId := range txIds {
 			select {
 			case <-t.stop:
 				break loop
-			default:
-			}
-
-			state, packedTx, found := transaction.Link(txId).Read()
-
-			if !found || transaction.AvailableTransaction != state {
-				continue
-			}
-
-			args := TransactionPutArguments{
-				Tx: packedTx,
-			}
-
-			log.Infof("rebroadcast [%d/%d] TxId: %#v", i, len(txIds), txId)
-
-			if err := server.Cast(bilateralrpc.SendToAll, "Transaction.Put", args); nil != err {
-				log.Errorf("Transaction.Put: error: %v", err)
+			case t.inventory.queue <- transaction.Link(txId):
 			}
 		}
-
-		// compute tx rate
 		txCount += len(txIds)
-		rate = float64(txCount) / time.Since(startTime).Seconds()
 	}
 
-	log.Info("rebroadcast tx complete")
+	log.Infof("announce tx complete: %d", txCount)
 }
@@ -9,10 +9,12 @@ import (
 	"github.com/bitmark-inc/bitmarkd/messagebus"
 	"github.com/bitmark-inc/bitmarkd/transaction"
 	"github.com/bitmark-inc/logger"
+	"time"
 )
 
 type Transaction struct {
-	log *logger.L
+	log       *logger.L
+	inventory *inventory
 }
 
 // ------------------------------------------------------------
@@ -65,3 +67,44 @@ func (t *Transaction) Get(arguments *TransactionGetArguments, reply *Transaction
 	reply.Data = data
 	return nil
 }
+
+// ------------------------------------------------------------
+
+type TransactionInventoryArguments struct {
+	From  string // public key of the announcing peer
+	TxIds []transaction.Link
+}
+
+type TransactionInventoryReply struct {
+	Wanted int
+}
+
+// announcement of transactions held by a peer
+//
+// the ones not already on file are fetched from that peer with
+// Transaction.Get
+//
+// the caller cannot be identified so From is only a hint of where to
+// fetch from, it is not recorded as holding the transactions until
+// one is actually received from it
+func (t *Transaction) Inventory(arguments *TransactionInventoryArguments, reply *TransactionInventoryReply) error {
+
+	if len(arguments.TxIds) > inventoryBatchSize {
+		return fault.ErrInvalidCount
+	}
+	if !validPublicKey(arguments.From) {
+		return fault.ErrInvalidPublicKey
+	}
+
+	now := time.Now()
+	for _, txId := range arguments.TxIds {
+		if _, found := txId.State(); found {
+			continue
+		}
+		if t.inventory.request(arguments.From, txId, now) {
+			reply.Wanted += 1
+		}
+	}
+	t.log.Debugf("Inventory: from: %q  count: %d  wanted: %d", arguments.From, len(arguments.TxIds), reply.Wanted)
+	return nil
+}
@@ -0,0 +1,13 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// free transaction policy
+//
+// Registrants that have prepaid by contract are configured by public
+// key or asset index, each with an optional quota.  Matching unpaid
+// transactions skip payment and are made available for mining
+// immediately.  Every decision is stored for audit, including asset
+// records which are never charged as they are paid for with their
+// first issue.
+package policy
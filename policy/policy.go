@@ -0,0 +1,422 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"github.com/bitmark-inc/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// internal constants
+const (
+	quotaSeparator = ":"
+	cacheSize      = 100
+	panicMessage   = "policy module is not initialised"
+)
+
+// the kind of rule that matched
+const (
+	ruleRegistrant = byte('R')
+	ruleAsset      = byte('A')
+	ruleAssetData  = byte('D') // asset records never need payment
+	ruleNone       = byte('N')
+)
+
+// the decision made
+const (
+	decisionFree = byte('F')
+	decisionPay  = byte('P')
+)
+
+// a single whitelist entry
+type rule struct {
+	quota uint64 // maximum free transactions, zero => unlimited
+}
+
+// globals for the policy
+var globalData struct {
+	sync.Mutex // to allow locking
+
+	// logger
+	log *logger.L
+
+	// whitelists
+	registrants map[string]rule // key is the string of the public key bytes
+	assets      map[transaction.AssetIndex]rule
+
+	// persistent data
+	quotaPool *pool.Pool // count of free transactions used
+	auditPool *pool.Pool // every decision
+
+	// set once during initialise
+	initialised bool
+}
+
+// a recorded decision - for JSON conversion
+type Decision struct {
+	Timestamp time.Time `json:"timestamp"`
+	Free      bool      `json:"free"`
+	Rule      string    `json:"rule"`
+	Key       string    `json:"key"`
+}
+
+// initialise the policy from the configured whitelists
+//
+// each registrant is: base58-address[:quota]
+// each asset is:      BMA0hex-asset-index[:quota]
+//
+// a missing or zero quota is unlimited
+func Initialise(registrants []string, assets []string) error {
+	globalData.Lock()
+	defer globalData.Unlock()
+
+	// no need to start if already started
+	if globalData.initialised {
+		return fault.ErrAlreadyInitialised
+	}
+
+	globalData.log = logger.New("policy")
+	if nil == globalData.log {
+		return fault.ErrInvalidLoggerChannel
+	}
+	globalData.log.Info("starting…")
+
+	globalData.registrants = make(map[string]rule)
+	globalData.assets = make(map[transaction.AssetIndex]rule)
+
+	for _, r := range registrants {
+		publicKey, quota, err := parseRegistrant(r)
+		if nil != err {
+			globalData.log.Errorf("registrant: %q  error: %v", r, err)
+			return err
+		}
+		globalData.registrants[string(publicKey)] = rule{quota: quota}
+		globalData.log.Infof("free registrant: %x  quota: %d", publicKey, quota)
+	}
+
+	for _, a := range assets {
+		assetIndex, quota, err := parseAsset(a)
+		if nil != err {
+			globalData.log.Errorf("asset: %q  error: %v", a, err)
+			return err
+		}
+		globalData.assets[assetIndex] = rule{quota: quota}
+		globalData.log.Infof("free asset: %#v  quota: %d", assetIndex, quota)
+	}
+
+	globalData.quotaPool = pool.New(pool.PolicyQuota, cacheSize)
+	globalData.auditPool = pool.New(pool.PolicyAudit, cacheSize)
+
+	// all data initialised
+	globalData.initialised = true
+
+	return nil
+}
+
+// finalise - flush unsaved data
+func Finalise() {
+	globalData.Lock()
+	defer globalData.Unlock()
+
+	if !globalData.initialised {
+		return
+	}
+
+	globalData.log.Info("shutting down…")
+	globalData.quotaPool.Flush()
+	globalData.auditPool.Flush()
+	globalData.log.Flush()
+	globalData.initialised = false
+}
+
+// check if an unpaid transaction can skip payment and if so make it available
+//
+// returns true on transition from unpaid to available
+func CheckFree(txId transaction.Link) bool {
+	globalData.Lock()
+	defer globalData.Unlock()
+
+	if !globalData.initialised {
+		fault.Panic(panicMessage)
+	}
+
+	// nothing configured so everything must be paid
+	if 0 == len(globalData.registrants) && 0 == len(globalData.assets) {
+		return false
+	}
+
+	state, packed, found := txId.Read()
+	if !found {
+		return false
+	}
+
+	// an asset waits for its first issue and is paid with it, so
+	// only record that no payment was required
+	if transaction.WaitingIssueTransaction == state {
+		if publicKey, _, ok := identify(packed); ok {
+			record(txId, decisionFree, ruleAssetData, publicKey)
+		}
+		return false
+	}
+
+	if transaction.UnpaidTransaction != state {
+		return false
+	}
+
+	kind := ruleNone
+	key := []byte{}
+	free := false
+
+	publicKey, assetIndex, ok := identify(packed)
+	if ok {
+		count := units(packed)
+		if r, found := globalData.registrants[string(publicKey)]; found {
+			kind = ruleRegistrant
+			key = publicKey
+			free = consume(key, r, count)
+		}
+		if r, found := globalData.assets[assetIndex]; !free && found {
+			kind = ruleAsset
+			key = assetIndex.Bytes()
+			free = consume(key, r, count)
+		}
+	}
+
+	decision := decisionPay
+	if free {
+		decision = decisionFree
+	}
+	record(txId, decision, kind, key)
+
+	if !free {
+		return false
+	}
+
+	globalData.log.Infof("free: %#v  rule: %c  key: %x", txId, kind, key)
+	txId.SetState(transaction.AvailableTransaction)
+	return true
+}
+
+// fetch the recorded decision for a transaction
+func ReadDecision(txId transaction.Link) (*Decision, bool) {
+	globalData.Lock()
+	defer globalData.Unlock()
+
+	if !globalData.initialised {
+		fault.Panic(panicMessage)
+	}
+
+	data, found := globalData.auditPool.Get(txId.Bytes())
+	if !found || len(data) < 10 {
+		return nil, false
+	}
+
+	rule := "none"
+	switch data[9] {
+	case ruleRegistrant:
+		rule = "registrant"
+	case ruleAsset:
+		rule = "asset"
+	case ruleAssetData:
+		rule = "asset-data"
+	}
+
+	seconds := binary.BigEndian.Uint64(data[:8])
+	d := &Decision{
+		Timestamp: time.Unix(int64(seconds), 0).UTC(),
+		Free:      decisionFree == data[8],
+		Rule:      rule,
+		Key:       fmt.Sprintf("%x", data[10:]),
+	}
+	return d, true
+}
+
+// internal routines - only call while globalData locked
+// -----------------------------------------------------
+
+// determine the signing public key and the asset of a transaction
+func identify(packed transaction.Packed) ([]byte, transaction.AssetIndex, bool) {
+
+	record, err := packed.Unpack()
+	if nil != err {
+		return nil, transaction.AssetIndex{}, false
+	}
+
+	switch record.(type) {
+	case *transaction.AssetData:
+		asset := record.(*transaction.AssetData)
+		return asset.Registrant.PublicKeyBytes(), asset.AssetIndex(), true
+
+	case *transaction.BitmarkIssue:
+		issue := record.(*transaction.BitmarkIssue)
+		return issue.Owner.PublicKeyBytes(), issue.AssetIndex, true
+
+	case *transaction.BitmarkBatchIssue:
+		batch := record.(*transaction.BitmarkBatchIssue)
+		return batch.Owner.PublicKeyBytes(), batch.AssetIndex, true
+
+	case *transaction.BitmarkTransfer, *transaction.BitmarkCountersignedTransfer, *transaction.BitmarkBurn:
+		var link transaction.Link
+		switch record.(type) {
+		case *transaction.BitmarkTransfer:
+			link = record.(*transaction.BitmarkTransfer).Link
+		case *transaction.BitmarkCountersignedTransfer:
+			link = record.(*transaction.BitmarkCountersignedTransfer).Link
+		default:
+			link = record.(*transaction.BitmarkBurn).Link
+		}
+
+		// signed by the owner from the previous record
+		_, previousPacked, found := link.ReadBitmark()
+		if !found {
+			return nil, transaction.AssetIndex{}, false
+		}
+		previous, err := previousPacked.Unpack()
+		if nil != err {
+			return nil, transaction.AssetIndex{}, false
+		}
+		var publicKey []byte
+		switch previous.(type) {
+		case *transaction.BitmarkIssue:
+			publicKey = previous.(*transaction.BitmarkIssue).Owner.PublicKeyBytes()
+		case *transaction.BitmarkBatchIssue:
+			publicKey = previous.(*transaction.BitmarkBatchIssue).Owner.PublicKeyBytes()
+		case *transaction.BitmarkTransfer:
+			publicKey = previous.(*transaction.BitmarkTransfer).Owner.PublicKeyBytes()
+		case *transaction.BitmarkCountersignedTransfer:
+			publicKey = previous.(*transaction.BitmarkCountersignedTransfer).Owner.PublicKeyBytes()
+		default:
+			return nil, transaction.AssetIndex{}, false
+		}
+
+		// the asset from the ownership index
+		assetDataLink, found := link.AssetLink()
+		if !found {
+			return nil, transaction.AssetIndex{}, false
+		}
+		_, assetPacked, found := assetDataLink.Read()
+		if !found {
+			return nil, transaction.AssetIndex{}, false
+		}
+		asset, err := assetPacked.Unpack()
+		if nil != err {
+			return nil, transaction.AssetIndex{}, false
+		}
+		assetData, ok := asset.(*transaction.AssetData)
+		if !ok {
+			return nil, transaction.AssetIndex{}, false
+		}
+		return publicKey, assetData.AssetIndex(), true
+
+	default:
+		return nil, transaction.AssetIndex{}, false
+	}
+}
+
+// the number of quota items a transaction uses
+//
+// a batch issue uses one for each bitmark it issues
+func units(packed transaction.Packed) uint64 {
+	record, err := packed.Unpack()
+	if nil != err {
+		return 1
+	}
+	if batch, ok := record.(*transaction.BitmarkBatchIssue); ok && batch.Count > 1 {
+		return batch.Count
+	}
+	return 1
+}
+
+// use count items of quota
+//
+// returns false if less than count items remain, in which case
+// nothing is used
+func consume(key []byte, r rule, count uint64) bool {
+	used := uint64(0)
+	if data, found := globalData.quotaPool.Get(key); found && 8 == len(data) {
+		used = binary.BigEndian.Uint64(data)
+	}
+
+	if 0 != r.quota && (used >= r.quota || count > r.quota-used) {
+		globalData.log.Warnf("quota exhausted for key: %x  used: %d  requested: %d", key, used, count)
+		return false
+	}
+
+	buffer := make([]byte, 8)
+	binary.BigEndian.PutUint64(buffer, used+count)
+	globalData.quotaPool.Add(key, buffer)
+	return true
+}
+
+// store a decision for audit
+func record(txId transaction.Link, decision byte, kind byte, key []byte) {
+	data := make([]byte, 10, 10+len(key))
+	binary.BigEndian.PutUint64(data, uint64(time.Now().UTC().Unix()))
+	data[8] = decision
+	data[9] = kind
+	data = append(data, key...)
+	globalData.auditPool.Add(txId.Bytes(), data)
+
+	globalData.log.Debugf("decision: %#v  %c  rule: %c  key: %x", txId, decision, kind, key)
+}
+
+// parse: base58-address[:quota]
+func parseRegistrant(s string) ([]byte, uint64, error) {
+	text, quota, err := splitQuota(s)
+	if nil != err {
+		return nil, 0, err
+	}
+	address, err := transaction.AddressFromBase58(text)
+	if nil != err {
+		return nil, 0, err
+	}
+	return address.PublicKeyBytes(), quota, nil
+}
+
+// parse: BMA0hex-asset-index[:quota]
+func parseAsset(s string) (transaction.AssetIndex, uint64, error) {
+	var assetIndex transaction.AssetIndex
+	text, quota, err := splitQuota(s)
+	if nil != err {
+		return assetIndex, 0, err
+	}
+	n, err := fmt.Sscan(text, &assetIndex)
+	if nil != err {
+		return assetIndex, 0, err
+	}
+	if 1 != n {
+		return assetIndex, 0, fault.ErrNotAssetIndex
+	}
+	return assetIndex, quota, nil
+}
+
+// split off an optional quota
+func splitQuota(s string) (string, uint64, error) {
+	parts := strings.Split(strings.TrimSpace(s), quotaSeparator)
+	text := strings.TrimSpace(parts[0])
+	if "" == text {
+		return "", 0, fault.ErrInvalidPolicyRule
+	}
+	switch len(parts) {
+	case 1:
+		return text, 0, nil
+	case 2:
+		quota, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if nil != err {
+			return "", 0, fault.ErrInvalidPolicyRule
+		}
+		return text, quota, nil
+	default:
+		return "", 0, fault.ErrInvalidPolicyRule
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"github.com/bitmark-inc/logger"
+	"os"
+	"testing"
+)
+
+// test database file
+const policyDatabase = "policy.leveldb"
+
+// check the optional quota is split correctly
+func TestSplitQuota(t *testing.T) {
+	tests := []struct {
+		rule  string
+		text  string
+		quota uint64
+	}{
+		{"key", "key", 0},
+		{" key ", "key", 0},
+		{"key:0", "key", 0},
+		{"key:1", "key", 1},
+		{"key: 250 ", "key", 250},
+		{"key:18446744073709551615", "key", 18446744073709551615},
+	}
+
+	for i, item := range tests {
+		text, quota, err := splitQuota(item.rule)
+		if nil != err {
+			t.Errorf("%d: rule: %q  error: %v", i, item.rule, err)
+			continue
+		}
+		if item.text != text || item.quota != quota {
+			t.Errorf("%d: rule: %q → %q, %d  expected: %q, %d", i, item.rule, text, quota, item.text, item.quota)
+		}
+	}
+}
+
+// check that bad rules are rejected
+func TestInvalidRules(t *testing.T) {
+	invalid := []string{
+		"",
+		" ",
+		":5",
+		"key:",
+		"key:-1",
+		"key:five",
+		"key:5:6",
+		"key:18446744073709551616",
+	}
+
+	for i, r := range invalid {
+		_, _, err := splitQuota(r)
+		if fault.ErrInvalidPolicyRule != err {
+			t.Errorf("%d: rule: %q  expected ErrInvalidPolicyRule but got: %v", i, r, err)
+		}
+	}
+}
+
+// check asset index parsing
+func TestParseAsset(t *testing.T) {
+	text := "BMA0" +
+		"5a1ec5a5d8ba2ed4d5be8b5a1b0b7c4cf60d3a5e3a8a0df6c8d1e1c1fb63b6f6" +
+		"d9c3e6e0a17a6de1c4d0a8dc2d14a54be04e8fd4b1b8c1a7dbce23eebad7c2b1"
+
+	assetIndex, quota, err := parseAsset(text + ":10")
+	if nil != err {
+		t.Fatalf("parseAsset error: %v", err)
+	}
+	if 10 != quota {
+		t.Errorf("quota: %d  expected: 10", quota)
+	}
+	if text[4:] != assetIndex.String() {
+		t.Errorf("asset: %s  expected: %s", assetIndex, text[4:])
+	}
+
+	if _, _, err := parseAsset("BMA0abc:10"); nil == err {
+		t.Errorf("short asset index was accepted")
+	}
+}
+
+// check a quota is used by the number of items requested
+func TestConsume(t *testing.T) {
+	os.RemoveAll(policyDatabase)
+	pool.Initialise(policyDatabase)
+	defer func() {
+		pool.Finalise()
+		os.RemoveAll(policyDatabase)
+	}()
+
+	globalData.log = logger.New("policy")
+	globalData.quotaPool = pool.New(pool.PolicyQuota, cacheSize)
+
+	key := []byte("registrant")
+	r := rule{quota: 10}
+
+	if !consume(key, r, 1) {
+		t.Fatalf("single item was refused")
+	}
+
+	// a batch larger than the remaining quota uses nothing
+	if consume(key, r, 10) {
+		t.Errorf("batch of 10 accepted with only 9 remaining")
+	}
+	if !consume(key, r, 9) {
+		t.Errorf("batch of 9 refused with 9 remaining")
+	}
+	if consume(key, r, 1) {
+		t.Errorf("item accepted after quota was used")
+	}
+
+	// unlimited
+	if !consume([]byte("unlimited"), rule{}, 10000) {
+		t.Errorf("unlimited quota refused a batch")
+	}
+}
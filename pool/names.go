@@ -12,6 +12,7 @@ package pool
 // Blocks:
 //
 //   B<block-number>       - block store (already mined blocks) = header + cbLength + coinbase + count + merkle tree of transactions
+//   L<tx-digest>          - int64[block number] (locate the block that mined a transaction)
 //
 // Transactions:
 //
@@ -24,18 +25,32 @@ package pool
 //
 //   I<assetIndex>         - transaction-digest (to locate the AssetData transaction)
 //
+//   N<kind><length><term><cursor>
+//                         - transaction-digest (mined assets by kind: name token(N), registrant(R), fingerprint prefix(F))
+//
 // Ownership:
 //
 //   O<bmtran-digest>      - owner public key ++ registration digest (to check current ownership of property)
 //
+//   X<bitmark-digest>     - batch-issue-digest ++ int64[nonce] (locate the batch issue for an expanded bitmark)
+//
+//   D<bitmark-digest>     - burn-digest (the bitmark has been permanently retired)
+//
 //   K<pubkey><tx-digest>  - byte[asset(A), Bitmark Issue(I), bitmark transfer(T)] ++ asset index
 //                           (to list current ownership of asset/issue/bitmark)
 //
+// Policy:
+//
+//   Q<pubkey|assetIndex>  - int64[count of free transactions used against the quota]
+//   F<tx-digest>          - int64[timestamp] ++ byte[free(F), pay(P)] ++ byte[registrant(R), asset(A), none(N)] ++ matched key
+//                           (audit of free transaction decisions)
+//
 // Networking:
 //
 //   P<IP:port>            - P2P: ZMQ public-key
 //   R<IP:port>            - RPC: certificate-fingerprint
 //   C<fingerprint>        - raw certificate
+//   V<peer-public-key>    - int64[ban expiry timestamp] (peers banned for misbehaviour)
 
 // type for pool name
 type nameb byte
@@ -46,6 +61,7 @@ const (
 	Peers        = nameb('P')
 	RPCs         = nameb('R')
 	Certificates = nameb('C')
+	PeerBans     = nameb('V')
 
 	// transaction data pools
 	TransactionData  = nameb('T')
@@ -56,13 +72,21 @@ const (
 	AvailableIndex = nameb('A')
 
 	// asset
-	AssetData = nameb('I')
+	AssetData   = nameb('I')
+	AssetSearch = nameb('N')
 
 	// ownership indexes
 	OwnerIndex = nameb('O')
+	BatchIndex = nameb('X')
+	BurnIndex  = nameb('D')
+
+	// free transaction policy
+	PolicyQuota = nameb('Q')
+	PolicyAudit = nameb('F')
 
 	// blocks
-	BlockData = nameb('B')
+	BlockData    = nameb('B')
+	BlockTxIndex = nameb('L')
 
 	// just for testing
 	TestData = nameb('Z')
@@ -285,61 +285,69 @@ func (p *Pool) Fetch(key []byte, count int) ([]Element, error) {
 	return results, err
 }
 
-// // fetch a range of elements starting from key prefix
-// //
-// // fetch all records with the same prefix
-// func (p *Pool) FetchPrefixed(key []byte) []Element {
-
-// 	length := len(key) + 1
-// 	prefixedStart := make([]byte, 1, length)
-// 	prefixedStart[0] = p.prefix
-// 	prefixedStart = append(prefixedStart, key...)
-
-// 	prefixedFinish := make([]byte, length)
-// 	copy(prefixedFinish, prefixedStart)
-
-// loop:
-// 	for i := length - 1; i >= 0; i -= 1 {
-// 		prefixedFinish[i] += 1
-// 		if 0 != prefixedFinish[i] {
-// 			break loop
-// 		}
-// 	}
-
-// 	maxRange := util.Range{
-// 		Start: prefixedStart,  // Start of key range, included in the range
-// 		Limit: prefixedFinish, // Limit of key range, excluded from the range
-// 	}
-
-// 	iter := poolData.database.NewIterator(&maxRange, nil)
-
-// 	results := make([]Element, 0, 100)
-
-// 	for iter.Next() {
-
-// 		// contents of the returned slice must not be modified, and are
-// 		// only valid until the next call to Next
-// 		key := iter.Key()
-// 		value := iter.Value()
-
-// 		dataKey := make([]byte, len(key)-1) // strip the prefix
-// 		copy(dataKey, key[1:])              // ...
-
-// 		dataValue := make([]byte, len(value))
-// 		copy(dataValue, value)
-
-// 		e := Element{
-// 			Key:   dataKey,
-// 			Value: dataValue,
-// 		}
-// 		results = append(results, e)
-// 	}
-// 	iter.Release()
-// 	err := iter.Error()
-// 	fault.PanicIfError("pool.FetchPrefixed", err)
-
-// 	return results
-// }
+// fetch some elements having the same key prefix
+//
+// starts from prefix ++ start and stops at the first key that does
+// not have the prefix, the returned keys do not include the prefix
+func (p *Pool) FetchPrefixed(prefix []byte, start []byte, count int) ([]Element, error) {
+	if count <= 0 {
+		return nil, fault.ErrInvalidCount
+	}
+
+	prefixedStart := make([]byte, 1, len(prefix)+len(start)+1)
+	prefixedStart[0] = p.prefix
+	prefixedStart = append(prefixedStart, prefix...)
+
+	// smallest key greater than all keys having the prefix
+	prefixedFinish := make([]byte, len(prefixedStart))
+	copy(prefixedFinish, prefixedStart)
+	for i := len(prefixedFinish) - 1; i >= 0; i -= 1 {
+		prefixedFinish[i] += 1
+		if 0 != prefixedFinish[i] {
+			prefixedFinish = prefixedFinish[:i+1]
+			break
+		}
+	}
+
+	prefixedStart = append(prefixedStart, start...)
+	strip := len(prefix) + 1
+
+	maxRange := util.Range{
+		Start: prefixedStart,  // Start of key range, included in the range
+		Limit: prefixedFinish, // Limit of key range, excluded from the range
+	}
+
+	iter := poolData.database.NewIterator(&maxRange, nil)
+
+	results := make([]Element, 0, count)
+	n := 0
+	for iter.Next() {
+
+		// contents of the returned slice must not be modified, and are
+		// only valid until the next call to Next
+		key := iter.Key()
+		value := iter.Value()
+
+		dataKey := make([]byte, len(key)-strip) // strip the prefixes
+		copy(dataKey, key[strip:])              // ...
+
+		dataValue := make([]byte, len(value))
+		copy(dataValue, value)
+
+		e := Element{
+			Key:   dataKey,
+			Value: dataValue,
+		}
+		results = append(results, e)
+		n += 1
+		if n >= count {
+			break
+		}
+	}
+	iter.Release()
+	err := iter.Error()
+	return results, err
+}
 
 // fetch the N most recent binary key and data pairs
 //
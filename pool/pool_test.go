@@ -158,3 +158,58 @@ func checkAgain(t *testing.T, empty bool) {
 		t.Errorf("checkAgain: Unexpected data on Get('/nonexistant'), got: '%s'  expected: nil", dn)
 	}
 }
+
+// check fetching is limited to a key prefix
+func TestFetchPrefixed(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p := pool.New(pool.TestData, poolSize)
+
+	poolAdd(t, p, "a\xff", "before")
+	poolAdd(t, p, "b\xff\x00", "one")
+	poolAdd(t, p, "b\xff\x01", "two")
+	poolAdd(t, p, "b\xff\x02", "three")
+	poolAdd(t, p, "c", "after")
+
+	data, err := p.FetchPrefixed([]byte("b\xff"), nil, 2)
+	if nil != err {
+		t.Fatalf("FetchPrefixed error: %v", err)
+	}
+	check := makeElements([]stringElement{
+		{"\x00", "one"},
+		{"\x01", "two"},
+	})
+	compareElements(t, data, check)
+
+	// continue after the last key
+	data, err = p.FetchPrefixed([]byte("b\xff"), []byte("\x02"), 10)
+	if nil != err {
+		t.Fatalf("FetchPrefixed error: %v", err)
+	}
+	check = makeElements([]stringElement{
+		{"\x02", "three"},
+	})
+	compareElements(t, data, check)
+
+	data, err = p.FetchPrefixed([]byte("d"), nil, 10)
+	if nil != err {
+		t.Fatalf("FetchPrefixed error: %v", err)
+	}
+	if 0 != len(data) {
+		t.Errorf("unexpected elements: %q", data)
+	}
+}
+
+// check two element arrays are the same
+func compareElements(t *testing.T, actual []pool.Element, expected []pool.Element) {
+	if len(expected) != len(actual) {
+		t.Errorf("element count: %d  expected: %d", len(actual), len(expected))
+		return
+	}
+	for i, e := range expected {
+		if !bytes.Equal(e.Key, actual[i].Key) || !bytes.Equal(e.Value, actual[i].Value) {
+			t.Errorf("%d: element: %q/%q  expected: %q/%q", i, actual[i].Key, actual[i].Value, e.Key, e.Value)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/peer"
+	"github.com/bitmark-inc/bitmarkd/policy"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"github.com/bitmark-inc/logger"
+)
+
+// --------------------
+
+// e.g.
+// {"id":1,"method":"Admin.Bans","params":[{}]}
+// {"id":2,"method":"Admin.Unban","params":[{"peer":"..."}]}
+// {"id":3,"method":"Admin.Decision","params":[{"txid":"..."}]}
+
+// only available to the configured administrator addresses
+type Admin struct {
+	log     *logger.L
+	client  string
+	allowed bool
+}
+
+// list the peers banned for misbehaviour
+// --------------------------------------
+
+type AdminBansArguments struct{}
+
+type AdminBansReply struct {
+	Bans []peer.Ban `json:"bans"`
+}
+
+func (admin *Admin) Bans(arguments *AdminBansArguments, reply *AdminBansReply) error {
+	if !admin.allowed {
+		return fault.ErrPermissionDenied
+	}
+	bans, err := peer.Bans()
+	if nil != err {
+		return err
+	}
+	reply.Bans = bans
+	return nil
+}
+
+// lift the ban on a peer
+// ----------------------
+
+type AdminUnbanArguments struct {
+	Peer string `json:"peer"`
+}
+
+type AdminUnbanReply struct {
+	Banned bool `json:"banned"` // true if the peer had been banned
+}
+
+func (admin *Admin) Unban(arguments *AdminUnbanArguments, reply *AdminUnbanReply) error {
+	if !admin.allowed {
+		return fault.ErrPermissionDenied
+	}
+	banned, err := peer.Unban(arguments.Peer)
+	if nil != err {
+		return err
+	}
+	admin.log.Infof("client: %s  unbanned peer: %q", admin.client, arguments.Peer)
+	reply.Banned = banned
+	return nil
+}
+
+// why a transaction did or did not need payment
+// ---------------------------------------------
+
+type AdminDecisionArguments struct {
+	TxId transaction.Link `json:"txid"`
+}
+
+type AdminDecisionReply struct {
+	Found    bool             `json:"found"`
+	Decision *policy.Decision `json:"decision"`
+}
+
+func (admin *Admin) Decision(arguments *AdminDecisionArguments, reply *AdminDecisionReply) error {
+	if !admin.allowed {
+		return fault.ErrPermissionDenied
+	}
+	reply.Decision, reply.Found = policy.ReadDecision(arguments.TxId)
+	return nil
+}
+
+// check a client against the administrator addresses
+func isAdministrator(client string, administrators []string) bool {
+	if "" == client {
+		return false
+	}
+	for _, a := range administrators {
+		if a == client {
+			return true
+		}
+	}
+	return false
+}
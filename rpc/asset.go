@@ -15,7 +15,9 @@ import (
 // ----------
 
 type Asset struct {
-	log *logger.L
+	log    *logger.L
+	quota  *ClientQuota
+	client string
 }
 
 // Asset registration
@@ -35,6 +37,11 @@ func (asset *Asset) Register(arguments *transaction.AssetData, reply *AssetRegis
 	log.Infof("Asset.Register: %s", arguments.Fingerprint)
 	log.Infof("Asset.Register: %v", arguments)
 
+	err := asset.quota.allow(asset.client)
+	if nil != err {
+		return err
+	}
+
 	packedAsset, err := arguments.Pack(arguments.Registrant)
 	if nil != err {
 		return err
@@ -53,6 +60,12 @@ func (asset *Asset) Register(arguments *transaction.AssetData, reply *AssetRegis
 
 	// announce transaction to system
 	if !found {
+		if !exists {
+			err = packedAsset.CheckLimits()
+			if nil != err {
+				return err
+			}
+		}
 		messagebus.Send(packedAsset)
 	}
 
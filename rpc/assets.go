@@ -5,6 +5,8 @@
 package rpc
 
 import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/gnomon"
 	"github.com/bitmark-inc/bitmarkd/transaction"
 	"github.com/bitmark-inc/logger"
 )
@@ -67,3 +69,73 @@ func (assets *Assets) Get(arguments *AssetGetArguments, reply *AssetGetReply) er
 
 	return nil
 }
+
+// Assets search
+// -------------
+
+// e.g.
+// {"id":1,"method":"Assets.Search","params":[{"registrant":"base58-address","start":null,"count":10}]}
+
+// only one of name, registrant or fingerprint prefix may be given
+type AssetSearchArguments struct {
+	Name        string         `json:"name"`
+	Registrant  string         `json:"registrant"`
+	Fingerprint string         `json:"fingerprint"`
+	Start       *gnomon.Cursor `json:"start"`
+	Count       int            `json:"count"`
+}
+
+type AssetSearchReply struct {
+	Assets    []transaction.Decoded `json:"assets"`
+	NextStart *gnomon.Cursor        `json:"nextStart"`
+}
+
+// list mined assets in the order they were mined
+func (assets *Assets) Search(arguments *AssetSearchArguments, reply *AssetSearchReply) error {
+
+	log := assets.log
+
+	log.Infof("Assets.Search: %v", arguments)
+
+	if arguments.Count <= 0 {
+		arguments.Count = 10
+	}
+	if arguments.Count > MaximumGetSize {
+		arguments.Count = MaximumGetSize
+	}
+
+	kind := transaction.AssetSearch(0)
+	term := []byte(nil)
+	n := 0
+	if "" != arguments.Name {
+		kind = transaction.SearchName
+		term = []byte(arguments.Name)
+		n += 1
+	}
+	if "" != arguments.Registrant {
+		address, err := transaction.AddressFromBase58(arguments.Registrant)
+		if nil != err {
+			return err
+		}
+		kind = transaction.SearchRegistrant
+		term = address.PublicKeyBytes()
+		n += 1
+	}
+	if "" != arguments.Fingerprint {
+		kind = transaction.SearchFingerprint
+		term = []byte(arguments.Fingerprint)
+		n += 1
+	}
+	if 1 != n {
+		return fault.ErrInvalidSearch
+	}
+
+	txIds, nextStart, err := transaction.SearchAssets(kind, term, arguments.Start, arguments.Count)
+	if nil != err {
+		return err
+	}
+
+	reply.Assets = transaction.Decode(txIds)
+	reply.NextStart = nextStart
+	return nil
+}
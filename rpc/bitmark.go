@@ -17,7 +17,9 @@ import (
 // -------
 
 type Bitmark struct {
-	log *logger.L
+	log    *logger.L
+	quota  *ClientQuota
+	client string
 }
 
 // Bitmark issue
@@ -36,6 +38,11 @@ func (bitmark *Bitmark) Issue(arguments *transaction.BitmarkIssue, reply *Bitmar
 
 	log.Infof("Bitmark.Issue: %v", arguments)
 
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
 	packedIssue, err := arguments.Pack(arguments.Owner)
 	if nil != err {
 		return err
@@ -46,6 +53,10 @@ func (bitmark *Bitmark) Issue(arguments *transaction.BitmarkIssue, reply *Bitmar
 
 	// announce transaction to system
 	if !exists {
+		err = packedIssue.CheckLimits()
+		if nil != err {
+			return err
+		}
 		messagebus.Send(packedIssue)
 	}
 
@@ -59,6 +70,59 @@ func (bitmark *Bitmark) Issue(arguments *transaction.BitmarkIssue, reply *Bitmar
 	return nil
 }
 
+// Bitmark batch issue
+// -------------------
+
+type BitmarkBatchIssueReply struct {
+	TxId           transaction.Link     `json:"txid"`
+	Bitmarks       []transaction.Link   `json:"bitmarks"` // one link for each nonce in the range
+	PaymentAddress []block.MinerAddress `json:"paymentAddress"`
+	Duplicate      bool                 `json:"duplicate"`
+	Err            string               `json:"error,omitempty"`
+}
+
+func (bitmark *Bitmark) BatchIssue(arguments *transaction.BitmarkBatchIssue, reply *BitmarkBatchIssueReply) error {
+
+	log := bitmark.log
+
+	log.Infof("Bitmark.BatchIssue: %v", arguments)
+
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
+	packedBatch, err := arguments.Pack(arguments.Owner)
+	if nil != err {
+		return err
+	}
+
+	// check record
+	id, exists := packedBatch.Exists()
+
+	// announce transaction to system
+	if !exists {
+		err = packedBatch.CheckLimits()
+		if nil != err {
+			return err
+		}
+		messagebus.Send(packedBatch)
+	}
+
+	log.Infof("Bitmark.BatchIssue exists: %v", exists)
+
+	// set up reply
+	reply.TxId = id
+	reply.Bitmarks = make([]transaction.Link, arguments.Count)
+	for i := uint64(0); i < arguments.Count; i += 1 {
+		reply.Bitmarks[i] = transaction.BatchItemLink(id, arguments.Nonce+i)
+	}
+	reply.PaymentAddress = payment.PaymentAddresses()
+	reply.Duplicate = exists
+
+	return nil
+}
+
 // Bitmark transfer
 // ----------------
 
@@ -75,7 +139,16 @@ func (bitmark *Bitmark) Transfer(arguments *transaction.BitmarkTransfer, reply *
 
 	log.Infof("Bitmark.Transfer: %v", arguments)
 
-	state, packedTransaction, found := arguments.Link.Read()
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
+	if _, burned := arguments.Link.Burned(); burned {
+		return fault.ErrBitmarkBurned
+	}
+
+	state, packedTransaction, found := arguments.Link.ReadBitmark()
 	if !found {
 		return fault.ErrLinkNotFound
 	}
@@ -100,12 +173,26 @@ func (bitmark *Bitmark) Transfer(arguments *transaction.BitmarkTransfer, reply *
 			return fault.ErrNotCurrentOwner
 		}
 
+	case *transaction.BitmarkBatchIssue:
+		address = trans.(*transaction.BitmarkBatchIssue).Owner
+		// predecessor must be the current issuer
+		if !arguments.Link.IsOwner(address) {
+			return fault.ErrNotCurrentOwner
+		}
+
 	case *transaction.BitmarkTransfer:
 		address = trans.(*transaction.BitmarkTransfer).Owner
 		// predecessor must be the current owner
 		if !arguments.Link.IsOwner(address) {
 			return fault.ErrNotCurrentOwner
 		}
+
+	case *transaction.BitmarkCountersignedTransfer:
+		address = trans.(*transaction.BitmarkCountersignedTransfer).Owner
+		// predecessor must be the current owner
+		if !arguments.Link.IsOwner(address) {
+			return fault.ErrNotCurrentOwner
+		}
 	default:
 		return fault.ErrInvalidTransactionChain
 	}
@@ -124,6 +211,10 @@ func (bitmark *Bitmark) Transfer(arguments *transaction.BitmarkTransfer, reply *
 
 	// announce transaction to system
 	if !exists {
+		err = packedTransfer.CheckLimits()
+		if nil != err {
+			return err
+		}
 		messagebus.Send(packedTransfer)
 	}
 
@@ -131,6 +222,89 @@ func (bitmark *Bitmark) Transfer(arguments *transaction.BitmarkTransfer, reply *
 	return nil
 }
 
+// Bitmark burn
+// ------------
+
+type BitmarkBurnReply struct {
+	TxId           transaction.Link     `json:"txid"`
+	PaymentAddress []block.MinerAddress `json:"paymentAddress"`
+	Duplicate      bool                 `json:"duplicate"`
+	Err            string               `json:"error,omitempty"`
+}
+
+func (bitmark *Bitmark) Burn(arguments *transaction.BitmarkBurn, reply *BitmarkBurnReply) error {
+
+	log := bitmark.log
+
+	log.Infof("Bitmark.Burn: %v", arguments)
+
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
+	if _, burned := arguments.Link.Burned(); burned {
+		return fault.ErrBitmarkBurned
+	}
+
+	state, packedTransaction, found := arguments.Link.ReadBitmark()
+	if !found {
+		return fault.ErrLinkNotFound
+	}
+
+	// predecessor must already be confirmed
+	if state != transaction.MinedTransaction {
+		return fault.ErrLinksToUnconfirmedTransaction
+	}
+
+	trans, err := packedTransaction.Unpack()
+	if nil != err {
+		return err
+	}
+
+	// only the current owner can burn
+	var address *transaction.Address
+	switch trans.(type) {
+	case *transaction.BitmarkIssue:
+		address = trans.(*transaction.BitmarkIssue).Owner
+	case *transaction.BitmarkBatchIssue:
+		address = trans.(*transaction.BitmarkBatchIssue).Owner
+	case *transaction.BitmarkTransfer:
+		address = trans.(*transaction.BitmarkTransfer).Owner
+	case *transaction.BitmarkCountersignedTransfer:
+		address = trans.(*transaction.BitmarkCountersignedTransfer).Owner
+	default:
+		return fault.ErrInvalidTransactionChain
+	}
+	if !arguments.Link.IsOwner(address) {
+		return fault.ErrNotCurrentOwner
+	}
+
+	packedBurn, err := arguments.Pack(address)
+	if nil != err {
+		return err
+	}
+
+	// check record
+	id, exists := packedBurn.Exists()
+
+	reply.Duplicate = exists
+	reply.TxId = id
+	reply.PaymentAddress = payment.PaymentAddresses()
+
+	// announce transaction to system
+	if !exists {
+		err = packedBurn.CheckLimits()
+		if nil != err {
+			return err
+		}
+		messagebus.Send(packedBurn)
+	}
+
+	log.Infof("Bitmark.Burn exists: %v", exists)
+	return nil
+}
+
 // Trace the history of a property
 // -------------------------------
 
@@ -161,9 +335,14 @@ func (bitmark *Bitmark) Provenance(arguments *ProvenanceArguments, reply *Proven
 
 	provenance := make([]ProvenanceRecord, 0, count)
 
+	// a burned bitmark starts from its terminal record
+	if burnTxId, burned := id.Burned(); burned {
+		id = burnTxId
+	}
+
 loop:
 	for i := 0; i < count; i += 1 {
-		state, data, found := id.Read()
+		state, data, found := id.ReadBitmark()
 		if !found {
 			break loop
 		}
@@ -191,10 +370,25 @@ loop:
 			}
 			//id = tx.(*transaction.BitmarkIssue).Link
 
+		case *transaction.BitmarkBatchIssue:
+			record = "BitmarkBatchIssue"
+			_, id, found = tx.(*transaction.BitmarkBatchIssue).AssetIndex.Read()
+			if !found {
+				done = true
+			}
+
 		case *transaction.BitmarkTransfer:
 			record = "BitmarkTransfer"
 			id = tx.(*transaction.BitmarkTransfer).Link
 
+		case *transaction.BitmarkCountersignedTransfer:
+			record = "BitmarkCountersignedTransfer"
+			id = tx.(*transaction.BitmarkCountersignedTransfer).Link
+
+		case *transaction.BitmarkBurn:
+			record = "BitmarkBurn"
+			id = tx.(*transaction.BitmarkBurn).Link
+
 		default:
 			break loop
 		}
@@ -214,3 +408,33 @@ loop:
 
 	return nil
 }
+
+// Export the provenance of a property for offline checking
+// --------------------------------------------------------
+
+type CertificateArguments struct {
+	TxId transaction.Link `json:"txid"`
+}
+
+type CertificateReply struct {
+	Certificate *transaction.Certificate `json:"certificate"`
+}
+
+func (bitmark *Bitmark) Certificate(arguments *CertificateArguments, reply *CertificateReply) error {
+	log := bitmark.log
+
+	log.Infof("Bitmark.Certificate: %v", arguments)
+
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
+	certificate, err := arguments.TxId.Certificate()
+	if nil != err {
+		return err
+	}
+
+	reply.Certificate = certificate
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/bitmark-inc/bitmarkd/block"
 	"github.com/bitmark-inc/bitmarkd/difficulty"
 	"github.com/bitmark-inc/bitmarkd/gnomon"
+	"github.com/bitmark-inc/bitmarkd/mine"
 	"github.com/bitmark-inc/bitmarkd/mode"
 	"github.com/bitmark-inc/bitmarkd/transaction"
 	"github.com/bitmark-inc/logger"
@@ -87,3 +88,17 @@ func (node *Node) Info(arguments *InfoArguments, reply *InfoReply) error {
 
 	return nil
 }
+
+// return statistics of the connected miners
+// ------------------------------------------
+
+type MiningArguments struct{}
+
+type MiningReply struct {
+	mine.PoolStatistics
+}
+
+func (node *Node) Mining(arguments *MiningArguments, reply *MiningReply) error {
+	reply.PoolStatistics = mine.Statistics()
+	return nil
+}
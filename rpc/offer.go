@@ -0,0 +1,262 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/messagebus"
+	"github.com/bitmark-inc/bitmarkd/payment"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"sync"
+	"time"
+)
+
+// limits on outstanding offers
+const (
+	maximumOffers = 1000
+	offerLifetime = 24 * time.Hour // longest time an offer is kept
+)
+
+// an offer signed by the current owner waiting for the new owner
+type offer struct {
+	transfer transaction.BitmarkCountersignedTransfer
+	address  *transaction.Address // previous owner
+	expires  time.Time
+}
+
+// outstanding offers shared by all connections
+//
+// only the latest offer for each bitmark is kept, so one owner
+// cannot fill the store by varying the other fields
+type offerStore struct {
+	sync.Mutex
+	items map[transaction.Link]*offer           // offer id → offer
+	links map[transaction.Link]transaction.Link // bitmark link → offer id
+}
+
+var offers = newOfferStore()
+
+func newOfferStore() *offerStore {
+	return &offerStore{
+		items: make(map[transaction.Link]*offer),
+		links: make(map[transaction.Link]transaction.Link),
+	}
+}
+
+// store an offer replacing any earlier offer for the same bitmark
+func (store *offerStore) add(offerId transaction.Link, o *offer, now time.Time) error {
+	store.Lock()
+	defer store.Unlock()
+
+	// discard any stale offers before checking the limit
+	for id, item := range store.items {
+		if now.After(item.expires) {
+			store.remove(id)
+		}
+	}
+
+	if previous, found := store.links[o.transfer.Link]; found {
+		store.remove(previous)
+	}
+	if len(store.items) >= maximumOffers {
+		return fault.ErrTooManyOffers
+	}
+	store.items[offerId] = o
+	store.links[o.transfer.Link] = offerId
+	return nil
+}
+
+// fetch an offer
+func (store *offerStore) get(offerId transaction.Link) (*offer, bool) {
+	store.Lock()
+	defer store.Unlock()
+	o, found := store.items[offerId]
+	return o, found
+}
+
+// remove an offer that was accepted
+func (store *offerStore) accepted(offerId transaction.Link) {
+	store.Lock()
+	defer store.Unlock()
+	store.remove(offerId)
+}
+
+// only call while locked
+func (store *offerStore) remove(offerId transaction.Link) {
+	o, found := store.items[offerId]
+	if !found {
+		return
+	}
+	delete(store.items, offerId)
+	if id, found := store.links[o.transfer.Link]; found && offerId == id {
+		delete(store.links, o.transfer.Link)
+	}
+}
+
+// Bitmark offer
+// -------------
+
+type BitmarkOfferReply struct {
+	OfferId     transaction.Link   `json:"offerId"`
+	Countersign transaction.Packed `json:"countersign"` // the bytes the new owner must sign
+	Expires     time.Time          `json:"expires"`
+}
+
+// first step of a countersigned transfer
+//
+// the arguments are signed by the current owner, the countersignature
+// is ignored
+func (bitmark *Bitmark) Offer(arguments *transaction.BitmarkCountersignedTransfer, reply *BitmarkOfferReply) error {
+
+	log := bitmark.log
+
+	log.Infof("Bitmark.Offer: %v", arguments)
+
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if arguments.IsExpired(now) {
+		return fault.ErrTransferExpired
+	}
+
+	if _, burned := arguments.Link.Burned(); burned {
+		return fault.ErrBitmarkBurned
+	}
+
+	state, packedTransaction, found := arguments.Link.ReadBitmark()
+	if !found {
+		return fault.ErrLinkNotFound
+	}
+
+	// predecessor must already be confirmed
+	if state != transaction.MinedTransaction {
+		return fault.ErrLinksToUnconfirmedTransaction
+	}
+
+	trans, err := packedTransaction.Unpack()
+	if nil != err {
+		return err
+	}
+
+	// extract address and exclude impossible chain links
+	var address *transaction.Address
+	switch trans.(type) {
+	case *transaction.BitmarkIssue:
+		address = trans.(*transaction.BitmarkIssue).Owner
+	case *transaction.BitmarkBatchIssue:
+		address = trans.(*transaction.BitmarkBatchIssue).Owner
+	case *transaction.BitmarkTransfer:
+		address = trans.(*transaction.BitmarkTransfer).Owner
+	case *transaction.BitmarkCountersignedTransfer:
+		address = trans.(*transaction.BitmarkCountersignedTransfer).Owner
+	default:
+		return fault.ErrInvalidTransactionChain
+	}
+	if !arguments.Link.IsOwner(address) {
+		return fault.ErrNotCurrentOwner
+	}
+
+	packedOffer, err := arguments.Offer(address)
+	if nil != err {
+		return err
+	}
+
+	// never kept longer than the lifetime even if the transfer
+	// expires later
+	expires := now.Add(offerLifetime)
+	if 0 != arguments.Expiry {
+		if e := time.Unix(int64(arguments.Expiry), 0).UTC(); e.Before(expires) {
+			expires = e
+		}
+	}
+
+	o := &offer{
+		transfer: *arguments,
+		address:  address,
+		expires:  expires,
+	}
+	o.transfer.Countersignature = nil
+
+	offerId := packedOffer.MakeLink()
+
+	err = offers.add(offerId, o, now)
+	if nil != err {
+		return err
+	}
+
+	reply.OfferId = offerId
+	reply.Countersign = packedOffer
+	reply.Expires = expires
+
+	log.Infof("Bitmark.Offer id: %#v", offerId)
+	return nil
+}
+
+// Bitmark accept
+// --------------
+
+type BitmarkAcceptArguments struct {
+	OfferId          transaction.Link      `json:"offerId"`
+	Countersignature transaction.Signature `json:"countersignature"`
+}
+
+// second step of a countersigned transfer
+//
+// the new owner's countersignature completes the transfer which is
+// then submitted in the same way as any other transfer
+func (bitmark *Bitmark) Accept(arguments *BitmarkAcceptArguments, reply *BitmarkTransferReply) error {
+
+	log := bitmark.log
+
+	log.Infof("Bitmark.Accept: %v", arguments)
+
+	err := bitmark.quota.allow(bitmark.client)
+	if nil != err {
+		return err
+	}
+
+	o, found := offers.get(arguments.OfferId)
+	if !found {
+		return fault.ErrOfferNotFound
+	}
+	if time.Now().After(o.expires) {
+		return fault.ErrTransferExpired
+	}
+
+	transfer := o.transfer
+	transfer.Countersignature = arguments.Countersignature
+
+	packedTransfer, err := transfer.Pack(o.address)
+	if nil != err {
+		return err
+	}
+
+	// check record
+	id, exists := packedTransfer.Exists()
+	if !exists {
+		err = packedTransfer.CheckLimits()
+		if nil != err {
+			return err
+		}
+	}
+
+	// only remove once a valid countersignature is received
+	offers.accepted(arguments.OfferId)
+
+	reply.Duplicate = exists
+	reply.TxId = id
+	reply.PaymentAddress = payment.PaymentAddresses()
+
+	// announce transaction to system
+	if !exists {
+		messagebus.Send(packedTransfer)
+	}
+
+	log.Infof("Bitmark.Accept exists: %v", exists)
+	return nil
+}
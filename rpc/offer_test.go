@@ -0,0 +1,95 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"testing"
+	"time"
+)
+
+// an offer for a bitmark
+func testOffer(bitmark byte, expires time.Time) *offer {
+	o := &offer{
+		expires: expires,
+	}
+	o.transfer.Link[0] = bitmark
+	return o
+}
+
+// an offer id
+func testOfferId(n int) transaction.Link {
+	id := transaction.Link{}
+	id[0] = byte(n)
+	id[1] = byte(n >> 8)
+	return id
+}
+
+// test only the latest offer for a bitmark is kept
+func TestOfferReplace(t *testing.T) {
+
+	now := time.Now()
+	store := newOfferStore()
+
+	if err := store.add(testOfferId(1), testOffer(1, now.Add(time.Hour)), now); nil != err {
+		t.Fatalf("first offer: error: %v", err)
+	}
+	if err := store.add(testOfferId(2), testOffer(1, now.Add(2*time.Hour)), now); nil != err {
+		t.Fatalf("second offer: error: %v", err)
+	}
+	if _, found := store.get(testOfferId(1)); found {
+		t.Errorf("replaced offer still present")
+	}
+	if _, found := store.get(testOfferId(2)); !found {
+		t.Errorf("latest offer missing")
+	}
+
+	// accepting the replaced offer does not remove the latest
+	store.accepted(testOfferId(1))
+	if 1 != len(store.items) || 1 != len(store.links) {
+		t.Errorf("items: %d  links: %d  expected: 1", len(store.items), len(store.links))
+	}
+	store.accepted(testOfferId(2))
+	if 0 != len(store.items) || 0 != len(store.links) {
+		t.Errorf("items: %d  links: %d  after accept", len(store.items), len(store.links))
+	}
+}
+
+// test the limit on offers for different bitmarks
+func TestOfferLimit(t *testing.T) {
+
+	now := time.Now()
+	store := newOfferStore()
+
+	for n := 0; n < maximumOffers; n += 1 {
+		o := testOffer(0, now.Add(time.Hour))
+		o.transfer.Link = testOfferId(n)
+		if err := store.add(testOfferId(n), o, now); nil != err {
+			t.Fatalf("%d: error: %v", n, err)
+		}
+	}
+
+	o := testOffer(0, now.Add(time.Hour))
+	o.transfer.Link = testOfferId(maximumOffers)
+	if err := store.add(testOfferId(maximumOffers), o, now); fault.ErrTooManyOffers != err {
+		t.Errorf("expected ErrTooManyOffers but got: %v", err)
+	}
+
+	// a new offer for an existing bitmark replaces it
+	o = testOffer(0, now.Add(time.Hour))
+	o.transfer.Link = testOfferId(0)
+	if err := store.add(testOfferId(maximumOffers+1), o, now); nil != err {
+		t.Errorf("replacement: error: %v", err)
+	}
+
+	// expired offers make room
+	if err := store.add(testOfferId(maximumOffers), testOffer(0xff, now.Add(3*time.Hour)), now.Add(2*time.Hour)); nil != err {
+		t.Errorf("after expiry: error: %v", err)
+	}
+	if 1 != len(store.items) {
+		t.Errorf("items: %d  expected: 1", len(store.items))
+	}
+}
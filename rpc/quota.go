@@ -0,0 +1,79 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"sync"
+	"time"
+)
+
+// period over which client submissions are counted
+const quotaWindow = time.Minute
+
+// limit the number of submissions from each client address
+//
+// shared by all connections so that opening more connections does
+// not increase the quota
+type ClientQuota struct {
+	sync.Mutex
+	limit   uint64
+	clients map[string]*quotaCount
+	purged  time.Time
+}
+
+// submissions in the current window of one client
+type quotaCount struct {
+	start time.Time
+	count uint64
+}
+
+// create a quota of submissions per minute
+//
+// zero is unlimited
+func NewClientQuota(perMinute uint64) *ClientQuota {
+	return &ClientQuota{
+		limit:   perMinute,
+		clients: make(map[string]*quotaCount),
+	}
+}
+
+// count a submission and check it is within the quota
+func (quota *ClientQuota) allow(client string) error {
+	if nil == quota || 0 == quota.limit {
+		return nil
+	}
+	return quota.allowAt(client, time.Now())
+}
+
+// count a submission at a specific time
+func (quota *ClientQuota) allowAt(client string, now time.Time) error {
+	quota.Lock()
+	defer quota.Unlock()
+
+	// discard clients that have been idle for a whole window
+	if now.Sub(quota.purged) >= quotaWindow {
+		for c, q := range quota.clients {
+			if now.Sub(q.start) >= quotaWindow {
+				delete(quota.clients, c)
+			}
+		}
+		quota.purged = now
+	}
+
+	q, found := quota.clients[client]
+	if !found || now.Sub(q.start) >= quotaWindow {
+		q = &quotaCount{
+			start: now,
+		}
+		quota.clients[client] = q
+	}
+
+	if q.count >= quota.limit {
+		return fault.ErrClientQuotaExceeded
+	}
+	q.count += 1
+	return nil
+}
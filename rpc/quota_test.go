@@ -0,0 +1,48 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"testing"
+	"time"
+)
+
+// check submissions are limited in each window
+func TestClientQuota(t *testing.T) {
+
+	quota := NewClientQuota(3)
+	start := time.Now()
+
+	for i := 0; i < 3; i += 1 {
+		if err := quota.allowAt("192.0.2.1", start); nil != err {
+			t.Fatalf("%d: allow error: %v", i, err)
+		}
+	}
+	if err := quota.allowAt("192.0.2.1", start.Add(time.Second)); fault.ErrClientQuotaExceeded != err {
+		t.Errorf("over quota: expected ErrClientQuotaExceeded but got: %v", err)
+	}
+
+	// other clients are not affected
+	if err := quota.allowAt("192.0.2.2", start.Add(time.Second)); nil != err {
+		t.Errorf("second client: allow error: %v", err)
+	}
+
+	// next window
+	if err := quota.allowAt("192.0.2.1", start.Add(quotaWindow+2*time.Second)); nil != err {
+		t.Errorf("next window: allow error: %v", err)
+	}
+	if _, found := quota.clients["192.0.2.2"]; found {
+		t.Errorf("idle client was not purged")
+	}
+
+	// zero is unlimited
+	unlimited := NewClientQuota(0)
+	for i := 0; i < 100; i += 1 {
+		if err := unlimited.allow("192.0.2.1"); nil != err {
+			t.Fatalf("%d: unlimited: allow error: %v", i, err)
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package rpc
 
 import (
+	"github.com/bitmark-inc/bitmarkd/util"
 	"github.com/bitmark-inc/logger"
 	"io"
 	"net/rpc"
@@ -16,7 +17,9 @@ const MaximumGetSize = 50
 
 // the argument passed to the callback
 type ServerArgument struct {
-	Log *logger.L
+	Log   *logger.L
+	Quota *ClientQuota // nil for no limit on submissions
+	Admin []string     // client addresses allowed to use the Admin RPCs
 }
 
 // listener callback
@@ -30,8 +33,19 @@ func Callback(conn io.ReadWriteCloser, argument interface{}) {
 		panic("rpc: nil serverArgument.Log ")
 	}
 
+	// a client that cannot be identified would share the quota of
+	// all other such clients, so it is not served
+	client, err := util.ClientAddress(conn)
+	if nil != err {
+		serverArgument.Log.Errorf("client address: error: %v", err)
+		conn.Close()
+		return
+	}
+
 	asset := &Asset{
-		log: serverArgument.Log,
+		log:    serverArgument.Log,
+		quota:  serverArgument.Quota,
+		client: client,
 	}
 
 	assets := &Assets{
@@ -40,7 +54,9 @@ func Callback(conn io.ReadWriteCloser, argument interface{}) {
 	}
 
 	bitmark := &Bitmark{
-		log: serverArgument.Log,
+		log:    serverArgument.Log,
+		quota:  serverArgument.Quota,
+		client: client,
 	}
 
 	bitmarks := &Bitmarks{
@@ -60,7 +76,14 @@ func Callback(conn io.ReadWriteCloser, argument interface{}) {
 		log: serverArgument.Log,
 	}
 
+	admin := &Admin{
+		log:     serverArgument.Log,
+		client:  client,
+		allowed: isAdministrator(client, serverArgument.Admin),
+	}
+
 	server := rpc.NewServer()
+	server.Register(admin)
 	server.Register(asset)
 	server.Register(assets)
 	server.Register(bitmark)
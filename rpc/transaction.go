@@ -68,18 +68,79 @@ func (t *Transaction) Get(arguments *TransactionGetArguments, reply *Transaction
 	return nil
 }
 
+// payment quote for unpaid transactions
+// --------------------------------------
+
+type TransactionQuoteArguments struct {
+	TxIds []transaction.Link `json:"txids"`
+}
+
+type TransactionQuoteReply struct {
+	Transactions []payment.QuoteItem     `json:"transactions"`
+	Payments     []payment.CurrencyQuote `json:"payments"`
+}
+
+func (t *Transaction) Quote(arguments *TransactionQuoteArguments, reply *TransactionQuoteReply) error {
+
+	// restrict arguments size to reasonable value
+	size := len(arguments.TxIds)
+	if size > MaximumGetSize {
+		size = MaximumGetSize
+	}
+
+	txIds := arguments.TxIds[:size]
+
+	reply.Transactions, reply.Payments = payment.Quote(txIds)
+	return nil
+}
+
 // fetch all pending transactions
 // ------------------------------
 
+// e.g.
+// {"id":1,"method":"Transaction.Pending","params":[{"start":0,"count":10,"states":["Unpaid"],"types":["BitmarkIssue"],"address":"base58-address"}]}
+
 type TransactionPendingArguments struct {
+	Start   transaction.IndexCursor `json:"start"`
+	Count   int                     `json:"count"`
+	States  []transaction.State     `json:"states"`  // Unpaid, Waiting or Available
+	Types   []string                `json:"types"`   // e.g. AssetData, BitmarkIssue
+	Address string                  `json:"address"` // owner or registrant
 }
 
 type TransactionPendingReply struct {
-	Transactions []transaction.Decoded `json:"transactions"`
+	Transactions []transaction.Decoded   `json:"transactions"`
+	NextStart    transaction.IndexCursor `json:"nextStart"`
 }
 
 func (t *Transaction) Pending(arguments *TransactionPendingArguments, reply *TransactionPendingReply) error {
 
-	reply.Transactions = transaction.FetchPending()
+	if arguments.Count <= 0 {
+		arguments.Count = 10
+	}
+	if arguments.Count > MaximumGetSize {
+		arguments.Count = MaximumGetSize
+	}
+
+	filter := transaction.PendingFilter{
+		States: arguments.States,
+		Types:  arguments.Types,
+	}
+	if "" != arguments.Address {
+		address, err := transaction.AddressFromBase58(arguments.Address)
+		if nil != err {
+			return err
+		}
+		filter.Address = address
+	}
+
+	cursor := arguments.Start
+	transactions, err := cursor.FetchPending(arguments.Count, &filter)
+	if nil != err {
+		return err
+	}
+
+	reply.Transactions = transactions
+	reply.NextStart = cursor
 	return nil
 }
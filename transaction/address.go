@@ -16,8 +16,9 @@ import (
 // enumeration of supported key algorithms
 const (
 	// list of valid algorithms
-	Nothing = iota // zero keytype **Just for Testing**
-	ED25519 = iota
+	Nothing   = iota // zero keytype **Just for Testing**
+	ED25519   = iota
+	SECP256K1 = iota
 	// end of list (one greater than last item)
 	algorithmLimit = iota
 )
@@ -57,6 +58,14 @@ type ED25519Address struct {
 	PublicKey *[ed25519.PublicKeySize]byte
 }
 
+// for secp256k1 ECDSA signatures
+//
+// the public key is in the 33 byte compressed form
+type SECP256K1Address struct {
+	Test      bool
+	PublicKey *[secp256k1PublicKeySize]byte
+}
+
 // just for debugging
 type NothingAddress struct {
 	Test      bool
@@ -123,6 +132,22 @@ func AddressFromBase58(addressBase58Encoded string) (*Address, error) {
 			},
 		}
 		return address, nil
+	case SECP256K1:
+		if keyLength != secp256k1PublicKeySize {
+			return nil, fault.ErrInvalidKeyLength
+		}
+		publicKey := [secp256k1PublicKeySize]byte{}
+		copy(publicKey[:], addressDecoded[keyVariantLength:checksumStart])
+		if _, ok := secp256k1ParsePublicKey(publicKey[:]); !ok {
+			return nil, fault.ErrNotPublicKey
+		}
+		address := &Address{
+			AddressInterface: &SECP256K1Address{
+				Test:      isTest,
+				PublicKey: &publicKey,
+			},
+		}
+		return address, nil
 	case Nothing:
 		if 2 != keyLength {
 			return nil, fault.ErrInvalidKeyLength
@@ -188,6 +213,22 @@ func AddressFromBytes(addressBytes []byte) (*Address, error) {
 			},
 		}
 		return address, nil
+	case SECP256K1:
+		if keyLength != secp256k1PublicKeySize {
+			return nil, fault.ErrInvalidKeyLength
+		}
+		publicKey := [secp256k1PublicKeySize]byte{}
+		copy(publicKey[:], addressBytes[keyVariantLength:])
+		if _, ok := secp256k1ParsePublicKey(publicKey[:]); !ok {
+			return nil, fault.ErrNotPublicKey
+		}
+		address := &Address{
+			AddressInterface: &SECP256K1Address{
+				Test:      isTest,
+				PublicKey: &publicKey,
+			},
+		}
+		return address, nil
 	case Nothing:
 		if 2 != keyLength {
 			return nil, fault.ErrInvalidKeyLength
@@ -280,6 +321,69 @@ func (address ED25519Address) MarshalJSON() ([]byte, error) {
 	return b, nil
 }
 
+// SECP256K1
+// ---------
+
+// key type code (see enumeration above)
+func (address *SECP256K1Address) KeyType() int {
+	return SECP256K1
+}
+
+// fetch the public key as byte slice
+func (address *SECP256K1Address) PublicKeyBytes() []byte {
+	return address.PublicKey[:]
+}
+
+// check the signature of a message
+//
+// the signature is strict DER encoded with a low S value and covers
+// the SHA-256 digest of the message
+func (address *SECP256K1Address) CheckSignature(message []byte, signature Signature) error {
+
+	publicKey, ok := secp256k1ParsePublicKey(address.PublicKey[:])
+	if !ok {
+		return fault.ErrInvalidSignature
+	}
+
+	r, s, ok := secp256k1ParseSignature(signature)
+	if !ok {
+		return fault.ErrInvalidSignature
+	}
+
+	digest := sha256.Sum256(message)
+	if !secp256k1Verify(publicKey, digest[:], r, s) {
+		return fault.ErrInvalidSignature
+	}
+	return nil
+}
+
+// byte slice for encoded key
+func (address *SECP256K1Address) Bytes() []byte {
+	keyVariant := byte(SECP256K1<<algorithmShift) | publicKeyCode
+	if address.Test {
+		keyVariant |= testKeyCode
+	}
+	return append([]byte{keyVariant}, address.PublicKey[:]...)
+}
+
+// base58 encoding of encoded key
+func (address *SECP256K1Address) String() string {
+	buffer := address.Bytes()
+	firstRound := sha256.Sum256(buffer)
+	checksum := sha256.Sum256(firstRound[:])
+	buffer = append(buffer, checksum[:checksumLength]...)
+	return util.ToBase58(buffer)
+}
+
+// convert an address to its Base58 JSON form
+func (address SECP256K1Address) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 1)
+	b[0] = '"'
+	b = append(b, address.String()...)
+	b = append(b, '"')
+	return b, nil
+}
+
 // Nothing
 // -------
 
@@ -7,6 +7,7 @@ package transaction_test
 import (
 	"bytes"
 	"encoding/hex"
+	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/transaction"
 	"testing"
 )
@@ -22,6 +23,7 @@ type addressTest struct {
 // Valid address
 var testAddress = []addressTest{
 	{transaction.ED25519, decodeHex("60b3c6e20cfff7091a86488b1656b96ec0a2f69907e2c035175918f42c37d72e"), "anF8SWxSRY5vnN3Bbyz9buRYW1hfCAAZxfbv8Fw9SFXanoTNEq"},
+	{transaction.SECP256K1, decodeHex("020078069e73d1570a4a1c6bb0f2cca41d3d579e6b62649c349f5453c41f827a60"), "5tChZeyRDZi971WgA57KsYghZuarpp52bKkpfEAQcPu9sxf5KfBg"},
 	{transaction.Nothing, decodeHex("12fa"), "3MvzKPwWD"},
 }
 
@@ -77,6 +79,71 @@ func TestAddress(t *testing.T) {
 	}
 }
 
+// secp256k1 signature over the SHA-256 of the message
+func TestSECP256K1Signature(t *testing.T) {
+
+	address, err := transaction.AddressFromBase58("5tChZeyRDZi971WgA57KsYghZuarpp52bKkpfEAQcPu9sxf5KfBg")
+	if nil != err {
+		t.Fatalf("address error: %v", err)
+	}
+
+	message := []byte("bitmark secp256k1 test vector")
+	signature := transaction.Signature(decodeHex("304402204d13f84ee7819ca69be09571558ec825c3a3078a8e228b8e1904be58431a3c360220640f75b602f9a4daabaa1065357ffc016ca98f02db761363f48faada2d418d06"))
+
+	if err := address.CheckSignature(message, signature); nil != err {
+		t.Errorf("valid signature failed: %v", err)
+	}
+
+	// altered message
+	if err := address.CheckSignature([]byte("bitmark secp256k1 test vectors"), signature); fault.ErrInvalidSignature != err {
+		t.Errorf("altered message: expected ErrInvalidSignature but got: %v", err)
+	}
+
+	// not DER encoded
+	if err := address.CheckSignature(message, signature[4:]); fault.ErrInvalidSignature != err {
+		t.Errorf("raw signature: expected ErrInvalidSignature but got: %v", err)
+	}
+
+	// the same signature with S replaced by N-S is valid ECDSA but
+	// must not be accepted
+	highS := transaction.Signature(decodeHex("304502204d13f84ee7819ca69be09571558ec825c3a3078a8e228b8e1904be58431a3c360221009bf08a49fd065b255455ef9aca8003fd4e054de3d3d28cd7cb42b3b2a2f4b43b"))
+	if err := address.CheckSignature(message, highS); fault.ErrInvalidSignature != err {
+		t.Errorf("high S: expected ErrInvalidSignature but got: %v", err)
+	}
+
+	// non-minimal length encoding
+	padded := append([]byte{0x30, 0x81, byte(len(signature) - 2)}, signature[2:]...)
+	if err := address.CheckSignature(message, transaction.Signature(padded)); fault.ErrInvalidSignature != err {
+		t.Errorf("non-strict DER: expected ErrInvalidSignature but got: %v", err)
+	}
+
+	// x coordinate that is not on the curve
+	buffer := []byte{byte(transaction.SECP256K1<<4 | 0x01), 0x02}
+	buffer = append(buffer, bytes.Repeat([]byte{0xff}, 32)...)
+	if _, err := transaction.AddressFromBytes(buffer); nil == err {
+		t.Errorf("invalid public key was accepted")
+	}
+}
+
+// time to verify a secp256k1 signature
+func BenchmarkSECP256K1Signature(b *testing.B) {
+
+	address, err := transaction.AddressFromBase58("5tChZeyRDZi971WgA57KsYghZuarpp52bKkpfEAQcPu9sxf5KfBg")
+	if nil != err {
+		b.Fatalf("address error: %v", err)
+	}
+
+	message := []byte("bitmark secp256k1 test vector")
+	signature := transaction.Signature(decodeHex("304402204d13f84ee7819ca69be09571558ec825c3a3078a8e228b8e1904be58431a3c360220640f75b602f9a4daabaa1065357ffc016ca98f02db761363f48faada2d418d06"))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		if err := address.CheckSignature(message, signature); nil != err {
+			b.Fatalf("valid signature failed: %v", err)
+		}
+	}
+}
+
 // Decode the hex string and return []byte.
 //
 // This is only used in the tests as the source is pre-prepared, so that there won't be any error
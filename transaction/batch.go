@@ -0,0 +1,68 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"encoding/binary"
+	"github.com/bitmark-inc/bitmarkd/block"
+)
+
+// compute the link of a single bitmark from a batch issue
+//
+// this is the link that is used in the ownership index and as the
+// previous record for the first transfer of the bitmark
+func BatchItemLink(batchTxId Link, nonce uint64) Link {
+	buffer := make([]byte, LinkSize+8)
+	copy(buffer, batchTxId[:])
+	binary.BigEndian.PutUint64(buffer[LinkSize:], nonce)
+	return Link(block.NewDigest(buffer))
+}
+
+// find the batch issue of a bitmark
+//
+// returns:
+//   transaction ID of the batch issue
+//   nonce of the bitmark
+//   true if the link is a bitmark expanded from a batch issue
+func (link Link) BatchItem() (Link, uint64, bool) {
+	batchData, found := transactionPool.batchPool.Get(link.Bytes())
+	if !found || LinkSize+8 != len(batchData) {
+		return Link{}, 0, false
+	}
+	var batchTxId Link
+	err := LinkFromBytes(&batchTxId, batchData[:LinkSize])
+	if nil != err {
+		return Link{}, 0, false
+	}
+	return batchTxId, binary.BigEndian.Uint64(batchData[LinkSize:]), true
+}
+
+// read a bitmark record
+//
+// as Read() except that a bitmark expanded from a batch issue
+// returns the batch issue record
+func (link Link) ReadBitmark() (State, Packed, bool) {
+	state, packed, found := link.Read()
+	if found {
+		return state, packed, true
+	}
+	batchTxId, _, found := link.BatchItem()
+	if !found {
+		return ExpiredTransaction, nil, false
+	}
+	return batchTxId.Read()
+}
+
+// the asset index from either kind of issue record
+func issueAssetIndex(record interface{}) AssetIndex {
+	switch record.(type) {
+	case *BitmarkIssue:
+		return record.(*BitmarkIssue).AssetIndex
+	case *BitmarkBatchIssue:
+		return record.(*BitmarkBatchIssue).AssetIndex
+	default:
+		return AssetIndex{}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+// find the burn record of a bitmark
+//
+// returns:
+//   transaction ID of the BitmarkBurn record
+//   true if the bitmark has been burned
+func (link Link) Burned() (Link, bool) {
+	burnTxId, found := transactionPool.burnPool.Get(link.Bytes())
+	if !found {
+		return Link{}, false
+	}
+	var burn Link
+	err := LinkFromBytes(&burn, burnTxId)
+	if nil != err {
+		return Link{}, false
+	}
+	return burn, true
+}
+
+// the previous bitmark from either kind of record that moves a bitmark
+func bitmarkLink(record interface{}) Link {
+	switch record.(type) {
+	case *BitmarkTransfer:
+		return record.(*BitmarkTransfer).Link
+	case *BitmarkBurn:
+		return record.(*BitmarkBurn).Link
+	case *BitmarkCountersignedTransfer:
+		return record.(*BitmarkCountersignedTransfer).Link
+	default:
+		return Link{}
+	}
+}
+
+// internal routines - only call while transactionPool locked
+// ------------------------------------------------------------
+
+// check if a bitmark already has a pending transfer or burn
+func isSpent(previous Link) bool {
+	_, found := transactionPool.spends[previous]
+	return found
+}
+
+// record a pending transfer or burn
+func trackSpend(tx interface{}, link Link) {
+	transactionPool.spends[bitmarkLink(tx)] = link
+}
+
+// rebuild a pending transfer or burn on start up
+func restoreSpend(txId []byte) {
+	data, found := transactionPool.dataPool.Get(txId)
+	if !found {
+		return
+	}
+	tx, err := Packed(data).Unpack()
+	if nil != err {
+		return
+	}
+	switch tx.(type) {
+	case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
+		var link Link
+		if err := LinkFromBytes(&link, txId); nil == err && !isSpent(bitmarkLink(tx)) {
+			trackSpend(tx, link)
+		}
+	}
+}
+
+// release a transfer or burn that is no longer pending
+//
+// tx may be any record, only a transfer or burn is released
+func untrackSpend(tx interface{}, link Link) {
+	switch tx.(type) {
+	case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
+	default:
+		return
+	}
+	previous := bitmarkLink(tx)
+	if l, found := transactionPool.spends[previous]; found && l == link {
+		delete(transactionPool.spends, previous)
+	}
+}
+
+// remove a pending transfer or burn of a bitmark that a mined record
+// has moved, as it can never be mined
+func expireConflicting(previous Link, mined Link) {
+	other, found := transactionPool.spends[previous]
+	if !found || other == mined {
+		return
+	}
+	delete(transactionPool.spends, previous)
+
+	state, found := transactionPool.statePool.Get(other.Bytes())
+	if !found {
+		return
+	}
+	index := make([]byte, 8)
+	copy(index, state[1:])
+
+	switch State(state[0]) {
+	case UnpaidTransaction:
+		transactionPool.log.Infof("expire conflicting unpaid: %#v", other)
+		expireUnpaid(other, index)
+
+	case AvailableTransaction:
+		transactionPool.log.Infof("expire conflicting available: %#v", other)
+		txId := other.Bytes()
+		transactionPool.availablePool.Remove(index)
+		transactionPool.statePool.Remove(txId)
+		transactionPool.dataPool.Remove(txId)
+
+		// mutex is locked: so safe to decrement counter
+		transactionPool.availableCounter -= 1
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"crypto/rand"
+	"github.com/agl/ed25519"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/mode"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"os"
+	"testing"
+)
+
+// test database file
+const spendDatabase = "spend.leveldb"
+
+// test only one pending transfer or burn of a bitmark is accepted
+func TestDoubleSpend(t *testing.T) {
+	os.RemoveAll(spendDatabase)
+	pool.Initialise(spendDatabase)
+	defer func() {
+		Finalise()
+		transactionPool.initialised = false
+		pool.Finalise()
+		os.RemoveAll(spendDatabase)
+	}()
+
+	Initialise(10)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("generate key error: %v", err)
+	}
+	owner := &Address{
+		AddressInterface: &ED25519Address{
+			Test:      mode.IsTesting(),
+			PublicKey: publicKey,
+		},
+	}
+
+	previous := Link{}
+	previous[0] = 0x42
+
+	burn := func() Packed {
+		record := &BitmarkBurn{
+			Link: previous,
+		}
+		message, _ := record.Pack(owner)
+		signature := ed25519.Sign(privateKey, message)
+		record.Signature = signature[:]
+		packed, err := record.Pack(owner)
+		if nil != err {
+			t.Fatalf("pack error: %v", err)
+		}
+		return packed
+	}
+	transfer := func() Packed {
+		record := &BitmarkTransfer{
+			Link:  previous,
+			Owner: owner,
+		}
+		message, _ := record.Pack(owner)
+		signature := ed25519.Sign(privateKey, message)
+		record.Signature = signature[:]
+		packed, err := record.Pack(owner)
+		if nil != err {
+			t.Fatalf("pack error: %v", err)
+		}
+		return packed
+	}
+
+	var link Link
+	if err := transfer().Write(&link); nil != err {
+		t.Fatalf("transfer: error: %v", err)
+	}
+	if err := burn().Write(&link); fault.ErrDoubleSpend != err {
+		t.Errorf("burn: expected ErrDoubleSpend but got: %v", err)
+	}
+
+	// still rejected after a restart
+	Finalise()
+	transactionPool.initialised = false
+	Initialise(10)
+	if err := burn().Write(&link); fault.ErrDoubleSpend != err {
+		t.Errorf("burn after restart: expected ErrDoubleSpend but got: %v", err)
+	}
+
+	// a record from a block is always stored
+	if err := burn().WriteMined(&link); nil != err {
+		t.Errorf("mined burn: error: %v", err)
+	}
+
+	// even if this node has seen the bitmark burned
+	transactionPool.burnPool.Add(previous.Bytes(), link.Bytes())
+	if err := transfer().Write(&link); fault.ErrTransactionAlreadyExists != err {
+		t.Errorf("existing transfer: expected ErrTransactionAlreadyExists but got: %v", err)
+	}
+	previous[0] = 0x43
+	transactionPool.burnPool.Add(previous.Bytes(), link.Bytes())
+	if err := transfer().Write(&link); fault.ErrBitmarkBurned != err {
+		t.Errorf("burned: expected ErrBitmarkBurned but got: %v", err)
+	}
+	if err := transfer().WriteMined(&link); nil != err {
+		t.Errorf("mined transfer of burned: error: %v", err)
+	}
+
+	// a pending transfer is expired when a burn of the same
+	// bitmark is mined
+	previous[0] = 0x44
+	if err := transfer().CheckLimits(); nil != err {
+		t.Fatalf("check transfer: error: %v", err)
+	}
+	var pending Link
+	if err := transfer().Write(&pending); nil != err {
+		t.Fatalf("pending transfer: error: %v", err)
+	}
+	if err := burn().CheckLimits(); fault.ErrDoubleSpend != err {
+		t.Errorf("check burn: expected ErrDoubleSpend but got: %v", err)
+	}
+	pending.SetState(AvailableTransaction)
+
+	var mined Link
+	if err := burn().WriteMined(&mined); nil != err {
+		t.Fatalf("mined burn: error: %v", err)
+	}
+	mined.SetState(AvailableTransaction)
+	mined.SetState(MinedTransaction)
+
+	if state, found := pending.State(); found {
+		t.Errorf("pending transfer: not expired, state: %v", state)
+	}
+	if isSpent(previous) {
+		t.Errorf("bitmark: still has a pending spend")
+	}
+}
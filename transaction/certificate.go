@@ -0,0 +1,224 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/difficulty"
+	"github.com/bitmark-inc/bitmarkd/fault"
+)
+
+// version of the certificate document
+const CertificateVersion = 1
+
+// proof of the history of a bitmark that can be checked without
+// access to a node
+//
+// the records are the provenance path, newest first and ending with
+// the asset, each with the proof that it was mined
+type Certificate struct {
+	Version int                 `json:"version"`
+	Records []CertificateRecord `json:"records"`
+}
+
+// one record of a certificate
+type CertificateRecord struct {
+	Packed    Packed           `json:"packed"`
+	Inclusion *block.Inclusion `json:"inclusion"`
+}
+
+// create the certificate for a bitmark
+//
+// the bitmark can be given by the link of any of its records, the
+// certificate always starts from the latest record and every record
+// on the path must already be mined
+func (link Link) Certificate() (*Certificate, error) {
+
+	id := link
+
+	// a burned bitmark starts from its terminal record
+	if burnTxId, burned := id.Burned(); burned {
+		id = burnTxId
+	}
+
+	certificate := &Certificate{
+		Version: CertificateVersion,
+		Records: make([]CertificateRecord, 0, 10),
+	}
+
+loop:
+	for {
+		state, packed, found := id.ReadBitmark()
+		if !found {
+			return nil, fault.ErrLinkNotFound
+		}
+		if MinedTransaction != state {
+			return nil, fault.ErrLinksToUnconfirmedTransaction
+		}
+
+		inclusion, found := block.Include(block.Digest(packed.MakeLink()))
+		if !found {
+			return nil, fault.ErrBlockNotFound
+		}
+
+		certificate.Records = append(certificate.Records, CertificateRecord{
+			Packed:    packed,
+			Inclusion: inclusion,
+		})
+
+		record, err := packed.Unpack()
+		if nil != err {
+			return nil, err
+		}
+
+		switch record.(type) {
+		case *AssetData:
+			break loop
+
+		case *BitmarkIssue, *BitmarkBatchIssue:
+			_, id, found = issueAssetIndex(record).Read()
+			if !found {
+				return nil, fault.ErrAssetNotFound
+			}
+
+		case *BitmarkTransfer, *BitmarkCountersignedTransfer, *BitmarkBurn:
+			id = bitmarkLink(record)
+
+		default:
+			return nil, fault.ErrInvalidTransactionChain
+		}
+	}
+	return certificate, nil
+}
+
+// check a certificate
+//
+// every record must be signed by the owner set by the record before
+// it, link to that record and be included in a block header that
+// meets its difficulty, which must be at least the minimum (see
+// block.Inclusion.Verify)
+//
+// returns:
+//   the link of the bitmark, i.e. the txId of its latest record or
+//   for an unmoved batch issue the batch txId
+//   the asset
+func (certificate *Certificate) Verify(minimum *difficulty.Difficulty) (Link, *AssetData, error) {
+
+	if CertificateVersion != certificate.Version {
+		return Link{}, nil, fault.ErrInvalidVersion
+	}
+
+	n := len(certificate.Records)
+	if 0 == n {
+		return Link{}, nil, fault.ErrInvalidTransactionChain
+	}
+
+	records := make([]interface{}, n)
+	txIds := make([]Link, n)
+	for i, r := range certificate.Records {
+		record, err := r.Packed.Unpack()
+		if nil != err {
+			return Link{}, nil, err
+		}
+		records[i] = record
+		txIds[i] = r.Packed.MakeLink()
+
+		if nil == r.Inclusion {
+			return Link{}, nil, fault.ErrLinksToUnconfirmedTransaction
+		}
+		err = r.Inclusion.Verify(block.Digest(txIds[i]), minimum)
+		if nil != err {
+			return Link{}, nil, err
+		}
+	}
+
+	asset, ok := records[n-1].(*AssetData)
+	if !ok {
+		return Link{}, nil, fault.ErrInvalidTransactionChain
+	}
+
+	// work forward from the asset
+	var owner *Address
+	var current Link // the bitmark as seen by the next record
+	for i := n - 1; i >= 0; i -= 1 {
+
+		record := records[i]
+		var err error
+
+		switch record.(type) {
+		case *AssetData:
+			if i != n-1 {
+				return Link{}, nil, fault.ErrInvalidTransactionChain
+			}
+			_, err = asset.Pack(asset.Registrant)
+
+		case *BitmarkIssue:
+			issue := record.(*BitmarkIssue)
+			if i != n-2 || issue.AssetIndex != asset.AssetIndex() {
+				return Link{}, nil, fault.ErrInvalidTransactionChain
+			}
+			_, err = issue.Pack(issue.Owner)
+
+		case *BitmarkBatchIssue:
+			batch := record.(*BitmarkBatchIssue)
+			if i != n-2 || batch.AssetIndex != asset.AssetIndex() {
+				return Link{}, nil, fault.ErrInvalidTransactionChain
+			}
+			_, err = batch.Pack(batch.Owner)
+			if nil == err && i > 0 {
+				current, err = batchItem(txIds[i], batch, bitmarkLink(records[i-1]))
+			}
+
+		case *BitmarkTransfer, *BitmarkCountersignedTransfer, *BitmarkBurn:
+			if i > n-3 || bitmarkLink(record) != current {
+				return Link{}, nil, fault.ErrInvalidTransactionChain
+			}
+			if _, burn := record.(*BitmarkBurn); burn && 0 != i {
+				return Link{}, nil, fault.ErrBitmarkBurned
+			}
+			_, err = packRecord(record, owner)
+
+		default:
+			return Link{}, nil, fault.ErrInvalidTransactionChain
+		}
+		if nil != err {
+			return Link{}, nil, err
+		}
+
+		// prepare for the next record
+		owner = bitmarkOwner(record)
+		if _, batch := record.(*BitmarkBatchIssue); !batch || 0 == i {
+			current = txIds[i]
+		}
+	}
+	return current, asset, nil
+}
+
+// find the bitmark of a batch issue that a record links to
+func batchItem(batchTxId Link, batch *BitmarkBatchIssue, link Link) (Link, error) {
+	for i := uint64(0); i < batch.Count; i += 1 {
+		if BatchItemLink(batchTxId, batch.Nonce+i) == link {
+			return link, nil
+		}
+	}
+	return Link{}, fault.ErrInvalidTransactionChain
+}
+
+// pack a record that moves a bitmark to check its signatures
+func packRecord(record interface{}, owner *Address) (Packed, error) {
+	if nil == owner {
+		return nil, fault.ErrInvalidTransactionChain
+	}
+	switch record.(type) {
+	case *BitmarkTransfer:
+		return record.(*BitmarkTransfer).Pack(owner)
+	case *BitmarkCountersignedTransfer:
+		return record.(*BitmarkCountersignedTransfer).Pack(owner)
+	case *BitmarkBurn:
+		return record.(*BitmarkBurn).Pack(owner)
+	default:
+		return nil, fault.ErrInvalidTransactionChain
+	}
+}
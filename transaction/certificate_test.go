@@ -0,0 +1,225 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction_test
+
+import (
+	"encoding/json"
+	"github.com/agl/ed25519"
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/difficulty"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/mode"
+	"github.com/bitmark-inc/bitmarkd/transaction"
+	"testing"
+)
+
+// the records that can be signed for a certificate
+type signable interface {
+	Pack(address *transaction.Address) (transaction.Packed, error)
+}
+
+// make an address for the current mode
+//
+// the records tests switch to test mode, which can only happen once
+func modeAddress(publicKey *[32]byte) *transaction.Address {
+	return &transaction.Address{
+		AddressInterface: &transaction.ED25519Address{
+			Test:      mode.IsTesting(),
+			PublicKey: publicKey,
+		},
+	}
+}
+
+// sign a record and return its packed form
+func signRecord(t *testing.T, key *keyPair, address *transaction.Address, record signable, signature *transaction.Signature) transaction.Packed {
+	message, _ := record.Pack(address)
+	s := ed25519.Sign(&key.privateKey, message)
+	*signature = s[:]
+	packed, err := record.Pack(address)
+	if nil != err {
+		t.Fatalf("pack error: %v", err)
+	}
+	return packed
+}
+
+// any digest meets this difficulty
+const testBits = 0x217fffff
+
+// the minimum difficulty that the test headers meet
+func testMinimum() *difficulty.Difficulty {
+	return difficulty.New().SetBits(testBits)
+}
+
+// make a certificate for: asset → issue → transfer all mined in one block
+func makeCertificate(t *testing.T) (*transaction.Certificate, transaction.Link) {
+
+	registrantAddress := modeAddress(&registrant.publicKey)
+	issuerAddress := modeAddress(&issuer.publicKey)
+	ownerOneAddress := modeAddress(&ownerOne.publicKey)
+
+	asset := &transaction.AssetData{
+		Description: "Just the description",
+		Name:        "Item's Name",
+		Fingerprint: "0123456789abcdef",
+		Registrant:  registrantAddress,
+	}
+	packedAsset := signRecord(t, &registrant, registrantAddress, asset, &asset.Signature)
+
+	issue := &transaction.BitmarkIssue{
+		AssetIndex: asset.AssetIndex(),
+		Owner:      issuerAddress,
+		Nonce:      99,
+	}
+	packedIssue := signRecord(t, &issuer, issuerAddress, issue, &issue.Signature)
+
+	transfer := &transaction.BitmarkTransfer{
+		Link:  packedIssue.MakeLink(),
+		Owner: ownerOneAddress,
+	}
+	packedTransfer := signRecord(t, &issuer, issuerAddress, transfer, &transfer.Signature)
+
+	packed := []transaction.Packed{packedTransfer, packedIssue, packedAsset}
+	txIds := make([]block.Digest, len(packed))
+	for i, p := range packed {
+		txIds[i] = block.Digest(p.MakeLink())
+	}
+
+	coinbase := block.NewDigest([]byte("coinbase"))
+	tree := block.FullMerkleTree(coinbase, txIds)
+
+	header := block.Header{
+		Version:    block.Version,
+		MerkleRoot: tree[len(tree)-1],
+		Time:       1400000000,
+	}
+	header.Bits.SetBits(testBits)
+	packedHeader := header.Pack()
+
+	certificate := &transaction.Certificate{
+		Version: transaction.CertificateVersion,
+	}
+	for i, p := range packed {
+		certificate.Records = append(certificate.Records, transaction.CertificateRecord{
+			Packed: p,
+			Inclusion: &block.Inclusion{
+				Number: 2,
+				Header: packedHeader,
+				Index:  i + 1,
+				Branch: block.MerkleBranch(tree, len(txIds)+1, i+1),
+			},
+		})
+	}
+	return certificate, packedTransfer.MakeLink()
+}
+
+// a certificate survives a JSON round trip and verifies
+func TestCertificateVerify(t *testing.T) {
+
+	certificate, expected := makeCertificate(t)
+
+	link, asset, err := certificate.Verify(testMinimum())
+	if nil != err {
+		t.Fatalf("verify error: %v", err)
+	}
+	if expected != link {
+		t.Errorf("link: %s  expected: %s", link, expected)
+	}
+	if "Item's Name" != asset.Name {
+		t.Errorf("asset name: %q", asset.Name)
+	}
+
+	buffer, err := json.Marshal(certificate)
+	if nil != err {
+		t.Fatalf("marshal error: %v", err)
+	}
+	var c transaction.Certificate
+	err = json.Unmarshal(buffer, &c)
+	if nil != err {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	link, _, err = c.Verify(testMinimum())
+	if nil != err {
+		t.Fatalf("verify after JSON error: %v", err)
+	}
+	if expected != link {
+		t.Errorf("JSON link: %s  expected: %s", link, expected)
+	}
+}
+
+// damaged certificates are rejected
+func TestCertificateReject(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		damage func(c *transaction.Certificate)
+		err    error
+	}{
+		{
+			name:   "version",
+			damage: func(c *transaction.Certificate) { c.Version += 1 },
+			err:    fault.ErrInvalidVersion,
+		},
+		{
+			name:   "empty",
+			damage: func(c *transaction.Certificate) { c.Records = nil },
+			err:    fault.ErrInvalidTransactionChain,
+		},
+		{
+			name:   "no asset",
+			damage: func(c *transaction.Certificate) { c.Records = c.Records[:2] },
+			err:    fault.ErrInvalidTransactionChain,
+		},
+		{
+			name: "missing issue",
+			damage: func(c *transaction.Certificate) {
+				c.Records = append(c.Records[:1], c.Records[2])
+			},
+			err: fault.ErrInvalidTransactionChain,
+		},
+		{
+			name:   "not mined",
+			damage: func(c *transaction.Certificate) { c.Records[0].Inclusion = nil },
+			err:    fault.ErrLinksToUnconfirmedTransaction,
+		},
+		{
+			name:   "wrong branch",
+			damage: func(c *transaction.Certificate) { c.Records[1].Inclusion.Branch[0][0] ^= 1 },
+			err:    fault.ErrMerkleMismatch,
+		},
+		{
+			name:   "wrong index",
+			damage: func(c *transaction.Certificate) { c.Records[0].Inclusion.Index = 2 },
+			err:    fault.ErrMerkleMismatch,
+		},
+	}
+
+	for i, test := range tests {
+		certificate, _ := makeCertificate(t)
+		test.damage(certificate)
+		_, _, err := certificate.Verify(testMinimum())
+		if test.err != err {
+			t.Errorf("%d: %s  error: %v  expected: %v", i, test.name, err, test.err)
+		}
+	}
+}
+
+// a header below the network difficulty is rejected even though it
+// meets the difficulty it declares
+func TestCertificateForgedHeader(t *testing.T) {
+
+	certificate, _ := makeCertificate(t)
+
+	_, _, err := certificate.Verify(difficulty.New())
+	if fault.ErrInvalidBlockHeader != err {
+		t.Errorf("network minimum: error: %v  expected: %v", err, fault.ErrInvalidBlockHeader)
+	}
+
+	checkpoint := difficulty.New()
+	checkpoint.SetPdiff(1000)
+	_, _, err = certificate.Verify(checkpoint)
+	if fault.ErrInvalidBlockHeader != err {
+		t.Errorf("checkpoint: error: %v  expected: %v", err, fault.ErrInvalidBlockHeader)
+	}
+}
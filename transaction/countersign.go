@@ -0,0 +1,54 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"time"
+)
+
+// the owner of a bitmark after the record is mined
+func bitmarkOwner(record interface{}) *Address {
+	switch record.(type) {
+	case *BitmarkIssue:
+		return record.(*BitmarkIssue).Owner
+	case *BitmarkBatchIssue:
+		return record.(*BitmarkBatchIssue).Owner
+	case *BitmarkTransfer:
+		return record.(*BitmarkTransfer).Owner
+	case *BitmarkCountersignedTransfer:
+		return record.(*BitmarkCountersignedTransfer).Owner
+	default:
+		return nil
+	}
+}
+
+// validate a countersigned transfer against the current owner
+//
+// only call while transactionPool is locked
+func checkCountersigned(transfer *BitmarkCountersignedTransfer) error {
+
+	if transfer.IsExpired(time.Now()) {
+		return fault.ErrTransferExpired
+	}
+
+	// signed by the owner from the previous record
+	_, previousPacked, found := transfer.Link.ReadBitmark()
+	if !found {
+		return fault.ErrLinkNotFound
+	}
+	previous, err := previousPacked.Unpack()
+	if nil != err {
+		return err
+	}
+	address := bitmarkOwner(previous)
+	if nil == address {
+		return fault.ErrInvalidTransactionChain
+	}
+
+	// check both signatures
+	_, err = transfer.Pack(address)
+	return err
+}
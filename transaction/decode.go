@@ -36,20 +36,33 @@ func Decode(txIds []Link) []Decoded {
 			continue // ignore failed
 		}
 
-		switch record.(type) {
-		case *AssetData:
-			results[i].Type = "AssetData"
-			a := record.(*AssetData).AssetIndex()
+		results[i].Type = recordName(record)
+		if asset, ok := record.(*AssetData); ok {
+			a := asset.AssetIndex()
 			results[i].Asset = &a
-		case *BitmarkIssue:
-			results[i].Type = "BitmarkIssue"
-		case *BitmarkTransfer:
-			results[i].Type = "BitmarkTransfer"
-		default:
-			results[i].Type = "?"
 		}
 		results[i].Transaction = record
 	}
 
 	return results
 }
+
+// the name of a record type
+func recordName(record interface{}) string {
+	switch record.(type) {
+	case *AssetData:
+		return "AssetData"
+	case *BitmarkIssue:
+		return "BitmarkIssue"
+	case *BitmarkBatchIssue:
+		return "BitmarkBatchIssue"
+	case *BitmarkTransfer:
+		return "BitmarkTransfer"
+	case *BitmarkBurn:
+		return "BitmarkBurn"
+	case *BitmarkCountersignedTransfer:
+		return "BitmarkCountersignedTransfer"
+	default:
+		return "?"
+	}
+}
@@ -59,9 +59,8 @@ loop:
 
 		// check if an issue
 		switch unpackedTx.(type) {
-		case *BitmarkIssue:
-			issue := unpackedTx.(*BitmarkIssue)
-			state, link, found := issue.AssetIndex.Read()
+		case *BitmarkIssue, *BitmarkBatchIssue:
+			state, link, found := issueAssetIndex(unpackedTx).Read()
 			if !found {
 				continue // skip any issues lacking asset
 			}
@@ -54,3 +54,32 @@ func (cursor *IndexCursor) FetchUnpaid(count int) []UnpaidResult {
 
 	return results
 }
+
+// fetch the creation time of a single unpaid transaction
+//
+// returns:
+//   the timestamp used for expiry
+//   true if the transaction is unpaid or waiting
+func (link Link) UnpaidTimestamp() (time.Time, bool) {
+	transactionPool.RLock()
+	defer transactionPool.RUnlock()
+
+	stateData, found := transactionPool.statePool.Get(link.Bytes())
+	if !found {
+		return time.Time{}, false
+	}
+
+	switch State(stateData[0]) {
+	case UnpaidTransaction, WaitingIssueTransaction:
+	default:
+		return time.Time{}, false
+	}
+
+	unpaidData, found := transactionPool.unpaidPool.Get(stateData[1:])
+	if !found || len(unpaidData) < LinkSize+8 {
+		return time.Time{}, false
+	}
+
+	seconds := binary.BigEndian.Uint64(unpaidData[LinkSize:]) // the creation time
+	return time.Unix(int64(seconds), 0).UTC(), true
+}
@@ -0,0 +1,298 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"encoding/binary"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"strings"
+)
+
+// order in which unpaid transactions are removed when the pool is full
+type Eviction int
+
+const (
+	EvictOldest    = Eviction(iota)
+	EvictLowestFee = Eviction(iota)
+)
+
+// number of unpaid records read at a time while searching for eviction
+const evictionFetchSize = 100
+
+// limits on the unpaid pool
+//
+// any zero value is unlimited
+type Limits struct {
+	MaximumCount    uint64                          // unpaid transactions
+	MaximumBytes    uint64                          // total size of unpaid transactions
+	Eviction        Eviction                        // when count or bytes would be exceeded
+	RegistrantQuota uint64                          // unpaid transactions for each signing key
+	Fee             func(record interface{}) uint64 // required for EvictLowestFee
+}
+
+// size and quota key of an unpaid transaction
+type unpaidItem struct {
+	key  string
+	size uint64
+}
+
+// convert a configuration value to an eviction order
+func ParseEviction(s string) (Eviction, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "oldest":
+		return EvictOldest, nil
+	case "fee", "lowest-fee":
+		return EvictLowestFee, nil
+	default:
+		return EvictOldest, fault.ErrInvalidEviction
+	}
+}
+
+// set the unpaid pool limits
+func SetLimits(limits Limits) {
+	transactionPool.Lock()
+	defer transactionPool.Unlock()
+
+	if EvictLowestFee == limits.Eviction && nil == limits.Fee {
+		limits.Eviction = EvictOldest
+	}
+	transactionPool.limits = limits
+
+	transactionPool.log.Infof("unpaid limits: count: %d  bytes: %d  eviction: %d  registrant quota: %d",
+		limits.MaximumCount, limits.MaximumBytes, limits.Eviction, limits.RegistrantQuota)
+}
+
+// check if a new transaction would be accepted by the unpaid pool
+//
+// this allows the RPC to report a rejection to its client as Write
+// is only called later from the message bus; transactions already in
+// the pool are not affected
+//
+// a second pending transfer or burn of a bitmark is also rejected
+func (data Packed) CheckLimits() error {
+	transactionPool.Lock()
+	defer transactionPool.Unlock()
+
+	tx, err := data.Unpack()
+	if nil != err {
+		return err
+	}
+
+	switch tx.(type) {
+	case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
+		if isSpent(bitmarkLink(tx)) {
+			return fault.ErrDoubleSpend
+		}
+	}
+
+	limits := transactionPool.limits
+	if 0 != limits.MaximumBytes && uint64(len(data)) > limits.MaximumBytes {
+		return fault.ErrUnpaidPoolFull
+	}
+	return checkQuota(quotaKey(tx))
+}
+
+// internal routines - only call while transactionPool locked
+// ------------------------------------------------------------
+
+// the public key that signed a transaction
+//
+// returns an empty key if it cannot be determined
+func quotaKey(tx interface{}) string {
+	switch tx.(type) {
+	case *AssetData:
+		return string(tx.(*AssetData).Registrant.PublicKeyBytes())
+	case *BitmarkIssue, *BitmarkBatchIssue:
+		return string(bitmarkOwner(tx).PublicKeyBytes())
+	case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
+		owner, found := transactionPool.ownerPool.Get(bitmarkLink(tx).Bytes())
+		if !found || len(owner) <= LinkSize {
+			return ""
+		}
+		return string(owner[:len(owner)-LinkSize])
+	default:
+		return ""
+	}
+}
+
+// check the signer has not too many unpaid transactions
+func checkQuota(key string) error {
+	quota := transactionPool.limits.RegistrantQuota
+	if 0 == quota || "" == key {
+		return nil
+	}
+	if transactionPool.registrantCounts[key] >= quota {
+		return fault.ErrRegistrantQuotaExceeded
+	}
+	return nil
+}
+
+// make space for a new transaction by expiring unpaid transactions
+func makeRoom(size uint64, tx interface{}) error {
+	limits := transactionPool.limits
+	if 0 != limits.MaximumBytes && size > limits.MaximumBytes {
+		return fault.ErrUnpaidPoolFull
+	}
+
+	fee := uint64(0)
+	if EvictLowestFee == limits.Eviction {
+		fee = limits.Fee(tx)
+	}
+
+	for isFull(size) {
+		link, index, found := evictionCandidate(fee)
+		if !found {
+			return fault.ErrUnpaidPoolFull
+		}
+		transactionPool.log.Infof("evict unpaid: %#v", link)
+		expireUnpaid(link, index)
+	}
+	return nil
+}
+
+// check if a transaction of the given size would exceed the limits
+func isFull(size uint64) bool {
+	limits := transactionPool.limits
+	if 0 != limits.MaximumCount && transactionPool.unpaidCounter+1 > limits.MaximumCount {
+		return true
+	}
+	if 0 != limits.MaximumBytes && transactionPool.unpaidBytes+size > limits.MaximumBytes {
+		return true
+	}
+	return false
+}
+
+// select the next unpaid transaction to expire
+//
+// only transactions in the unpaid state are considered, an asset
+// waiting for its issues is never evicted
+//
+// for lowest fee the candidate must be cheaper than the new
+// transaction and the oldest is chosen from equal fees
+func evictionCandidate(fee uint64) (Link, []byte, bool) {
+	limits := transactionPool.limits
+
+	var candidate Link
+	var candidateIndex []byte
+	candidateFee := fee
+	found := false
+
+	cursor := IndexCursor(0)
+loop:
+	for {
+		unpaid, err := transactionPool.unpaidPool.Fetch(cursor.Bytes(), evictionFetchSize)
+		if nil != err {
+			fault.PanicWithError("transaction.evictionCandidate", err)
+		}
+		if 0 == len(unpaid) {
+			break loop
+		}
+
+		for _, e := range unpaid {
+			cursor = IndexCursor(binary.BigEndian.Uint64(e.Key) + 1)
+
+			txId := e.Value[:LinkSize]
+			state, ok := transactionPool.statePool.Get(txId)
+			if !ok || UnpaidTransaction != State(state[0]) {
+				continue
+			}
+
+			var link Link
+			LinkFromBytes(&link, txId)
+
+			if EvictOldest == limits.Eviction {
+				return link, e.Key, true
+			}
+
+			rawTx, ok := transactionPool.dataPool.Get(txId)
+			if !ok {
+				continue
+			}
+			record, err := Packed(rawTx).Unpack()
+			if nil != err {
+				continue
+			}
+			if f := limits.Fee(record); f < candidateFee {
+				candidate = link
+				candidateIndex = e.Key
+				candidateFee = f
+				found = true
+			}
+		}
+	}
+	return candidate, candidateIndex, found
+}
+
+// remove an unpaid transaction and all of its records
+func expireUnpaid(link Link, index []byte) {
+	txId := link.Bytes()
+	if data, found := transactionPool.dataPool.Get(txId); found {
+		if tx, err := Packed(data).Unpack(); nil == err {
+			untrackSpend(tx, link)
+		}
+	}
+	transactionPool.unpaidPool.Remove(index)
+	transactionPool.statePool.Remove(txId)
+	transactionPool.dataPool.Remove(txId)
+
+	// mutex is locked: so safe to decrement counter
+	transactionPool.unpaidCounter -= 1
+	untrackUnpaid(link)
+}
+
+// record the size and signer of a new unpaid transaction
+func trackUnpaid(link Link, key string, size uint64) {
+	transactionPool.unpaidItems[link] = unpaidItem{
+		key:  key,
+		size: size,
+	}
+	transactionPool.unpaidBytes += size
+	if "" != key {
+		transactionPool.registrantCounts[key] += 1
+	}
+}
+
+// rebuild the size and signer of an unpaid transaction on start up
+//
+// returns false if it is already tracked
+func restoreUnpaid(txId []byte) bool {
+	var link Link
+	if err := LinkFromBytes(&link, txId); nil != err {
+		fault.PanicWithError("transaction.restoreUnpaid", err)
+	}
+	if _, found := transactionPool.unpaidItems[link]; found {
+		return false
+	}
+
+	key := ""
+	size := uint64(0)
+	if data, found := transactionPool.dataPool.Get(txId); found {
+		size = uint64(len(data))
+		if tx, err := Packed(data).Unpack(); nil == err {
+			key = quotaKey(tx)
+		}
+	}
+	trackUnpaid(link, key, size)
+	return true
+}
+
+// release the size and quota of a transaction leaving the unpaid pool
+func untrackUnpaid(link Link) {
+	item, found := transactionPool.unpaidItems[link]
+	if !found {
+		return
+	}
+	delete(transactionPool.unpaidItems, link)
+
+	transactionPool.unpaidBytes -= item.size
+	if "" == item.key {
+		return
+	}
+	if count := transactionPool.registrantCounts[item.key]; count > 1 {
+		transactionPool.registrantCounts[item.key] = count - 1
+	} else {
+		delete(transactionPool.registrantCounts, item.key)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"crypto/rand"
+	"github.com/agl/ed25519"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/mode"
+	"encoding/binary"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"os"
+	"testing"
+)
+
+// test database file
+const limitsDatabase = "limits.leveldb"
+
+// check the configuration values for eviction
+func TestParseEviction(t *testing.T) {
+	tests := []struct {
+		s        string
+		eviction Eviction
+		err      error
+	}{
+		{"", EvictOldest, nil},
+		{"oldest", EvictOldest, nil},
+		{" Oldest ", EvictOldest, nil},
+		{"fee", EvictLowestFee, nil},
+		{"lowest-fee", EvictLowestFee, nil},
+		{"newest", EvictOldest, fault.ErrInvalidEviction},
+	}
+
+	for i, item := range tests {
+		eviction, err := ParseEviction(item.s)
+		if item.err != err {
+			t.Errorf("%d: %q  error: %v  expected: %v", i, item.s, err, item.err)
+			continue
+		}
+		if item.eviction != eviction {
+			t.Errorf("%d: %q  eviction: %d  expected: %d", i, item.s, eviction, item.eviction)
+		}
+	}
+}
+
+// test the unpaid pool size and registrant quota survive a restart
+func TestLimitsRestart(t *testing.T) {
+	os.RemoveAll(limitsDatabase)
+	pool.Initialise(limitsDatabase)
+	defer func() {
+		Finalise()
+		transactionPool.initialised = false
+		pool.Finalise()
+		os.RemoveAll(limitsDatabase)
+	}()
+
+	Initialise(10)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("generate key error: %v", err)
+	}
+	address := &Address{
+		AddressInterface: &ED25519Address{
+			Test:      mode.IsTesting(),
+			PublicKey: publicKey,
+		},
+	}
+	asset := func(name string) Packed {
+		record := &AssetData{
+			Name:        name,
+			Fingerprint: "fingerprint: " + name,
+			Registrant:  address,
+		}
+		message, _ := record.Pack(address)
+		signature := ed25519.Sign(privateKey, message)
+		record.Signature = signature[:]
+		packed, err := record.Pack(address)
+		if nil != err {
+			t.Fatalf("pack error: %v", err)
+		}
+		return packed
+	}
+
+	first := asset("first")
+	var link Link
+	if err := first.Write(&link); nil != err {
+		t.Fatalf("write error: %v", err)
+	}
+
+	// restart
+	Finalise()
+	transactionPool.initialised = false
+	Initialise(10)
+	SetLimits(Limits{
+		RegistrantQuota: 1,
+	})
+
+	if 1 != transactionPool.unpaidCounter {
+		t.Errorf("unpaid count: %d  expected: 1", transactionPool.unpaidCounter)
+	}
+	if uint64(len(first)) != transactionPool.unpaidBytes {
+		t.Errorf("unpaid bytes: %d  expected: %d", transactionPool.unpaidBytes, len(first))
+	}
+	if err := asset("second").CheckLimits(); fault.ErrRegistrantQuotaExceeded != err {
+		t.Errorf("second asset: expected ErrRegistrantQuotaExceeded but got: %v", err)
+	}
+
+	// leaving the pool releases the quota
+	transactionPool.Lock()
+	untrackUnpaid(link)
+	transactionPool.Unlock()
+	if 0 != transactionPool.unpaidBytes || 0 != len(transactionPool.registrantCounts) {
+		t.Errorf("bytes: %d  registrants: %d  after untrack", transactionPool.unpaidBytes, len(transactionPool.registrantCounts))
+	}
+}
+
+// test a rejected issue does not keep a waiting asset in the pool
+func TestWaitingAssetRefresh(t *testing.T) {
+	os.RemoveAll(limitsDatabase)
+	pool.Initialise(limitsDatabase)
+	defer func() {
+		Finalise()
+		transactionPool.initialised = false
+		pool.Finalise()
+		os.RemoveAll(limitsDatabase)
+	}()
+
+	Initialise(10)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("generate key error: %v", err)
+	}
+	address := &Address{
+		AddressInterface: &ED25519Address{
+			Test:      mode.IsTesting(),
+			PublicKey: publicKey,
+		},
+	}
+
+	asset := &AssetData{
+		Name:        "waiting",
+		Fingerprint: "fingerprint: waiting",
+		Registrant:  address,
+	}
+	message, _ := asset.Pack(address)
+	signature := ed25519.Sign(privateKey, message)
+	asset.Signature = signature[:]
+	packedAsset, err := asset.Pack(address)
+	if nil != err {
+		t.Fatalf("pack asset error: %v", err)
+	}
+	var assetLink Link
+	if err := packedAsset.Write(&assetLink); nil != err {
+		t.Fatalf("write asset error: %v", err)
+	}
+
+	issue := &BitmarkIssue{
+		AssetIndex: asset.AssetIndex(),
+		Owner:      address,
+		Nonce:      1,
+	}
+	message, _ = issue.Pack(address)
+	signature = ed25519.Sign(privateKey, message)
+	issue.Signature = signature[:]
+	packedIssue, err := issue.Pack(address)
+	if nil != err {
+		t.Fatalf("pack issue error: %v", err)
+	}
+
+	// the timestamp of the waiting asset
+	timestamp := func() uint64 {
+		state, found := transactionPool.statePool.Get(assetLink.Bytes())
+		if !found || WaitingIssueTransaction != State(state[0]) {
+			t.Fatalf("asset not waiting")
+		}
+		data, found := transactionPool.unpaidPool.Get(state[1:])
+		if !found {
+			t.Fatalf("asset not unpaid")
+		}
+		return binary.BigEndian.Uint64(data[LinkSize:])
+	}
+	setTimestamp := func(seconds uint64) {
+		state, _ := transactionPool.statePool.Get(assetLink.Bytes())
+		data, _ := transactionPool.unpaidPool.Get(state[1:])
+		binary.BigEndian.PutUint64(data[LinkSize:], seconds)
+		transactionPool.unpaidPool.Add(state[1:], data)
+	}
+
+	setTimestamp(1)
+	SetLimits(Limits{
+		RegistrantQuota: 1,
+	})
+	var issueLink Link
+	if err := packedIssue.Write(&issueLink); fault.ErrRegistrantQuotaExceeded != err {
+		t.Fatalf("issue: expected ErrRegistrantQuotaExceeded but got: %v", err)
+	}
+	if 1 != timestamp() {
+		t.Errorf("rejected issue updated the asset timestamp")
+	}
+
+	SetLimits(Limits{})
+	if err := packedIssue.Write(&issueLink); nil != err {
+		t.Fatalf("issue error: %v", err)
+	}
+	if 1 == timestamp() {
+		t.Errorf("accepted issue did not update the asset timestamp")
+	}
+}
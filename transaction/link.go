@@ -192,6 +192,17 @@ func LinkFromBytes(link *Link, buffer []byte) error {
 	return nil
 }
 
+// convert a link to little endian hex with prefix
+// (the inverse of LinkFromHexString below)
+//
+// this is the form that is embedded in a currency payment
+func (link Link) PrefixedHex() string {
+	buffer := make([]byte, 0, linkPrefixSize+LinkSize)
+	buffer = append(buffer, linkPrefix...)
+	buffer = append(buffer, link[:]...)
+	return hex.EncodeToString(buffer)
+}
+
 // convert and validate a little endian hex link string
 // Notes:
 // 1. hex code contains prefix at the beginning
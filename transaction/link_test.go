@@ -153,4 +153,8 @@ func TestHexLink(t *testing.T) {
 		t.Errorf("link: %#v  expected: %#v", link, expectedLink)
 	}
 
+	// reverse conversion
+	if h := link.PrefixedHex(); prefixedHex != h {
+		t.Errorf("PrefixedHex: %q  expected: %q", h, prefixedHex)
+	}
 }
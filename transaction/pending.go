@@ -5,44 +5,182 @@
 package transaction
 
 import (
+	"bytes"
+	"encoding/binary"
 	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/pool"
 )
 
-// fetch some transactions for client
-func FetchPending() []Decoded {
+// most index entries examined by one call so that a filter that
+// matches nothing cannot cause a scan of the whole pool
+const maximumPendingScan = 10000
 
-	startIndex := []byte{}
-	txids := make([]Link, 0, 100)
+// number of index entries read at a time
+const pendingFetchSize = 100
+
+// restrict the transactions returned by FetchPending
+//
+// an empty field matches all transactions
+type PendingFilter struct {
+	States  []State  // any of: UnpaidTransaction, WaitingIssueTransaction, AvailableTransaction
+	Types   []string // record names as in Decoded.Type
+	Address *Address // registrant of an asset or owner of a bitmark
+}
+
+// fetch some pending transactions for a client
+//
+// transactions are in the order of the unpaid/available index
+// counter, so a transaction that becomes available moves to a later
+// position and may be seen again
+//
+// the cursor is advanced past the last index entry examined so it
+// can be used for the next call even if fewer than count
+// transactions were returned
+func (cursor *IndexCursor) FetchPending(count int, filter *PendingFilter) ([]Decoded, error) {
+	if count <= 0 {
+		return nil, fault.ErrInvalidCount
+	}
+	if nil == filter {
+		filter = &PendingFilter{}
+	}
+
+	unpaid := indexReader{
+		pool: transactionPool.unpaidPool,
+		next: *cursor,
+	}
+	available := indexReader{
+		pool: transactionPool.availablePool,
+		next: *cursor,
+	}
+
+	txIds := make([]Link, 0, count)
 
 loop:
-	for {
-		// read blocks of records
-		state, err := transactionPool.statePool.Fetch(startIndex, 100)
+	for n := 0; n < maximumPendingScan && len(txIds) < count; n += 1 {
+
+		// merge the two indexes in counter order
+		u := unpaid.peek()
+		a := available.peek()
+		var e *pool.Element
+		switch {
+		case nil == u && nil == a:
+			break loop
+		case nil == a:
+			e = unpaid.pop()
+		case nil == u:
+			e = available.pop()
+		case bytes.Compare(u.Key, a.Key) < 0:
+			e = unpaid.pop()
+		default:
+			e = available.pop()
+		}
+
+		*cursor = IndexCursor(binary.BigEndian.Uint64(e.Key) + 1)
+
+		var txId Link
+		err := LinkFromBytes(&txId, e.Value[:LinkSize])
 		if nil != err {
-			// error represents a database failure - panic
-			fault.Criticalf("transaction.FetchPending: statePool.Fetch failed, err = %v", err)
-			fault.Panic("transaction.FetchPending: failed")
+			continue loop
 		}
+		if filter.match(txId) {
+			txIds = append(txIds, txId)
+		}
+	}
 
-		// if only one or zero records exit loop
-		n := len(state)
-		if n <= 1 {
-			break loop
+	return Decode(txIds), nil
+}
+
+// check if a transaction passes the filter
+func (filter *PendingFilter) match(txId Link) bool {
+
+	state, packed, found := txId.Read()
+	if !found {
+		return false // removed since the index was read
+	}
+
+	if 0 != len(filter.States) && !hasState(filter.States, state) {
+		return false
+	}
+
+	if 0 == len(filter.Types) && nil == filter.Address {
+		return true
+	}
+
+	record, err := packed.Unpack()
+	if nil != err {
+		return false
+	}
+
+	if 0 != len(filter.Types) && !hasString(filter.Types, recordName(record)) {
+		return false
+	}
+
+	if nil != filter.Address {
+		var address *Address
+		if asset, ok := record.(*AssetData); ok {
+			address = asset.Registrant
+		} else {
+			address = bitmarkOwner(record)
+		}
+		if nil == address || !bytes.Equal(address.PublicKeyBytes(), filter.Address.PublicKeyBytes()) {
+			return false
+		}
+	}
+	return true
+}
+
+// check if a state is in a list
+func hasState(states []State, state State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
 		}
+	}
+	return false
+}
+
+// check if a string is in a list
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
 
-		// last key for next loop
-		startIndex = state[n-1].Key
+// sequential reader of an index pool
+type indexReader struct {
+	pool     *pool.Pool
+	next     IndexCursor
+	elements []pool.Element
+	done     bool
+}
 
-		// exclude the mined transactions
-		for _, e := range state {
-			if MinedTransaction == State(e.Value[0]) {
-				continue
-			}
-			var txid Link
-			LinkFromBytes(&txid, e.Key) // the transaction id
-			txids = append(txids, txid)
+// the next element without removing it, nil at the end of the pool
+func (reader *indexReader) peek() *pool.Element {
+	if 0 == len(reader.elements) && !reader.done {
+		elements, err := reader.pool.Fetch(reader.next.Bytes(), pendingFetchSize)
+		if nil != err {
+			// error represents a database failure - panic
+			fault.PanicWithError("transaction.FetchPending: Fetch", err)
 		}
+		if 0 == len(elements) {
+			reader.done = true
+		} else {
+			reader.elements = elements
+			reader.next = IndexCursor(binary.BigEndian.Uint64(elements[len(elements)-1].Key) + 1)
+		}
+	}
+	if 0 == len(reader.elements) {
+		return nil
 	}
+	return &reader.elements[0]
+}
 
-	return Decode(txids)
+// remove the next element
+func (reader *indexReader) pop() *pool.Element {
+	e := reader.peek()
+	reader.elements = reader.elements[1:]
+	return e
 }
@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"github.com/bitmark-inc/bitmarkd/block"
 	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/messagebus"
 	"github.com/bitmark-inc/bitmarkd/pool"
 	"github.com/bitmark-inc/logger"
 	"sync"
@@ -37,11 +38,23 @@ var transactionPool struct {
 	unpaidCounter    uint64
 	availableCounter uint64
 
+	// unpaid pool limits
+	limits           Limits
+	unpaidBytes      uint64
+	unpaidItems      map[Link]unpaidItem
+	registrantCounts map[string]uint64
+
+	// pending transfers and burns by the bitmark they move
+	spends map[Link]Link
+
 	// store of assets
-	assetPool *pool.Pool // all available assets
+	assetPool  *pool.Pool // all available assets
+	searchPool *pool.Pool // secondary indexes of mined assets
 
 	// owner index pools
 	ownerPool *pool.Pool // index of leaves bitmark transfer
+	batchPool *pool.Pool // index of bitmarks expanded from batch issues
+	burnPool  *pool.Pool // index of bitmarks that have been burned
 
 	// counter for record index
 	// used as index for the unpaidPool / availablePool
@@ -72,9 +85,17 @@ func Initialise(cacheSize int) {
 	transactionPool.unpaidCounter = 0
 	transactionPool.availableCounter = 0
 
+	transactionPool.unpaidBytes = 0
+	transactionPool.unpaidItems = make(map[Link]unpaidItem)
+	transactionPool.registrantCounts = make(map[string]uint64)
+	transactionPool.spends = make(map[Link]Link)
+
 	transactionPool.assetPool = pool.New(pool.AssetData, cacheSize)
+	transactionPool.searchPool = pool.New(pool.AssetSearch, cacheSize)
 
 	transactionPool.ownerPool = pool.New(pool.OwnerIndex, cacheSize)
+	transactionPool.batchPool = pool.New(pool.BatchIndex, cacheSize)
+	transactionPool.burnPool = pool.New(pool.BurnIndex, cacheSize)
 
 	startIndex := []byte{}
 
@@ -125,7 +146,7 @@ loop:
 
 		// if no more records exit loop
 		n := len(state)
-		if n <= 1 {
+		if 0 == n {
 			break loop
 		}
 		//   S<tx-digest>          - state: byte[expired(E), unpaid(U), available(A), mined(M)] ++ int64[the U/A table count value]
@@ -144,7 +165,10 @@ loop:
 			switch theState {
 
 			case UnpaidTransaction, WaitingIssueTransaction:
-				transactionPool.unpaidCounter += 1
+				if restoreUnpaid(txId) {
+					transactionPool.unpaidCounter += 1
+				}
+				restoreSpend(txId)
 				// ensure an old timestamp is not updated
 				if _, found := transactionPool.unpaidPool.Get(indexBuffer); !found {
 					// Link ++ int64[timestamp]
@@ -156,6 +180,7 @@ loop:
 				transactionPool.availablePool.Remove(indexBuffer)
 
 			case AvailableTransaction:
+				restoreSpend(txId)
 				transactionPool.availablePool.Add(indexBuffer, txId)
 				transactionPool.unpaidPool.Remove(indexBuffer)
 
@@ -164,9 +189,12 @@ loop:
 				transactionPool.availablePool.Remove(indexBuffer)
 			}
 		}
-		startIndex = state[n-1].Key
+		// continue after the last key read
+		startIndex = append(state[n-1].Key, 0x00)
 	}
 
+	rebuildSearch(lastBlock)
+
 	transactionPool.initialised = true
 }
 
@@ -177,7 +205,10 @@ func Finalise() {
 	transactionPool.unpaidPool.Flush()
 	transactionPool.availablePool.Flush()
 	transactionPool.assetPool.Flush()
+	transactionPool.searchPool.Flush()
 	transactionPool.ownerPool.Flush()
+	transactionPool.batchPool.Flush()
+	transactionPool.burnPool.Flush()
 	transactionPool.log.Info("shutting down…")
 	transactionPool.log.Flush()
 }
@@ -198,6 +229,19 @@ func ReadCounters(unpaid *uint64, available *uint64) {
 //
 // this enters the transaction as an unpaid new transaction
 func (data Packed) Write(link *Link) error {
+	return data.write(link, true)
+}
+
+// write a transaction that is already in a block
+//
+// the unpaid pool limits are not applied as the caller immediately
+// marks the transaction as mined
+func (data Packed) WriteMined(link *Link) error {
+	return data.write(link, false)
+}
+
+// write a transaction, optionally applying the unpaid pool limits
+func (data Packed) write(link *Link, limited bool) error {
 
 	*link = data.MakeLink()
 	txId := link.Bytes()
@@ -221,6 +265,10 @@ func (data Packed) Write(link *Link) error {
 
 			return err // not reached
 		}
+
+		// unpaid index of an asset waiting for this issue
+		var waitingAsset []byte
+
 		switch tx.(type) {
 		case *AssetData:
 			asset := tx.(*AssetData)
@@ -235,11 +283,10 @@ func (data Packed) Write(link *Link) error {
 			}
 			startingState = WaitingIssueTransaction
 
-		case *BitmarkIssue:
-			transfer := tx.(*BitmarkIssue)
+		case *BitmarkIssue, *BitmarkBatchIssue:
 
 			// previous record
-			assetIndex := transfer.AssetIndex.Bytes()
+			assetIndex := issueAssetIndex(tx).Bytes()
 
 			// must link to an Asset
 			previous, found := transactionPool.assetPool.Get(assetIndex)
@@ -261,23 +308,69 @@ func (data Packed) Write(link *Link) error {
 				return fault.ErrAssetNotFound // not reached
 			}
 
-			// if waiting update timestamp and write back
+			// if waiting the timestamp is updated once the issue
+			// is accepted
 			if WaitingIssueTransaction == State(assetState[0]) {
-				data, found := transactionPool.unpaidPool.Get(assetState[1:])
-				if !found {
-					transactionPool.log.Criticalf("write tx, no asset unpaid state for assetIndex: %x", assetIndex)
-					fault.Panic("transaction.write (no asset unpaid state)")
-					return fault.ErrAssetNotFound // not reached
-				}
+				waitingAsset = make([]byte, len(assetState)-1)
+				copy(waitingAsset, assetState[1:])
+			}
+
+		case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
 
-				binary.BigEndian.PutUint64(data[LinkSize:], timestamp)
+			// a burned bitmark cannot be moved again, a record
+			// from a block is always stored
+			previousLink := bitmarkLink(tx).Bytes()
+			if _, found := transactionPool.burnPool.Get(previousLink); found && limited {
+				transactionPool.log.Warnf("write tx, burned bitmark: %x", previousLink)
+				return fault.ErrBitmarkBurned
+			}
 
-				transactionPool.unpaidPool.Add(assetState[1:], data)
+			// only one pending transfer or burn of a bitmark
+			if limited && isSpent(bitmarkLink(tx)) {
+				transactionPool.log.Warnf("write tx, double spend of bitmark: %x", previousLink)
+				return fault.ErrDoubleSpend
+			}
+
+			// both parties must have signed before expiry, a
+			// record from a block was checked when it was mined
+			if transfer, ok := tx.(*BitmarkCountersignedTransfer); ok && limited {
+				err := checkCountersigned(transfer)
+				if nil != err {
+					transactionPool.log.Warnf("write tx, countersigned transfer: %x  error: %v", previousLink, err)
+					return err
+				}
 			}
 
 		default:
 		}
 
+		// enforce the unpaid pool limits
+		key := quotaKey(tx)
+		if limited {
+			err = checkQuota(key)
+		}
+		if limited && nil == err {
+			err = makeRoom(uint64(len(data)), tx)
+		}
+		if nil != err {
+			transactionPool.log.Warnf("write tx: %#v  rejected: %v", *link, err)
+			return err
+		}
+
+		// update the timestamp of a waiting asset and write back
+		if nil != waitingAsset {
+			data, found := transactionPool.unpaidPool.Get(waitingAsset)
+			if !found {
+				transactionPool.log.Criticalf("write tx, no asset unpaid state for: %#v", *link)
+				fault.Panic("transaction.write (no asset unpaid state)")
+				return fault.ErrAssetNotFound // not reached
+			}
+
+			binary.BigEndian.PutUint64(data[LinkSize:], timestamp)
+
+			transactionPool.unpaidPool.Add(waitingAsset, data)
+		}
+
 		transactionPool.indexCounter += 1 // safe because mutex is locked
 		// create the index count in big endian order so
 		// iterator on the index will return items in the
@@ -301,11 +394,16 @@ func (data Packed) Write(link *Link) error {
 		transactionPool.statePool.Add(txId, stateBuffer)
 		transactionPool.unpaidPool.Add(indexBuffer, unpaidData)
 		transactionPool.dataPool.Add(txId, data)
+		trackUnpaid(*link, key, uint64(len(data)))
 		switch tx.(type) {
 		case *AssetData:
 			asset := tx.(*AssetData)
 			assetIndex := asset.AssetIndex().Bytes()
 			transactionPool.assetPool.Add(assetIndex, txId)
+		case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
+			if limited {
+				trackSpend(tx, *link)
+			}
 		default:
 		}
 
@@ -386,6 +484,25 @@ func (link Link) IsOwner(address *Address) bool {
 	return bytes.Equal(publicKey, address.PublicKeyBytes())
 }
 
+// find the AssetData record for a current bitmark
+//
+// returns:
+//   transaction ID of the AssetData record
+//   true if the link is a current bitmark
+func (link Link) AssetLink() (Link, bool) {
+	publicKeyAndAssetDataLink, found := transactionPool.ownerPool.Get(link.Bytes())
+	if !found {
+		return Link{}, false
+	}
+	length := len(publicKeyAndAssetDataLink)
+	var assetDataLink Link
+	err := LinkFromBytes(&assetDataLink, publicKeyAndAssetDataLink[length-LinkSize:])
+	if nil != err {
+		return Link{}, false
+	}
+	return assetDataLink, true
+}
+
 // set the state of a transaction
 func (link Link) SetState(newState State) {
 	transactionPool.Lock()
@@ -440,16 +557,15 @@ switchOldState:
 			// mutex is locked: so safe to increment counter
 			transactionPool.unpaidCounter -= 1
 			transactionPool.availableCounter += 1
+			untrackUnpaid(link)
 			ok = true
 
+			// wake the miner to add it to a job
+			messagebus.Notify(messagebus.EventTransactionAvailable)
+
 		case ExpiredTransaction:
 			// delete all associated records
-			transactionPool.unpaidPool.Remove(oldIndex)
-			transactionPool.statePool.Remove(txId)
-			transactionPool.dataPool.Remove(txId)
-
-			// mutex is locked: so safe to increment counter
-			transactionPool.unpaidCounter -= 1
+			expireUnpaid(link, oldIndex)
 			ok = true
 		default:
 		}
@@ -482,6 +598,7 @@ switchOldState:
 
 				// mutex is locked: so safe to increment counter
 				transactionPool.unpaidCounter -= 1
+				untrackUnpaid(link)
 
 				ok = true
 			}
@@ -513,9 +630,11 @@ switchOldState:
 				asset := record.(*AssetData)
 				assetIndex := NewAssetIndex([]byte(asset.Fingerprint)).Bytes()
 				transactionPool.assetPool.Add(assetIndex, txId)
+				indexAsset(asset, txId)
 
 				// mutex is locked: so safe to increment counter
 				transactionPool.unpaidCounter -= 1
+				untrackUnpaid(link)
 
 			case *BitmarkIssue:
 				transfer := record.(*BitmarkIssue)
@@ -540,30 +659,79 @@ switchOldState:
 				// mutex is locked: so safe to increment counter
 				transactionPool.availableCounter -= 1
 
-			case *BitmarkTransfer:
-				transfer := record.(*BitmarkTransfer)
+			case *BitmarkBatchIssue:
+				batch := record.(*BitmarkBatchIssue)
 
-				// previous record
-				previousLink := transfer.Link.Bytes()
-				previous, found := transactionPool.ownerPool.Get(previousLink)
+				// must link to an Asset
+				previous, found := transactionPool.assetPool.Get(batch.AssetIndex.Bytes())
 				if !found {
 					fault.PanicWithError("transaction.SetState", fault.ErrLinkNotFound)
 				}
 
 				// split the record
 				length := len(previous) - LinkSize
-				previousOwner := previous[:length]
 				assetDataLink := previous[length:]
 
-				// avoid side effect modification of assetDataLink
-				previousKey := make([]byte, 0, len(previousOwner)+LinkSize)
-				previousKey = append(previousKey, previousOwner...)
-				previousKey = append(previousKey, previousLink...)
+				// expand into individual bitmarks
+				ownerData := append(batch.Owner.PublicKeyBytes(), assetDataLink...)
+				batchData := make([]byte, LinkSize+8)
+				copy(batchData, txId)
+				for i := uint64(0); i < batch.Count; i += 1 {
+					nonce := batch.Nonce + i
+					itemLink := BatchItemLink(link, nonce)
+					binary.BigEndian.PutUint64(batchData[LinkSize:], nonce)
+					transactionPool.ownerPool.Add(itemLink.Bytes(), ownerData)
+					transactionPool.batchPool.Add(itemLink.Bytes(), batchData)
+				}
 
-				ownerData := append(transfer.Owner.PublicKeyBytes(), assetDataLink...)
+				// mutex is locked: so safe to increment counter
+				transactionPool.availableCounter -= 1
 
-				transactionPool.ownerPool.Remove(previousLink)
-				transactionPool.ownerPool.Add(txId, ownerData)
+			case *BitmarkTransfer, *BitmarkCountersignedTransfer:
+				untrackSpend(record, link)
+				expireConflicting(bitmarkLink(record), link)
+
+				// previous record, if already moved by a conflicting
+				// record then this one cannot change the ownership
+				previousLink := bitmarkLink(record).Bytes()
+				previous, found := transactionPool.ownerPool.Get(previousLink)
+				if found {
+
+					// split the record
+					length := len(previous) - LinkSize
+					previousOwner := previous[:length]
+					assetDataLink := previous[length:]
+
+					// avoid side effect modification of assetDataLink
+					previousKey := make([]byte, 0, len(previousOwner)+LinkSize)
+					previousKey = append(previousKey, previousOwner...)
+					previousKey = append(previousKey, previousLink...)
+
+					ownerData := append(bitmarkOwner(record).PublicKeyBytes(), assetDataLink...)
+
+					transactionPool.ownerPool.Remove(previousLink)
+					transactionPool.ownerPool.Add(txId, ownerData)
+				} else {
+					transactionPool.log.Criticalf("SetState: transfer: %#v  previous not owned: %x", link, previousLink)
+				}
+
+				// mutex is locked: so safe to increment counter
+				transactionPool.availableCounter -= 1
+
+			case *BitmarkBurn:
+				untrackSpend(record, link)
+				expireConflicting(bitmarkLink(record), link)
+
+				// previous record, as for a transfer
+				previousLink := bitmarkLink(record).Bytes()
+				if _, found := transactionPool.ownerPool.Get(previousLink); found {
+
+					// no further ownership, just the terminal record
+					transactionPool.ownerPool.Remove(previousLink)
+					transactionPool.burnPool.Add(previousLink, txId)
+				} else {
+					transactionPool.log.Criticalf("SetState: burn: %#v  previous not owned: %x", link, previousLink)
+				}
 
 				// mutex is locked: so safe to increment counter
 				transactionPool.availableCounter -= 1
@@ -8,6 +8,8 @@ import (
 	"encoding/hex"
 	"github.com/bitmark-inc/bitmarkd/fault"
 	"github.com/bitmark-inc/bitmarkd/util"
+	"sort"
+	"time"
 	"unicode/utf8"
 )
 
@@ -18,9 +20,13 @@ const (
 	NullTag = iota
 
 	// valid record type
-	AssetDataTag       = iota
-	BitmarkIssueTag    = iota
-	BitmarkTransferTag = iota
+	AssetDataTag                    = iota
+	BitmarkIssueTag                 = iota
+	BitmarkTransferTag              = iota
+	AssetMetadataTag                = iota // AssetData with metadata
+	BitmarkBatchIssueTag            = iota
+	BitmarkBurnTag                  = iota
+	BitmarkCountersignedTransferTag = iota
 
 	// this item must be last
 	InvalidTag = iota
@@ -36,15 +42,23 @@ const (
 	maxFingerprintLength = 1024
 	maxSignatureLength   = 1024
 	maxTimestampLength   = len("2014-06-21T14:32:16Z")
+
+	maxMetadataItems       = 32
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 1024
+	maxMetadataLength      = 4096 // total of all keys and values
+
+	maxBatchIssueCount = 10000 // bitmarks in a single batch issue
 )
 
 // the unpacked Asset Data structure
 type AssetData struct {
-	Description string    `json:"description"` // utf-8
-	Name        string    `json:"name"`        // utf-8
-	Fingerprint string    `json:"fingerprint"` // utf-8 / hex / base64
-	Registrant  *Address  `json:"registrant"`  // base58
-	Signature   Signature `json:"signature"`   // base64
+	Description string            `json:"description"`        // utf-8
+	Name        string            `json:"name"`               // utf-8
+	Fingerprint string            `json:"fingerprint"`        // utf-8 / hex / base64
+	Metadata    map[string]string `json:"metadata,omitempty"` // utf-8 key/value pairs, packed in key order
+	Registrant  *Address          `json:"registrant"`         // base58
+	Signature   Signature         `json:"signature"`          // base64
 }
 
 // the unpacked BitmarkIssue structure
@@ -55,6 +69,17 @@ type BitmarkIssue struct {
 	Signature  Signature  `json:"signature"` // base64: corresponds to owner in linked record
 }
 
+// the unpacked BitmarkBatchIssue structure
+//
+// issues Count bitmarks with consecutive nonces starting from Nonce
+type BitmarkBatchIssue struct {
+	AssetIndex AssetIndex `json:"asset"`     // previous record
+	Owner      *Address   `json:"owner"`     // base58: the "destination" owner of all the bitmarks
+	Nonce      uint64     `json:"nonce"`     // first nonce of the range
+	Count      uint64     `json:"count"`     // number of bitmarks issued
+	Signature  Signature  `json:"signature"` // base64: corresponds to owner
+}
+
 // the unpacked BitmarkTransfer structure
 type BitmarkTransfer struct {
 	Link      Link      `json:"link"`      // previous record (or RegistrationTransfer if first record)
@@ -62,6 +87,26 @@ type BitmarkTransfer struct {
 	Signature Signature `json:"signature"` // base64: corresponds to owner in linked record
 }
 
+// the unpacked BitmarkBurn structure
+//
+// permanently retires a bitmark
+type BitmarkBurn struct {
+	Link      Link      `json:"link"`      // the current record of the bitmark
+	Signature Signature `json:"signature"` // base64: corresponds to owner in linked record
+}
+
+// the unpacked BitmarkCountersignedTransfer structure
+//
+// a transfer that must be signed by both the previous owner and the
+// new owner, the countersignature covers the signed offer
+type BitmarkCountersignedTransfer struct {
+	Link             Link      `json:"link"`             // previous record
+	Owner            *Address  `json:"owner"`            // base58: the "destination" owner
+	Expiry           uint64    `json:"expiry"`           // UTC seconds, zero => never expires
+	Signature        Signature `json:"signature"`        // base64: corresponds to owner in linked record
+	Countersignature Signature `json:"countersignature"` // base64: corresponds to owner in this record
+}
+
 // turn a byte slice into a record
 //
 // must cast result to correct type
@@ -77,7 +122,7 @@ func (record Packed) Unpack() (interface{}, error) {
 
 	switch recordType {
 
-	case AssetDataTag:
+	case AssetDataTag, AssetMetadataTag:
 
 		// description
 		descriptionLength, descriptionOffset := util.FromVarint64(record[n:])
@@ -100,6 +145,18 @@ func (record Packed) Unpack() (interface{}, error) {
 		copy(fingerprint, record[n:])
 		n += int(fingerprintLength)
 
+		// metadata only present in the newer record
+		var metadata map[string]string
+		if AssetMetadataTag == recordType {
+			var err error
+			var metadataLength int
+			metadata, metadataLength, err = unpackMetadata(record[n:])
+			if nil != err {
+				return nil, err
+			}
+			n += metadataLength
+		}
+
 		// registrant public key
 		registrantLength, registrantOffset := util.FromVarint64(record[n:])
 		n += registrantOffset
@@ -120,6 +177,7 @@ func (record Packed) Unpack() (interface{}, error) {
 			Description: string(description),
 			Name:        string(name),
 			Fingerprint: string(fingerprint),
+			Metadata:    metadata,
 			Registrant:  registrant,
 			Signature:   signature,
 		}
@@ -167,6 +225,54 @@ func (record Packed) Unpack() (interface{}, error) {
 		}
 		return r, nil
 
+	case BitmarkBatchIssueTag:
+
+		// asset index
+		assetIndexLength, assetIndexOffset := util.FromVarint64(record[n:])
+		n += assetIndexOffset
+		var assetIndex AssetIndex
+		err := AssetIndexFromBytes(&assetIndex, record[n:n+int(assetIndexLength)])
+		if nil != err {
+			return nil, err
+		}
+		n += int(assetIndexLength)
+
+		// owner public key
+		ownerLength, ownerOffset := util.FromVarint64(record[n:])
+		n += ownerOffset
+		owner, err := AddressFromBytes(record[n : n+int(ownerLength)])
+		if nil != err {
+			return nil, err
+		}
+		n += int(ownerLength)
+
+		// first nonce
+		nonce, nonceLength := util.FromVarint64(record[n:])
+		n += int(nonceLength)
+
+		// count
+		count, countLength := util.FromVarint64(record[n:])
+		n += int(countLength)
+		if err := checkBatchRange(nonce, count); nil != err {
+			return nil, err
+		}
+
+		// signature is remainder of record
+		signatureLength, signatureOffset := util.FromVarint64(record[n:])
+		signature := make(Signature, signatureLength)
+		n += signatureOffset
+		copy(signature, record[n:])
+		n += int(signatureLength)
+
+		r := &BitmarkBatchIssue{
+			AssetIndex: assetIndex,
+			Owner:      owner,
+			Nonce:      nonce,
+			Count:      count,
+			Signature:  signature,
+		}
+		return r, nil
+
 	case BitmarkTransferTag:
 
 		// link
@@ -202,11 +308,166 @@ func (record Packed) Unpack() (interface{}, error) {
 		}
 		return r, nil
 
+	case BitmarkBurnTag:
+
+		// link
+		linkLength, linkOffset := util.FromVarint64(record[n:])
+		n += linkOffset
+		var link Link
+		err := LinkFromBytes(&link, record[n:n+int(linkLength)])
+		if nil != err {
+			return nil, err
+		}
+		n += int(linkLength)
+
+		// signature is remainder of record
+		signatureLength, signatureOffset := util.FromVarint64(record[n:])
+		signature := make(Signature, signatureLength)
+		n += signatureOffset
+		copy(signature, record[n:])
+		n += int(signatureLength)
+
+		r := &BitmarkBurn{
+			Link:      link,
+			Signature: signature,
+		}
+		return r, nil
+
+	case BitmarkCountersignedTransferTag:
+
+		// link
+		linkLength, linkOffset := util.FromVarint64(record[n:])
+		n += linkOffset
+		var link Link
+		err := LinkFromBytes(&link, record[n:n+int(linkLength)])
+		if nil != err {
+			return nil, err
+		}
+		n += int(linkLength)
+
+		// owner public key
+		ownerLength, ownerOffset := util.FromVarint64(record[n:])
+		n += ownerOffset
+		owner, err := AddressFromBytes(record[n : n+int(ownerLength)])
+		if nil != err {
+			return nil, err
+		}
+		n += int(ownerLength)
+
+		// expiry
+		expiry, expiryLength := util.FromVarint64(record[n:])
+		n += int(expiryLength)
+
+		// signature of previous owner
+		signatureLength, signatureOffset := util.FromVarint64(record[n:])
+		signature := make(Signature, signatureLength)
+		n += signatureOffset
+		copy(signature, record[n:])
+		n += int(signatureLength)
+
+		// countersignature is remainder of record
+		countersignatureLength, countersignatureOffset := util.FromVarint64(record[n:])
+		countersignature := make(Signature, countersignatureLength)
+		n += countersignatureOffset
+		copy(countersignature, record[n:])
+		n += int(countersignatureLength)
+
+		r := &BitmarkCountersignedTransfer{
+			Link:             link,
+			Owner:            owner,
+			Expiry:           expiry,
+			Signature:        signature,
+			Countersignature: countersignature,
+		}
+		return r, nil
+
 	default:
 	}
 	return nil, fault.ErrNotTransactionPack
 }
 
+// unpack the metadata from the start of a buffer
+//
+// keys must be in strictly ascending order so that there is only one
+// possible encoding of any metadata
+//
+// returns:
+//   the metadata
+//   number of bytes used
+func unpackMetadata(buffer []byte) (map[string]string, int, error) {
+
+	count, n := util.FromVarint64(buffer)
+	if 0 == n || 0 == count || count > maxMetadataItems {
+		return nil, 0, fault.ErrInvalidMetadata
+	}
+
+	metadata := make(map[string]string, count)
+	previous := ""
+	for i := uint64(0); i < count; i += 1 {
+		key, keyLength, ok := unpackString(buffer[n:])
+		if !ok {
+			return nil, 0, fault.ErrInvalidMetadata
+		}
+		n += keyLength
+
+		value, valueLength, ok := unpackString(buffer[n:])
+		if !ok {
+			return nil, 0, fault.ErrInvalidMetadata
+		}
+		n += valueLength
+
+		if 0 != i && key <= previous {
+			return nil, 0, fault.ErrInvalidMetadata
+		}
+		previous = key
+		metadata[key] = value
+	}
+
+	if err := checkMetadata(metadata); nil != err {
+		return nil, 0, err
+	}
+	return metadata, n, nil
+}
+
+// unpack a Varint64(length) prefixed string
+//
+// returns:
+//   the string
+//   number of bytes used
+//   false if the buffer is too short
+func unpackString(buffer []byte) (string, int, bool) {
+	length, n := util.FromVarint64(buffer)
+	if 0 == n || length > uint64(len(buffer)-n) {
+		return "", 0, false
+	}
+	end := n + int(length)
+	return string(buffer[n:end]), end, true
+}
+
+// validate metadata limits
+func checkMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataItems {
+		return fault.ErrMetadataTooLong
+	}
+	total := 0
+	for key, value := range metadata {
+		if "" == key || !utf8.ValidString(key) || !utf8.ValidString(value) {
+			return fault.ErrInvalidMetadata
+		}
+		if utf8.RuneCountInString(key) > maxMetadataKeyLength {
+			return fault.ErrMetadataTooLong
+		}
+		if utf8.RuneCountInString(value) > maxMetadataValueLength {
+			return fault.ErrMetadataTooLong
+		}
+		total += len(key) + len(value)
+	}
+	if total > maxMetadataLength {
+		return fault.ErrMetadataTooLong
+	}
+	return nil
+}
+
 // compute an asset index
 func (assetData *AssetData) AssetIndex() AssetIndex {
 	return NewAssetIndex([]byte(assetData.Fingerprint))
@@ -217,6 +478,10 @@ func (assetData *AssetData) AssetIndex() AssetIndex {
 // Pack Varint64(tag) followed by fields in order as struct above with
 // signature last
 //
+// without metadata the original AssetDataTag record is produced,
+// otherwise an AssetMetadataTag record with the metadata packed as
+// Varint64(count) followed by key, value pairs in key order
+//
 // NOTE: returns the "unsigned" message on signature failure - for
 //       debugging/testing
 func (assetData *AssetData) Pack(address *Address) (Packed, error) {
@@ -236,11 +501,22 @@ func (assetData *AssetData) Pack(address *Address) (Packed, error) {
 		return nil, fault.ErrFingerprintTooLong
 	}
 
+	if err := checkMetadata(assetData.Metadata); nil != err {
+		return nil, err
+	}
+
 	// concatenate bytes
-	message := util.ToVarint64(AssetDataTag)
+	tag := uint64(AssetDataTag)
+	if 0 != len(assetData.Metadata) {
+		tag = AssetMetadataTag
+	}
+	message := util.ToVarint64(tag)
 	message = appendString(message, assetData.Description)
 	message = appendString(message, assetData.Name)
 	message = appendString(message, assetData.Fingerprint)
+	if AssetMetadataTag == tag {
+		message = appendMetadata(message, assetData.Metadata)
+	}
 	message = appendAddress(message, assetData.Registrant)
 
 	// signature
@@ -280,6 +556,50 @@ func (issue *BitmarkIssue) Pack(address *Address) (Packed, error) {
 	return appendBytes(message, issue.Signature), nil
 }
 
+// pack BitmarkBatchIssue
+//
+// Pack Varint64(tag) followed by fields in order as struct above with
+// signature last
+//
+// NOTE: returns the "unsigned" message on signature failure - for
+//       debugging/testing
+func (batch *BitmarkBatchIssue) Pack(address *Address) (Packed, error) {
+	if len(batch.Signature) > maxSignatureLength {
+		return nil, fault.ErrSignatureTooLong
+	}
+
+	if err := checkBatchRange(batch.Nonce, batch.Count); nil != err {
+		return nil, err
+	}
+
+	// concatenate bytes
+	message := util.ToVarint64(BitmarkBatchIssueTag)
+	message = appendBytes(message, batch.AssetIndex.Bytes())
+	message = appendAddress(message, batch.Owner)
+	message = appendUint64(message, batch.Nonce)
+	message = appendUint64(message, batch.Count)
+
+	// signature
+	err := address.CheckSignature(message, batch.Signature)
+	if nil != err {
+		return message, err
+	}
+
+	// Signature Last
+	return appendBytes(message, batch.Signature), nil
+}
+
+// validate the nonce range of a batch issue
+func checkBatchRange(nonce uint64, count uint64) error {
+	if 0 == count || count > maxBatchIssueCount {
+		return fault.ErrInvalidCount
+	}
+	if nonce+count < nonce { // overflow
+		return fault.ErrInvalidCount
+	}
+	return nil
+}
+
 // local function to pack BitmarkTransfer
 //
 // Pack Varint64(tag) followed by fields in order as struct above with
@@ -307,6 +627,91 @@ func (transfer *BitmarkTransfer) Pack(address *Address) (Packed, error) {
 	return appendBytes(message, transfer.Signature), nil
 }
 
+// pack BitmarkBurn
+//
+// Pack Varint64(tag) followed by fields in order as struct above with
+// signature last
+//
+// NOTE: returns the "unsigned" message on signature failure - for
+//       debugging/testing
+func (burn *BitmarkBurn) Pack(address *Address) (Packed, error) {
+	if len(burn.Signature) > maxSignatureLength {
+		return nil, fault.ErrSignatureTooLong
+	}
+
+	// concatenate bytes
+	message := util.ToVarint64(BitmarkBurnTag)
+	message = appendBytes(message, burn.Link.Bytes())
+
+	// signature
+	err := address.CheckSignature(message, burn.Signature)
+	if nil != err {
+		return message, err
+	}
+
+	// Signature Last
+	return appendBytes(message, burn.Signature), nil
+}
+
+// pack the offer part of a BitmarkCountersignedTransfer
+//
+// Pack Varint64(tag) followed by fields in order as struct above up to
+// and including the signature of the previous owner, this is the
+// message that the new owner must countersign
+//
+// NOTE: returns the "unsigned" message on signature failure - for
+//       debugging/testing
+func (transfer *BitmarkCountersignedTransfer) Offer(address *Address) (Packed, error) {
+	if len(transfer.Signature) > maxSignatureLength {
+		return nil, fault.ErrSignatureTooLong
+	}
+
+	// concatenate bytes
+	message := util.ToVarint64(BitmarkCountersignedTransferTag)
+	message = appendBytes(message, transfer.Link.Bytes())
+	message = appendAddress(message, transfer.Owner)
+	message = appendUint64(message, transfer.Expiry)
+
+	// signature
+	err := address.CheckSignature(message, transfer.Signature)
+	if nil != err {
+		return message, err
+	}
+
+	return appendBytes(message, transfer.Signature), nil
+}
+
+// pack BitmarkCountersignedTransfer
+//
+// the offer followed by the countersignature of the new owner
+//
+// NOTE: returns the "uncountersigned" offer on signature failure - for
+//       debugging/testing
+func (transfer *BitmarkCountersignedTransfer) Pack(address *Address) (Packed, error) {
+	if len(transfer.Countersignature) > maxSignatureLength {
+		return nil, fault.ErrSignatureTooLong
+	}
+
+	offer, err := transfer.Offer(address)
+	if nil != err {
+		return offer, err
+	}
+
+	// countersignature
+	err = transfer.Owner.CheckSignature(offer, transfer.Countersignature)
+	if nil != err {
+		return offer, err
+	}
+
+	// Countersignature Last
+	return appendBytes(offer, transfer.Countersignature), nil
+}
+
+// check if the offer has expired
+func (transfer *BitmarkCountersignedTransfer) IsExpired(now time.Time) bool {
+	return 0 != transfer.Expiry && uint64(now.UTC().Unix()) > transfer.Expiry
+}
+
 // append a single field to a buffer
 //
 // the field is prefixed by Varint64(length)
@@ -327,6 +732,24 @@ func appendAddress(buffer Packed, address *Address) Packed {
 	return buffer
 }
 
+// append metadata to a buffer
+//
+// Varint64(count) followed by each key and value in key order
+func appendMetadata(buffer Packed, metadata map[string]string) Packed {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buffer = appendUint64(buffer, uint64(len(keys)))
+	for _, key := range keys {
+		buffer = appendString(buffer, key)
+		buffer = appendString(buffer, metadata[key])
+	}
+	return buffer
+}
+
 // append a bytes to a buffer
 //
 // the field is prefixed by Varint64(length)
@@ -353,3 +776,17 @@ func (p Packed) MarshalJSON() ([]byte, error) {
 	hex.Encode(b[1:], p)
 	return b, nil
 }
+
+// convert a packed from its hex JSON form
+func (p *Packed) UnmarshalJSON(s []byte) error {
+	if len(s) < 2 || '"' != s[0] || '"' != s[len(s)-1] {
+		return fault.ErrInvalidCharacter
+	}
+	b := make([]byte, hex.DecodedLen(len(s)-2))
+	_, err := hex.Decode(b, s[1:len(s)-1])
+	if nil != err {
+		return err
+	}
+	*p = b
+	return nil
+}
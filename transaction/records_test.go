@@ -15,7 +15,9 @@ import (
 	"github.com/bitmark-inc/bitmarkd/transaction"
 	"github.com/bitmark-inc/bitmarkd/util"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // to print a keypair for future tests
@@ -593,3 +595,511 @@ func TestPackBitmarkTransferTwo(t *testing.T) {
 		return
 	}
 }
+
+// test the packing/unpacking of registration record with metadata
+//
+// ensures that pack->unpack returns the same original value
+func TestPackAssetDataWithMetadata(t *testing.T) {
+
+	registrantAddress := makeAddress(&registrant.publicKey)
+
+	r := transaction.AssetData{
+		Description: "Just the description",
+		Name:        "Item's Name",
+		Fingerprint: "0123456789abcdef",
+		Metadata: map[string]string{
+			"type":    "image/png",
+			"creator": "Someone",
+			"licence": "CC-BY",
+		},
+		Registrant: registrantAddress,
+	}
+
+	expected := []byte{
+		0x04, 0x14, 0x4a, 0x75, 0x73, 0x74, 0x20, 0x74,
+		0x68, 0x65, 0x20, 0x64, 0x65, 0x73, 0x63, 0x72,
+		0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x0b, 0x49,
+		0x74, 0x65, 0x6d, 0x27, 0x73, 0x20, 0x4e, 0x61,
+		0x6d, 0x65, 0x10, 0x30, 0x31, 0x32, 0x33, 0x34,
+		0x35, 0x36, 0x37, 0x38, 0x39, 0x61, 0x62, 0x63,
+		0x64, 0x65, 0x66, 0x03, 0x07, 0x63, 0x72, 0x65,
+		0x61, 0x74, 0x6f, 0x72, 0x07, 0x53, 0x6f, 0x6d,
+		0x65, 0x6f, 0x6e, 0x65, 0x07, 0x6c, 0x69, 0x63,
+		0x65, 0x6e, 0x63, 0x65, 0x05, 0x43, 0x43, 0x2d,
+		0x42, 0x59, 0x04, 0x74, 0x79, 0x70, 0x65, 0x09,
+		0x69, 0x6d, 0x61, 0x67, 0x65, 0x2f, 0x70, 0x6e,
+		0x67, 0x21, 0x13, 0x7a, 0x81, 0x92, 0x56, 0x5e,
+		0x6c, 0xa2, 0x35, 0x80, 0xe1, 0x81, 0x59, 0xef,
+		0x30, 0x73, 0xf6, 0xe2, 0xfb, 0x8e, 0x7e, 0x9d,
+		0x31, 0x49, 0x7e, 0x79, 0xd7, 0x73, 0x1b, 0xa3,
+		0x74, 0x11, 0x01,
+	}
+
+	// manually sign the record and attach signature to "expected"
+	signature := ed25519.Sign(&registrant.privateKey, expected)
+	r.Signature = signature[:]
+	l := util.ToVarint64(uint64(len(signature)))
+	expected = append(expected, l...)
+	expected = append(expected, signature[:]...)
+
+	// test the packer
+	packed, err := r.Pack(registrantAddress)
+	if nil != err {
+		t.Errorf("pack error: %v", err)
+	}
+
+	// if either of above fail we will have the message _without_ a signature
+	if !bytes.Equal(packed, expected) {
+		t.Errorf("pack record: %x  expected: %x", packed, expected)
+		t.Errorf("*** GENERATED Packed:\n%s", formatBytes("expected", packed))
+		return
+	}
+
+	// test the unpacker
+	unpacked, err := packed.Unpack()
+	if nil != err {
+		t.Errorf("unpack error: %v", err)
+		return
+	}
+
+	reg, ok := unpacked.(*transaction.AssetData)
+	if !ok {
+		t.Errorf("did not unpack to AssetData")
+		return
+	}
+
+	// display a JSON version for information
+	b, err := json.MarshalIndent(reg, "", "  ")
+	if nil != err {
+		t.Errorf("json error: %v", err)
+		return
+	}
+
+	t.Logf("AssetData: JSON: %s", b)
+
+	// check that structure is preserved through Pack/Unpack
+	// note reg is a pointer here
+	if !reflect.DeepEqual(r, *reg) {
+		t.Errorf("different, original: %v  recovered: %v", r, *reg)
+		return
+	}
+}
+
+// test that non-canonical or oversize metadata is rejected
+func TestInvalidMetadata(t *testing.T) {
+
+	registrantAddress := makeAddress(&registrant.publicKey)
+
+	// keys out of order: "b" before "a"
+	packed := []byte{
+		0x04, 0x00, 0x00, 0x01, 0x30,
+		0x02, 0x01, 0x62, 0x00, 0x01, 0x61, 0x00,
+	}
+	packed = append(packed, 0x21)
+	packed = append(packed, registrantAddress.Bytes()...)
+	packed = append(packed, 0x00)
+
+	if _, err := transaction.Packed(packed).Unpack(); fault.ErrInvalidMetadata != err {
+		t.Errorf("unsorted keys: expected ErrInvalidMetadata but got: %v", err)
+	}
+
+	// duplicate key
+	packed[10] = 0x62
+	if _, err := transaction.Packed(packed).Unpack(); fault.ErrInvalidMetadata != err {
+		t.Errorf("duplicate keys: expected ErrInvalidMetadata but got: %v", err)
+	}
+
+	// correct order unpacks
+	packed[7] = 0x61
+	if _, err := transaction.Packed(packed).Unpack(); nil != err {
+		t.Errorf("sorted keys: unpack error: %v", err)
+	}
+
+	invalid := []map[string]string{
+		{"": "empty key"},
+		{"key": string([]byte{0xff})},
+		{strings.Repeat("k", 65): "long key"},
+		{"key": strings.Repeat("v", 1025)},
+	}
+
+	for i, metadata := range invalid {
+		r := transaction.AssetData{
+			Description: "Just the description",
+			Name:        "Item's Name",
+			Fingerprint: "0123456789abcdef",
+			Metadata:    metadata,
+			Registrant:  registrantAddress,
+		}
+		if _, err := r.Pack(registrantAddress); nil == err {
+			t.Errorf("%d: invalid metadata was packed", i)
+		}
+	}
+}
+
+// test the packing/unpacking of Bitmark batch issue record
+//
+// ensures that pack->unpack returns the same original value
+func TestPackBitmarkBatchIssue(t *testing.T) {
+
+	issuerAddress := makeAddress(&issuer.publicKey)
+
+	var asset transaction.AssetIndex
+	_, err := fmt.Sscan("BMA04473fb34cc05ed9599935a0098ce060dfa546f40932dd7b40d35f8fe5cd6a4ff26f3dbf8ffc86ee8eb6480facfd83f3e20d69bf1e764a59256cf79b89531de37", &asset)
+	if nil != err {
+		t.Errorf("hex to link error: %v", err)
+		return
+	}
+
+	r := transaction.BitmarkBatchIssue{
+		AssetIndex: asset,
+		Owner:      issuerAddress,
+		Nonce:      100,
+		Count:      300,
+	}
+
+	expected := []byte{
+		0x05, 0x40, 0x37, 0xde, 0x31, 0x95, 0xb8, 0x79,
+		0xcf, 0x56, 0x92, 0xa5, 0x64, 0xe7, 0xf1, 0x9b,
+		0xd6, 0x20, 0x3e, 0x3f, 0xd8, 0xcf, 0xfa, 0x80,
+		0x64, 0xeb, 0xe8, 0x6e, 0xc8, 0xff, 0xf8, 0xdb,
+		0xf3, 0x26, 0xff, 0xa4, 0xd6, 0x5c, 0xfe, 0xf8,
+		0x35, 0x0d, 0xb4, 0xd7, 0x2d, 0x93, 0x40, 0x6f,
+		0x54, 0xfa, 0x0d, 0x06, 0xce, 0x98, 0x00, 0x5a,
+		0x93, 0x99, 0x95, 0xed, 0x05, 0xcc, 0x34, 0xfb,
+		0x73, 0x44, 0x21, 0x13, 0x9f, 0xc4, 0x86, 0xa2,
+		0x53, 0x4f, 0x17, 0xe3, 0x67, 0x07, 0xfa, 0x4b,
+		0x95, 0x3e, 0x3b, 0x34, 0x00, 0xe2, 0x72, 0x9f,
+		0x65, 0x61, 0x16, 0xdd, 0x7b, 0x01, 0x8d, 0xf3,
+		0x46, 0x98, 0xbd, 0xc2, 0x64, 0xac, 0x02,
+	}
+
+	// manually sign the record and attach signature to "expected"
+	signature := ed25519.Sign(&issuer.privateKey, expected)
+	r.Signature = signature[:]
+	l := util.ToVarint64(uint64(len(signature)))
+	expected = append(expected, l...)
+	expected = append(expected, signature[:]...)
+
+	// test the packer
+	packed, err := r.Pack(issuerAddress)
+	if nil != err {
+		t.Errorf("pack error: %v", err)
+	}
+
+	// if either of above fail we will have the message _without_ a signature
+	if !bytes.Equal(packed, expected) {
+		t.Errorf("pack record: %x  expected: %x", packed, expected)
+		t.Errorf("*** GENERATED Packed:\n%s", formatBytes("expected", packed))
+		return
+	}
+
+	// test the unpacker
+	unpacked, err := packed.Unpack()
+	if nil != err {
+		t.Errorf("unpack error: %v", err)
+		return
+	}
+
+	batch, ok := unpacked.(*transaction.BitmarkBatchIssue)
+	if !ok {
+		t.Errorf("did not unpack to BitmarkBatchIssue")
+		return
+	}
+
+	// check that structure is preserved through Pack/Unpack
+	// note batch is a pointer here
+	if !reflect.DeepEqual(r, *batch) {
+		t.Errorf("different, original: %v  recovered: %v", r, *batch)
+		return
+	}
+
+	// each bitmark in the batch has a distinct link
+	txId := packed.MakeLink()
+	links := make(map[transaction.Link]struct{})
+	for i := uint64(0); i < r.Count; i += 1 {
+		links[transaction.BatchItemLink(txId, r.Nonce+i)] = struct{}{}
+	}
+	if len(links) != int(r.Count) {
+		t.Errorf("bitmark links: %d  expected: %d", len(links), r.Count)
+	}
+
+	// invalid ranges
+	for _, count := range []uint64{0, 10001} {
+		r.Count = count
+		if _, err := r.Pack(issuerAddress); fault.ErrInvalidCount != err {
+			t.Errorf("count: %d  expected ErrInvalidCount but got: %v", count, err)
+		}
+	}
+	r.Nonce = 18446744073709551615
+	r.Count = 2
+	if _, err := r.Pack(issuerAddress); fault.ErrInvalidCount != err {
+		t.Errorf("nonce overflow: expected ErrInvalidCount but got: %v", err)
+	}
+}
+
+// test the packing/unpacking of a bitmark burn record
+//
+// burns the bitmark created by the second transfer
+func TestPackBitmarkBurn(t *testing.T) {
+
+	ownerTwoAddress := makeAddress(&ownerTwo.publicKey)
+
+	var link transaction.Link
+	_, err := fmt.Sscan("BMK019b9182d7f7f6f76077bdb93008a064318734816d63d7919e50698f5430e5c6c", &link)
+	if nil != err {
+		t.Errorf("hex to link error: %v", err)
+		return
+	}
+
+	r := transaction.BitmarkBurn{
+		Link: link,
+	}
+
+	expected := []byte{
+		0x06, 0x20, 0x6c, 0x5c, 0x0e, 0x43, 0xf5, 0x98,
+		0x06, 0xe5, 0x19, 0x79, 0x3d, 0xd6, 0x16, 0x48,
+		0x73, 0x18, 0x43, 0x06, 0x8a, 0x00, 0x93, 0xdb,
+		0x7b, 0x07, 0x76, 0x6f, 0x7f, 0x7f, 0x2d, 0x18,
+		0xb9, 0x19,
+	}
+
+	// manually sign the record and attach signature to "expected"
+	signature := ed25519.Sign(&ownerTwo.privateKey, expected)
+	r.Signature = signature[:]
+	l := util.ToVarint64(uint64(len(signature)))
+	expected = append(expected, l...)
+	expected = append(expected, signature[:]...)
+
+	// test the packer
+	packed, err := r.Pack(ownerTwoAddress)
+	if nil != err {
+		t.Errorf("pack error: %v", err)
+	}
+
+	// if either of above fail we will have the message _without_ a signature
+	if !bytes.Equal(packed, expected) {
+		t.Errorf("pack record: %x  expected: %x", packed, expected)
+		t.Errorf("*** GENERATED Packed:\n%s", formatBytes("expected", packed))
+		return
+	}
+
+	// test the unpacker
+	unpacked, err := packed.Unpack()
+	if nil != err {
+		t.Errorf("unpack error: %v", err)
+		return
+	}
+
+	burn, ok := unpacked.(*transaction.BitmarkBurn)
+	if !ok {
+		t.Errorf("did not unpack to BitmarkBurn")
+		return
+	}
+
+	// check that structure is preserved through Pack/Unpack
+	// note burn is a pointer here
+	if !reflect.DeepEqual(r, *burn) {
+		t.Errorf("different, original: %v  recovered: %v", r, *burn)
+		return
+	}
+
+	// only the current owner can sign
+	ownerOneAddress := makeAddress(&ownerOne.publicKey)
+	if _, err := r.Pack(ownerOneAddress); fault.ErrInvalidSignature != err {
+		t.Errorf("wrong owner: expected ErrInvalidSignature but got: %v", err)
+	}
+}
+
+// test the packing/unpacking of a countersigned transfer
+//
+// ownerOne offers the bitmark from the first transfer to ownerTwo
+func TestPackBitmarkCountersignedTransfer(t *testing.T) {
+
+	ownerOneAddress := makeAddress(&ownerOne.publicKey)
+	ownerTwoAddress := makeAddress(&ownerTwo.publicKey)
+
+	var link transaction.Link
+	_, err := fmt.Sscan("BMK00bfd865e4c76c6c56babffe4c275578d6410818634afc20bde0ee5a1e312c901", &link)
+	if nil != err {
+		t.Errorf("hex to link error: %v", err)
+		return
+	}
+
+	r := transaction.BitmarkCountersignedTransfer{
+		Link:   link,
+		Owner:  ownerTwoAddress,
+		Expiry: 1450000000,
+	}
+
+	expected := []byte{
+		0x07, 0x20, 0x01, 0xc9, 0x12, 0xe3, 0xa1, 0xe5,
+		0x0e, 0xde, 0x0b, 0xc2, 0xaf, 0x34, 0x86, 0x81,
+		0x10, 0x64, 0x8d, 0x57, 0x75, 0xc2, 0xe4, 0xff,
+		0xab, 0x6b, 0xc5, 0xc6, 0x76, 0x4c, 0x5e, 0x86,
+		0xfd, 0x0b, 0x21, 0x13, 0xa1, 0x36, 0x32, 0xd5,
+		0x42, 0x5a, 0xed, 0x3a, 0x6b, 0x62, 0xe2, 0xbb,
+		0x6d, 0xe4, 0xc9, 0x59, 0x48, 0x41, 0xc1, 0x5b,
+		0x70, 0x15, 0x69, 0xec, 0x99, 0x99, 0xdc, 0x20,
+		0x1c, 0x35, 0xf7, 0xb3, 0x80, 0xfd, 0xb4, 0xb3,
+		0x05,
+	}
+
+	// manually sign the offer and attach signature to "expected"
+	signature := ed25519.Sign(&ownerOne.privateKey, expected)
+	r.Signature = signature[:]
+	l := util.ToVarint64(uint64(len(signature)))
+	expected = append(expected, l...)
+	expected = append(expected, signature[:]...)
+
+	// the offer alone
+	offer, err := r.Offer(ownerOneAddress)
+	if nil != err {
+		t.Errorf("offer error: %v", err)
+	}
+	if !bytes.Equal(offer, expected) {
+		t.Errorf("offer record: %x  expected: %x", offer, expected)
+		t.Errorf("*** GENERATED Packed:\n%s", formatBytes("expected", offer))
+		return
+	}
+
+	// new owner does not countersign
+	if _, err := r.Pack(ownerOneAddress); fault.ErrInvalidSignature != err {
+		t.Errorf("missing countersignature: expected ErrInvalidSignature but got: %v", err)
+	}
+
+	// manually countersign the offer and attach countersignature to "expected"
+	countersignature := ed25519.Sign(&ownerTwo.privateKey, expected)
+	r.Countersignature = countersignature[:]
+	l = util.ToVarint64(uint64(len(countersignature)))
+	expected = append(expected, l...)
+	expected = append(expected, countersignature[:]...)
+
+	// test the packer
+	packed, err := r.Pack(ownerOneAddress)
+	if nil != err {
+		t.Errorf("pack error: %v", err)
+	}
+
+	// if either of above fail we will have the message _without_ a countersignature
+	if !bytes.Equal(packed, expected) {
+		t.Errorf("pack record: %x  expected: %x", packed, expected)
+		t.Errorf("*** GENERATED Packed:\n%s", formatBytes("expected", packed))
+		return
+	}
+
+	// test the unpacker
+	unpacked, err := packed.Unpack()
+	if nil != err {
+		t.Errorf("unpack error: %v", err)
+		return
+	}
+
+	transfer, ok := unpacked.(*transaction.BitmarkCountersignedTransfer)
+	if !ok {
+		t.Errorf("did not unpack to BitmarkCountersignedTransfer")
+		return
+	}
+
+	// check that structure is preserved through Pack/Unpack
+	// note transfer is a pointer here
+	if !reflect.DeepEqual(r, *transfer) {
+		t.Errorf("different, original: %v  recovered: %v", r, *transfer)
+		return
+	}
+
+	// check the expiry
+	if transfer.IsExpired(time.Unix(1450000000, 0)) {
+		t.Errorf("expired at the expiry time")
+	}
+	if !transfer.IsExpired(time.Unix(1450000001, 0)) {
+		t.Errorf("not expired after the expiry time")
+	}
+	transfer.Expiry = 0
+	if transfer.IsExpired(time.Now()) {
+		t.Errorf("zero expiry has expired")
+	}
+}
+
+// test the packing/unpacking of an issue to a secp256k1 owner
+//
+// the signature was created by an external secp256k1 implementation
+func TestPackBitmarkIssueSECP256K1(t *testing.T) {
+
+	publicKey := [33]byte{}
+	copy(publicKey[:], decodeHex("020078069e73d1570a4a1c6bb0f2cca41d3d579e6b62649c349f5453c41f827a60"))
+	ownerAddress := &transaction.Address{
+		AddressInterface: &transaction.SECP256K1Address{
+			Test:      true,
+			PublicKey: &publicKey,
+		},
+	}
+
+	var asset transaction.AssetIndex
+	_, err := fmt.Sscan("BMA04473fb34cc05ed9599935a0098ce060dfa546f40932dd7b40d35f8fe5cd6a4ff26f3dbf8ffc86ee8eb6480facfd83f3e20d69bf1e764a59256cf79b89531de37", &asset)
+	if nil != err {
+		t.Errorf("hex to link error: %v", err)
+		return
+	}
+
+	r := transaction.BitmarkIssue{
+		AssetIndex: asset,
+		Owner:      ownerAddress,
+		Nonce:      99,
+		Signature:  decodeHex("3044022030889d7b3b619896646051e2a567e731e38369eb08a0028b6b85ab43a7cdc42b022051885fd13b8a5b82e7a2abad18d17deaca97eeb3c2fb1b8d6c6f3783144b9d19"),
+	}
+
+	expected := []byte{
+		0x02, 0x40, 0x37, 0xde, 0x31, 0x95, 0xb8, 0x79,
+		0xcf, 0x56, 0x92, 0xa5, 0x64, 0xe7, 0xf1, 0x9b,
+		0xd6, 0x20, 0x3e, 0x3f, 0xd8, 0xcf, 0xfa, 0x80,
+		0x64, 0xeb, 0xe8, 0x6e, 0xc8, 0xff, 0xf8, 0xdb,
+		0xf3, 0x26, 0xff, 0xa4, 0xd6, 0x5c, 0xfe, 0xf8,
+		0x35, 0x0d, 0xb4, 0xd7, 0x2d, 0x93, 0x40, 0x6f,
+		0x54, 0xfa, 0x0d, 0x06, 0xce, 0x98, 0x00, 0x5a,
+		0x93, 0x99, 0x95, 0xed, 0x05, 0xcc, 0x34, 0xfb,
+		0x73, 0x44, 0x22, 0x23, 0x02, 0x00, 0x78, 0x06,
+		0x9e, 0x73, 0xd1, 0x57, 0x0a, 0x4a, 0x1c, 0x6b,
+		0xb0, 0xf2, 0xcc, 0xa4, 0x1d, 0x3d, 0x57, 0x9e,
+		0x6b, 0x62, 0x64, 0x9c, 0x34, 0x9f, 0x54, 0x53,
+		0xc4, 0x1f, 0x82, 0x7a, 0x60, 0x63,
+	}
+	l := util.ToVarint64(uint64(len(r.Signature)))
+	expected = append(expected, l...)
+	expected = append(expected, r.Signature...)
+
+	// test the packer
+	packed, err := r.Pack(ownerAddress)
+	if nil != err {
+		t.Errorf("pack error: %v", err)
+	}
+
+	// if either of above fail we will have the message _without_ a signature
+	if !bytes.Equal(packed, expected) {
+		t.Errorf("pack record: %x  expected: %x", packed, expected)
+		t.Errorf("*** GENERATED Packed:\n%s", formatBytes("expected", packed))
+		return
+	}
+
+	// test the unpacker
+	unpacked, err := packed.Unpack()
+	if nil != err {
+		t.Errorf("unpack error: %v", err)
+		return
+	}
+
+	issue, ok := unpacked.(*transaction.BitmarkIssue)
+	if !ok {
+		t.Errorf("did not unpack to BitmarkIssue")
+		return
+	}
+
+	// check that structure is preserved through Pack/Unpack
+	// note issue is a pointer here
+	if !reflect.DeepEqual(r, *issue) {
+		t.Errorf("different, original: %v  recovered: %v", r, *issue)
+		return
+	}
+	if transaction.SECP256K1 != issue.Owner.KeyType() {
+		t.Errorf("owner key type: %d  expected: %d", issue.Owner.KeyType(), transaction.SECP256K1)
+	}
+}
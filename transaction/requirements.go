@@ -0,0 +1,80 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+// what a transaction needs before it can be put in a block
+type Requirements struct {
+	Record   interface{} // the unpacked transaction
+	Requires []Link      // records not yet mined that must come first in the block
+	Spends   *Link       // the bitmark moved by a transfer or burn
+	Signer   string      // public key that signed it, empty if not known
+}
+
+// determine the requirements of an available transaction
+//
+// a transfer of a bitmark from a batch issue that is not yet mined
+// requires the bitmark link, which is only known to the batch issue
+//
+// returns false if the transaction is no longer waiting to be mined
+func (link Link) Requirements() (Requirements, bool) {
+
+	state, packed, found := link.Read()
+	if !found || (AvailableTransaction != state && WaitingIssueTransaction != state) {
+		return Requirements{}, false
+	}
+
+	record, err := packed.Unpack()
+	if nil != err {
+		return Requirements{}, false
+	}
+
+	r := Requirements{
+		Record: record,
+	}
+
+	switch record.(type) {
+	case *AssetData:
+		r.Signer = string(record.(*AssetData).Registrant.PublicKeyBytes())
+
+	case *BitmarkIssue, *BitmarkBatchIssue:
+		r.Signer = string(bitmarkOwner(record).PublicKeyBytes())
+
+		state, assetLink, found := issueAssetIndex(record).Read()
+		if !found {
+			return Requirements{}, false
+		}
+		if MinedTransaction != state {
+			r.Requires = []Link{assetLink}
+		}
+
+	case *BitmarkTransfer, *BitmarkBurn, *BitmarkCountersignedTransfer:
+		previousLink := bitmarkLink(record)
+		r.Spends = &previousLink
+
+		// a current bitmark has its owner recorded
+		if owner, found := transactionPool.ownerPool.Get(previousLink.Bytes()); found && len(owner) > LinkSize {
+			r.Signer = string(owner[:len(owner)-LinkSize])
+			break
+		}
+
+		// otherwise the previous record must come first
+		r.Requires = []Link{previousLink}
+		state, packed, found := previousLink.Read()
+		if !found || MinedTransaction == state {
+			break
+		}
+		previous, err := packed.Unpack()
+		if nil != err {
+			break
+		}
+		if owner := bitmarkOwner(previous); nil != owner {
+			r.Signer = string(owner.PublicKeyBytes())
+		}
+
+	default:
+	}
+
+	return r, true
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"bytes"
+	"github.com/bitmark-inc/bitmarkd/block"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/gnomon"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the secondary indexes on mined assets
+type AssetSearch byte
+
+const (
+	SearchName        = AssetSearch('N') // any normalised token of the name
+	SearchRegistrant  = AssetSearch('R') // registrant public key
+	SearchFingerprint = AssetSearch('F') // start of the fingerprint
+)
+
+// limits on indexed terms
+const (
+	maxNameTokens           = 16  // tokens indexed from each name
+	maxTermLength           = 255 // term length is stored as a byte
+	fingerprintPrefixLength = 16  // longest fingerprint prefix indexed
+)
+
+// most index entries examined by one search so that a name whose
+// tokens are common but rarely together cannot cause a scan of the
+// whole index
+const maximumSearchScan = 10000
+
+// set once all assets mined before the indexes existed are indexed
+var searchCompleteKey = []byte{0x00}
+
+// split a name into lower case tokens of letters and digits
+//
+// duplicates are removed and tokens too long to index are skipped
+func nameTokens(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+
+	tokens := make([]string, 0, len(fields))
+	seen := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		if len(f) > maxTermLength {
+			continue
+		}
+		if _, found := seen[f]; found {
+			continue
+		}
+		seen[f] = struct{}{}
+		tokens = append(tokens, f)
+		if len(tokens) >= maxNameTokens {
+			break
+		}
+	}
+	return tokens
+}
+
+// the key prefix for all entries of a term
+//
+//   kind ++ byte[length of term] ++ term
+func searchPrefix(kind AssetSearch, term []byte) []byte {
+	prefix := make([]byte, 2, len(term)+2)
+	prefix[0] = byte(kind)
+	prefix[1] = byte(len(term))
+	return append(prefix, term...)
+}
+
+// add a mined asset to the search indexes
+//
+// the key ends with a cursor so that each term lists its assets in
+// the order they were mined, the value is the AssetData txId
+//
+// only call while transactionPool locked
+func indexAsset(asset *AssetData, txId []byte) {
+	cursor, err := gnomon.NewCursor().MarshalBinary()
+	fault.PanicIfError("transaction.indexAsset", err)
+
+	add := func(kind AssetSearch, term []byte) {
+		key := append(searchPrefix(kind, term), cursor...)
+		transactionPool.searchPool.Add(key, txId)
+	}
+
+	for _, token := range nameTokens(asset.Name) {
+		add(SearchName, []byte(token))
+	}
+
+	add(SearchRegistrant, asset.Registrant.PublicKeyBytes())
+
+	fingerprint := []byte(asset.Fingerprint)
+	for i := 1; i <= len(fingerprint) && i <= fingerprintPrefixLength; i += 1 {
+		add(SearchFingerprint, fingerprint[:i])
+	}
+}
+
+// index the assets mined before the search indexes existed
+//
+// any partial index is discarded and all mined assets are indexed in
+// block order, this is only done once
+//
+// only call while transactionPool locked
+func rebuildSearch(lastBlock uint64) {
+	if _, found := transactionPool.searchPool.Get(searchCompleteKey); found {
+		return
+	}
+
+	start := []byte{}
+	for {
+		elements, err := transactionPool.searchPool.Fetch(start, 100)
+		fault.PanicIfError("transaction.rebuildSearch", err)
+		if 0 == len(elements) {
+			break
+		}
+		for _, e := range elements {
+			transactionPool.searchPool.Remove(e.Key)
+		}
+		start = append(elements[len(elements)-1].Key, 0x00)
+	}
+
+	count := 0
+	for n := uint64(2); n < lastBlock; n += 1 {
+		packed, found := block.Get(n)
+		if !found {
+			continue
+		}
+		var blk block.Block
+		err := packed.Unpack(&blk)
+		fault.PanicIfError("transaction.rebuildSearch: block unpack", err)
+
+		for _, txId := range blk.TxIds {
+			indexBuffer := Link(txId).Bytes()
+			rawTx, found := transactionPool.dataPool.Get(indexBuffer)
+			if !found {
+				continue
+			}
+			record, err := Packed(rawTx).Unpack()
+			if nil != err {
+				continue
+			}
+			if asset, ok := record.(*AssetData); ok {
+				indexAsset(asset, indexBuffer)
+				count += 1
+			}
+		}
+	}
+
+	transactionPool.searchPool.Add(searchCompleteKey, []byte{0x01})
+	transactionPool.log.Infof("search: indexed mined assets: %d", count)
+}
+
+// find mined assets
+//
+// the term is a name, the bytes of a registrant public key or the
+// start of a fingerprint; a name with several tokens only matches
+// assets having all of them
+//
+// returns:
+//   the AssetData txIds in the order they were mined
+//   the cursor to continue the search
+//
+// at most maximumSearchScan index entries are examined, so fewer than
+// count txIds may be returned even though more matches exist
+func SearchAssets(kind AssetSearch, term []byte, start *gnomon.Cursor, count int) ([]Link, *gnomon.Cursor, error) {
+	if nil == start {
+		start = &gnomon.Cursor{}
+	}
+
+	if count <= 0 {
+		return nil, nil, fault.ErrInvalidCount
+	}
+
+	// select the index and any extra check on each asset
+	var indexTerm []byte
+	var match func(asset *AssetData) bool
+
+	switch kind {
+	case SearchName:
+		tokens := nameTokens(string(term))
+		if 0 == len(tokens) {
+			return nil, nil, fault.ErrInvalidSearch
+		}
+		// the longest token is likely to have the fewest entries
+		longest := tokens[0]
+		for _, t := range tokens[1:] {
+			if len(t) > len(longest) {
+				longest = t
+			}
+		}
+		indexTerm = []byte(longest)
+		if len(tokens) > 1 {
+			match = func(asset *AssetData) bool {
+				present := nameTokens(asset.Name)
+			loop:
+				for _, t := range tokens {
+					for _, p := range present {
+						if p == t {
+							continue loop
+						}
+					}
+					return false
+				}
+				return true
+			}
+		}
+
+	case SearchRegistrant:
+		if 0 == len(term) || len(term) > maxTermLength {
+			return nil, nil, fault.ErrInvalidSearch
+		}
+		indexTerm = term
+
+	case SearchFingerprint:
+		if 0 == len(term) || utf8.RuneCount(term) > maxFingerprintLength {
+			return nil, nil, fault.ErrInvalidSearch
+		}
+		indexTerm = term
+		if len(term) > fingerprintPrefixLength {
+			indexTerm = term[:fingerprintPrefixLength]
+			match = func(asset *AssetData) bool {
+				return bytes.HasPrefix([]byte(asset.Fingerprint), term)
+			}
+		}
+
+	default:
+		return nil, nil, fault.ErrInvalidSearch
+	}
+
+	prefix := searchPrefix(kind, indexTerm)
+	position, err := start.MarshalBinary()
+	if nil != err {
+		return nil, nil, err
+	}
+
+	transactionPool.RLock()
+	defer transactionPool.RUnlock()
+
+	txIds := make([]Link, 0, count)
+	last := []byte(nil)
+	scanned := 0
+
+fetch:
+	for len(txIds) < count && scanned < maximumSearchScan {
+		n := count - len(txIds)
+		if n > maximumSearchScan-scanned {
+			n = maximumSearchScan - scanned
+		}
+		elements, err := transactionPool.searchPool.FetchPrefixed(prefix, position, n)
+		if nil != err {
+			return nil, nil, err
+		}
+		if 0 == len(elements) {
+			break fetch
+		}
+		scanned += len(elements)
+
+		for _, e := range elements {
+			last = e.Key
+
+			var txId Link
+			err := LinkFromBytes(&txId, e.Value)
+			if nil != err {
+				continue
+			}
+
+			if nil != match {
+				packed, found := transactionPool.dataPool.Get(e.Value)
+				if !found {
+					continue
+				}
+				record, err := Packed(packed).Unpack()
+				if nil != err {
+					continue
+				}
+				asset, ok := record.(*AssetData)
+				if !ok || !match(asset) {
+					continue
+				}
+			}
+			txIds = append(txIds, txId)
+		}
+
+		next := gnomon.Cursor{}
+		err = next.UnmarshalBinary(last)
+		if nil != err {
+			return nil, nil, err
+		}
+		next.Next()
+		position, _ = next.MarshalBinary()
+	}
+
+	// only advance the cursor if entries were read
+	if nil == last {
+		return txIds, start, nil
+	}
+	nextStart := gnomon.Cursor{}
+	err = nextStart.UnmarshalBinary(position)
+	if nil != err {
+		return nil, nil, err
+	}
+	return txIds, &nextStart, nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"crypto/rand"
+	"github.com/agl/ed25519"
+	"github.com/bitmark-inc/bitmarkd/mode"
+	"github.com/bitmark-inc/bitmarkd/pool"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// test database file
+const searchDatabase = "search.leveldb"
+
+// check names are split into normalised tokens
+func TestNameTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+	}{
+		{"", []string{}},
+		{"Item's Name", []string{"item", "s", "name"}},
+		{"  The  RED red-Car, 2015 ", []string{"the", "red", "car", "2015"}},
+		{"Café Über", []string{"café", "über"}},
+		{"a b c d e f g h i j k l m n o p q r", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p"}},
+	}
+
+	for i, item := range tests {
+		tokens := nameTokens(item.name)
+		if !reflect.DeepEqual(item.tokens, tokens) {
+			t.Errorf("%d: name: %q  tokens: %q  expected: %q", i, item.name, tokens, item.tokens)
+		}
+	}
+}
+
+// test indexing, searching and continuing a search
+func TestSearchAssets(t *testing.T) {
+	os.RemoveAll(searchDatabase)
+	pool.Initialise(searchDatabase)
+	defer func() {
+		Finalise()
+		transactionPool.initialised = false
+		pool.Finalise()
+		os.RemoveAll(searchDatabase)
+	}()
+
+	Initialise(10)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("generate key error: %v", err)
+	}
+	address := &Address{
+		AddressInterface: &ED25519Address{
+			Test:      mode.IsTesting(),
+			PublicKey: publicKey,
+		},
+	}
+
+	// store and index as if mined
+	mined := func(name string, fingerprint string) Link {
+		record := &AssetData{
+			Name:        name,
+			Fingerprint: fingerprint,
+			Registrant:  address,
+		}
+		message, _ := record.Pack(address)
+		signature := ed25519.Sign(privateKey, message)
+		record.Signature = signature[:]
+		packed, err := record.Pack(address)
+		if nil != err {
+			t.Fatalf("pack error: %v", err)
+		}
+		link := packed.MakeLink()
+		transactionPool.Lock()
+		transactionPool.dataPool.Add(link.Bytes(), packed)
+		indexAsset(record, link.Bytes())
+		transactionPool.Unlock()
+		return link
+	}
+
+	red := mined("Red Car", "0123456789abcdef-red-car")
+	blue := mined("Blue Car", "0123456789abcdef-blue-car")
+	redBoat := mined("Red Boat", "fedcba9876543210-red-boat")
+
+	tests := []struct {
+		kind  AssetSearch
+		term  string
+		links []Link
+	}{
+		{SearchName, "car", []Link{red, blue}},
+		{SearchName, "RED", []Link{red, redBoat}},
+		{SearchName, "red car", []Link{red}},
+		{SearchName, "green", []Link{}},
+		{SearchRegistrant, string(publicKey[:]), []Link{red, blue, redBoat}},
+		{SearchFingerprint, "0123", []Link{red, blue}},
+		{SearchFingerprint, "0123456789abcdef-b", []Link{blue}},
+	}
+
+	for i, item := range tests {
+		links, _, err := SearchAssets(item.kind, []byte(item.term), nil, 10)
+		if nil != err {
+			t.Errorf("%d: %c %q  error: %v", i, item.kind, item.term, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.links, links) {
+			t.Errorf("%d: %c %q  links: %v  expected: %v", i, item.kind, item.term, links, item.links)
+		}
+	}
+
+	// continue from the returned cursor
+	term := publicKey[:]
+	links, cursor, err := SearchAssets(SearchRegistrant, term, nil, 2)
+	if nil != err {
+		t.Fatalf("first page error: %v", err)
+	}
+	if !reflect.DeepEqual([]Link{red, blue}, links) {
+		t.Errorf("first page: %v", links)
+	}
+	links, cursor, err = SearchAssets(SearchRegistrant, term, cursor, 2)
+	if nil != err {
+		t.Fatalf("second page error: %v", err)
+	}
+	if !reflect.DeepEqual([]Link{redBoat}, links) {
+		t.Errorf("second page: %v", links)
+	}
+	links, _, err = SearchAssets(SearchRegistrant, term, cursor, 2)
+	if nil != err || 0 != len(links) {
+		t.Errorf("third page: %v  error: %v", links, err)
+	}
+
+	// a restart must not index the assets again
+	Finalise()
+	transactionPool.initialised = false
+	Initialise(10)
+	links, _, err = SearchAssets(SearchRegistrant, term, nil, 10)
+	if nil != err || 3 != len(links) {
+		t.Errorf("after restart: %v  error: %v", links, err)
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// secp256k1 signature verification
+//
+// only verification is needed so this is kept here rather than
+// depending on a complete bitcoin library, none of it is secret so
+// the arithmetic does not need to be constant time
+//
+// points are multiplied in Jacobian coordinates with a fixed window
+// over 64 bit limbs, which is more than ten times faster than affine
+// big.Int arithmetic
+
+// size of a compressed public key: 02/03 prefix and X coordinate
+const secp256k1PublicKeySize = 33
+
+// curve parameters: y² = x³ + 7 (mod p)
+var (
+	secp256k1P     = hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	secp256k1N     = hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+	secp256k1Gx    = hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	secp256k1Gy    = hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	secp256k1B     = big.NewInt(7)
+)
+
+func hexInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid hex constant: " + s)
+	}
+	return n
+}
+
+// a point on the curve, nil X is the point at infinity
+type secp256k1Point struct {
+	x *big.Int
+	y *big.Int
+}
+
+// decompress a public key
+//
+// returns false if it is not a valid point on the curve
+func secp256k1ParsePublicKey(key []byte) (secp256k1Point, bool) {
+
+	if secp256k1PublicKeySize != len(key) || (0x02 != key[0] && 0x03 != key[0]) {
+		return secp256k1Point{}, false
+	}
+
+	p := secp256k1P
+	x := new(big.Int).SetBytes(key[1:])
+	if x.Cmp(p) >= 0 {
+		return secp256k1Point{}, false
+	}
+
+	// y = sqrt(x³ + 7), p ≡ 3 (mod 4) so sqrt(c) = c^((p+1)/4)
+	c := new(big.Int).Mul(x, x)
+	c.Mul(c, x)
+	c.Add(c, secp256k1B)
+	c.Mod(c, p)
+	e := new(big.Int).Add(p, big.NewInt(1))
+	e.Rsh(e, 2)
+	y := new(big.Int).Exp(c, e, p)
+
+	// no square root: not on the curve
+	check := new(big.Int).Mul(y, y)
+	if 0 != check.Mod(check, p).Cmp(c) {
+		return secp256k1Point{}, false
+	}
+
+	if y.Bit(0) != uint(key[0]&0x01) {
+		y.Sub(p, y)
+	}
+	return secp256k1Point{x: x, y: y}, true
+}
+
+// parse a signature that must be strict DER with a low S value
+//
+// only one encoding of a signature is accepted, otherwise the
+// signature could be altered (e.g. S replaced by N-S) to make a
+// different but still valid record
+func secp256k1ParseSignature(signature []byte) (*big.Int, *big.Int, bool) {
+
+	// 30 len 02 len R 02 len S
+	if len(signature) < 8 || len(signature) > 72 {
+		return nil, nil, false
+	}
+	if 0x30 != signature[0] || int(signature[1]) != len(signature)-2 {
+		return nil, nil, false
+	}
+
+	r, rest, ok := derInteger(signature[2:])
+	if !ok {
+		return nil, nil, false
+	}
+	s, rest, ok := derInteger(rest)
+	if !ok || 0 != len(rest) {
+		return nil, nil, false
+	}
+
+	if r.Cmp(secp256k1N) >= 0 || s.Cmp(secp256k1HalfN) > 0 {
+		return nil, nil, false
+	}
+	return r, s, true
+}
+
+// read one positive minimally encoded DER integer
+func derInteger(buffer []byte) (*big.Int, []byte, bool) {
+	if len(buffer) < 3 || 0x02 != buffer[0] {
+		return nil, nil, false
+	}
+	length := int(buffer[1])
+	if 0 == length || length > 33 || length+2 > len(buffer) {
+		return nil, nil, false
+	}
+	value := buffer[2 : 2+length]
+
+	// negative
+	if 0 != value[0]&0x80 {
+		return nil, nil, false
+	}
+	// unnecessary leading zero
+	if length > 1 && 0x00 == value[0] && 0 == value[1]&0x80 {
+		return nil, nil, false
+	}
+
+	n := new(big.Int).SetBytes(value)
+	if 0 == n.Sign() {
+		return nil, nil, false
+	}
+	return n, buffer[2+length:], true
+}
+
+// verify an ECDSA signature of a digest
+func secp256k1Verify(publicKey secp256k1Point, digest []byte, r *big.Int, s *big.Int) bool {
+
+	n := secp256k1N
+	e := new(big.Int).SetBytes(digest)
+	w := new(big.Int).ModInverse(s, n)
+	if nil == w {
+		return false
+	}
+	u1 := new(big.Int).Mul(e, w)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, n)
+
+	point := secp256k1MultiplyAdd(u1, secp256k1Table(publicKey), u2)
+	if point.z.isZero() {
+		return false
+	}
+
+	// only the x coordinate is needed: x = X / Z²
+	zInverse := new(big.Int).ModInverse(point.z.big(), secp256k1P)
+	z2 := secp256k1FieldFromBig(zInverse).square()
+	x := z2.multiply(point.x).big()
+	x.Mod(x, n)
+	return 0 == x.Cmp(r)
+}
+
+// scalar multiplication uses a fixed window of this many bits
+const secp256k1Window = 4
+
+// a point in Jacobian coordinates (X/Z², Y/Z³), zero Z is the point
+// at infinity
+//
+// this avoids a modular inverse for every addition, only a single
+// inverse is needed to recover the final x coordinate
+type secp256k1Jacobian struct {
+	x secp256k1Field
+	y secp256k1Field
+	z secp256k1Field
+}
+
+// multiples 0…15 × G, computed once as G never changes
+var secp256k1GTable = secp256k1Table(secp256k1Point{x: secp256k1Gx, y: secp256k1Gy})
+
+// multiples 0…15 × point for the fixed window
+func secp256k1Table(point secp256k1Point) []secp256k1Jacobian {
+	table := make([]secp256k1Jacobian, 1<<secp256k1Window)
+	table[1] = secp256k1Jacobian{
+		x: secp256k1FieldFromBig(point.x),
+		y: secp256k1FieldFromBig(point.y),
+		z: secp256k1Field{1},
+	}
+	for i := 2; i < len(table); i += 1 {
+		table[i] = table[i-1].add(table[1])
+	}
+	return table
+}
+
+// k1 × G + k2 × point, both scalars share the same doublings
+func secp256k1MultiplyAdd(k1 *big.Int, table []secp256k1Jacobian, k2 *big.Int) secp256k1Jacobian {
+
+	result := secp256k1Jacobian{}
+
+	bits := k1.BitLen()
+	if k2.BitLen() > bits {
+		bits = k2.BitLen()
+	}
+	top := (bits + secp256k1Window - 1) / secp256k1Window * secp256k1Window
+
+	for i := top - secp256k1Window; i >= 0; i -= secp256k1Window {
+		for j := 0; j < secp256k1Window; j += 1 {
+			result = result.double()
+		}
+		if w := secp256k1Digit(k1, i); 0 != w {
+			result = result.add(secp256k1GTable[w])
+		}
+		if w := secp256k1Digit(k2, i); 0 != w {
+			result = result.add(table[w])
+		}
+	}
+	return result
+}
+
+// the window of bits of k starting at bit i
+func secp256k1Digit(k *big.Int, i int) int {
+	w := 0
+	for j := secp256k1Window - 1; j >= 0; j -= 1 {
+		w = w<<1 | int(k.Bit(i+j))
+	}
+	return w
+}
+
+// 2a for a curve with zero a coefficient (dbl-2009-l)
+func (a secp256k1Jacobian) double() secp256k1Jacobian {
+	if a.z.isZero() || a.y.isZero() {
+		return secp256k1Jacobian{}
+	}
+
+	// A = X², B = Y², C = B²
+	A := a.x.square()
+	B := a.y.square()
+	C := B.square()
+
+	// D = 2((X + B)² - A - C)
+	D := a.x.add(B).square().subtract(A).subtract(C)
+	D = D.add(D)
+
+	// E = 3A, F = E²
+	E := A.add(A).add(A)
+	F := E.square()
+
+	// X3 = F - 2D
+	x := F.subtract(D.add(D))
+
+	// Y3 = E(D - X3) - 8C
+	C = C.add(C)
+	C = C.add(C)
+	C = C.add(C)
+	y := E.multiply(D.subtract(x)).subtract(C)
+
+	// Z3 = 2YZ
+	z := a.y.multiply(a.z)
+	z = z.add(z)
+
+	return secp256k1Jacobian{x: x, y: y, z: z}
+}
+
+// a + b (add-2007-bl)
+func (a secp256k1Jacobian) add(b secp256k1Jacobian) secp256k1Jacobian {
+	if a.z.isZero() {
+		return b
+	}
+	if b.z.isZero() {
+		return a
+	}
+
+	// U1 = X1·Z2², U2 = X2·Z1², S1 = Y1·Z2³, S2 = Y2·Z1³
+	z1z1 := a.z.square()
+	z2z2 := b.z.square()
+	u1 := a.x.multiply(z2z2)
+	u2 := b.x.multiply(z1z1)
+	s1 := a.y.multiply(b.z).multiply(z2z2)
+	s2 := b.y.multiply(a.z).multiply(z1z1)
+
+	// H = U2 - U1, r = 2(S2 - S1)
+	h := u2.subtract(u1)
+	r := s2.subtract(s1)
+	r = r.add(r)
+
+	// same x coordinate: either the same point or a = -b
+	if h.isZero() {
+		if r.isZero() {
+			return a.double()
+		}
+		return secp256k1Jacobian{}
+	}
+
+	// I = (2H)², J = H·I, V = U1·I
+	i := h.add(h).square()
+	j := h.multiply(i)
+	v := u1.multiply(i)
+
+	// X3 = r² - J - 2V
+	x := r.square().subtract(j).subtract(v.add(v))
+
+	// Y3 = r(V - X3) - 2·S1·J
+	s1j := s1.multiply(j)
+	y := r.multiply(v.subtract(x)).subtract(s1j.add(s1j))
+
+	// Z3 = ((Z1 + Z2)² - Z1Z1 - Z2Z2)·H
+	z := a.z.add(b.z).square().subtract(z1z1).subtract(z2z2).multiply(h)
+
+	return secp256k1Jacobian{x: x, y: y, z: z}
+}
+
+// an element of the field (mod p) as little endian 64 bit limbs,
+// always fully reduced
+//
+// fixed size values avoid the allocations of big.Int which would
+// otherwise dominate the time taken
+type secp256k1Field [4]uint64
+
+// p as limbs and 2²⁵⁶ - p, so that 2²⁵⁶ ≡ C (mod p)
+var secp256k1FieldP = secp256k1Field{0xfffffffefffffc2f, 0xffffffffffffffff, 0xffffffffffffffff, 0xffffffffffffffff}
+
+const secp256k1FieldC = 0x1000003d1
+
+func secp256k1FieldFromBig(n *big.Int) secp256k1Field {
+	buffer := make([]byte, 32)
+	n.FillBytes(buffer)
+	f := secp256k1Field{}
+	for i := 0; i < 4; i += 1 {
+		f[i] = binary.BigEndian.Uint64(buffer[24-8*i:])
+	}
+	return f
+}
+
+func (a secp256k1Field) big() *big.Int {
+	buffer := make([]byte, 32)
+	for i := 0; i < 4; i += 1 {
+		binary.BigEndian.PutUint64(buffer[24-8*i:], a[i])
+	}
+	return new(big.Int).SetBytes(buffer)
+}
+
+func (a secp256k1Field) isZero() bool {
+	return 0 == a[0]|a[1]|a[2]|a[3]
+}
+
+// a - p if that does not borrow, i.e. a (mod p) for a < 2p
+func (a secp256k1Field) reduceOnce(carry uint64) secp256k1Field {
+	d := secp256k1Field{}
+	borrow := uint64(0)
+	for i := 0; i < 4; i += 1 {
+		d[i], borrow = bits.Sub64(a[i], secp256k1FieldP[i], borrow)
+	}
+	if 0 != carry || 0 == borrow {
+		return d
+	}
+	return a
+}
+
+// a + b (mod p)
+func (a secp256k1Field) add(b secp256k1Field) secp256k1Field {
+	s := secp256k1Field{}
+	carry := uint64(0)
+	for i := 0; i < 4; i += 1 {
+		s[i], carry = bits.Add64(a[i], b[i], carry)
+	}
+	return s.reduceOnce(carry)
+}
+
+// a - b (mod p)
+func (a secp256k1Field) subtract(b secp256k1Field) secp256k1Field {
+	d := secp256k1Field{}
+	borrow := uint64(0)
+	for i := 0; i < 4; i += 1 {
+		d[i], borrow = bits.Sub64(a[i], b[i], borrow)
+	}
+	if 0 != borrow {
+		carry := uint64(0)
+		for i := 0; i < 4; i += 1 {
+			d[i], carry = bits.Add64(d[i], secp256k1FieldP[i], carry)
+		}
+	}
+	return d
+}
+
+// a × b (mod p)
+func (a secp256k1Field) multiply(b secp256k1Field) secp256k1Field {
+
+	// 512 bit product
+	r := [8]uint64{}
+	for i := 0; i < 4; i += 1 {
+		carry := uint64(0)
+		for j := 0; j < 4; j += 1 {
+			high, low := bits.Mul64(a[i], b[j])
+			var c uint64
+			low, c = bits.Add64(low, r[i+j], 0)
+			high += c
+			low, c = bits.Add64(low, carry, 0)
+			high += c
+			r[i+j] = low
+			carry = high
+		}
+		r[i+4] = carry
+	}
+
+	// fold the high half: H·2²⁵⁶ + L ≡ H·C + L
+	t := secp256k1Field{}
+	carry := uint64(0)
+	for i := 0; i < 4; i += 1 {
+		high, low := bits.Mul64(r[4+i], secp256k1FieldC)
+		var c uint64
+		low, c = bits.Add64(low, r[i], 0)
+		high += c
+		low, c = bits.Add64(low, carry, 0)
+		high += c
+		t[i] = low
+		carry = high
+	}
+
+	// and the remaining few bits above 2²⁵⁶
+	high, low := bits.Mul64(carry, secp256k1FieldC)
+	t[0], carry = bits.Add64(t[0], low, 0)
+	t[1], carry = bits.Add64(t[1], high, carry)
+	t[2], carry = bits.Add64(t[2], 0, carry)
+	t[3], carry = bits.Add64(t[3], 0, carry)
+
+	// a final overflow leaves t small, so this cannot carry
+	if 0 != carry {
+		t[0], carry = bits.Add64(t[0], secp256k1FieldC, 0)
+		t[1], carry = bits.Add64(t[1], 0, carry)
+		t[2], carry = bits.Add64(t[2], 0, carry)
+		t[3], _ = bits.Add64(t[3], 0, carry)
+	}
+	return t.reduceOnce(0)
+}
+
+// a² (mod p)
+func (a secp256k1Field) square() secp256k1Field {
+	return a.multiply(a)
+}
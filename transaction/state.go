@@ -5,7 +5,7 @@
 package transaction
 
 import (
-//"encoding/binary"
+	"github.com/bitmark-inc/bitmarkd/fault"
 )
 
 // type for transaction state
@@ -51,3 +51,23 @@ func (state State) MarshalText() ([]byte, error) {
 	}
 	return []byte(s), nil
 }
+
+// convert text to a state
+//
+// only the first character is significant
+func (state *State) UnmarshalText(s []byte) error {
+	if 0 == len(s) {
+		return fault.ErrInvalidState
+	}
+	c := s[0]
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch State(c) {
+	case ExpiredTransaction, WaitingIssueTransaction, UnpaidTransaction, AvailableTransaction, MinedTransaction:
+		*state = State(c)
+	default:
+		return fault.ErrInvalidState
+	}
+	return nil
+}
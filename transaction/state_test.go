@@ -0,0 +1,45 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package transaction
+
+import (
+	"encoding/json"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"testing"
+)
+
+// check states survive a JSON round trip
+func TestStateJSON(t *testing.T) {
+	states := []State{
+		ExpiredTransaction,
+		WaitingIssueTransaction,
+		UnpaidTransaction,
+		AvailableTransaction,
+		MinedTransaction,
+	}
+
+	for i, state := range states {
+		b, err := json.Marshal(state)
+		if nil != err {
+			t.Fatalf("%d: marshal error: %v", i, err)
+		}
+		var s State
+		err = json.Unmarshal(b, &s)
+		if nil != err {
+			t.Fatalf("%d: %s  unmarshal error: %v", i, b, err)
+		}
+		if state != s {
+			t.Errorf("%d: %s → %q  expected: %q", i, b, s, state)
+		}
+	}
+
+	var s State
+	if err := s.UnmarshalText([]byte("available")); nil != err || AvailableTransaction != s {
+		t.Errorf("lower case: %q  error: %v", s, err)
+	}
+	if err := s.UnmarshalText([]byte("Xyz")); fault.ErrInvalidState != err {
+		t.Errorf("invalid: expected ErrInvalidState but got: %v", err)
+	}
+}
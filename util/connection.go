@@ -0,0 +1,174 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"net"
+	"sync"
+	"time"
+)
+
+// how long a recorded client certificate fingerprint is kept
+const fingerprintLifetime = time.Hour
+
+// fingerprints of client certificates by remote "host:port"
+//
+// recorded during the TLS handshake, as the listener's client
+// connection does not give access to the TLS connection state
+var clientCertificates = struct {
+	sync.Mutex
+	fingerprints map[string]recordedFingerprint
+	purged       time.Time
+}{
+	fingerprints: make(map[string]recordedFingerprint),
+}
+
+type recordedFingerprint struct {
+	fingerprint FingerprintBytes
+	recorded    time.Time
+}
+
+// the listener passes its own client connection wrapper to the
+// callback rather than the underlying net.Conn, so accept either
+// form of RemoteAddr
+type remoteAddressString interface {
+	RemoteAddr() string
+}
+
+type remoteAddress interface {
+	RemoteAddr() net.Addr
+}
+
+// the address used to identify a client
+//
+// conn is the listener's client connection or a net.Conn, the
+// port is dropped so that all connections from one host are counted
+// together
+func ClientAddress(conn interface{}) (string, error) {
+
+	address := ""
+	switch c := conn.(type) {
+	case remoteAddressString:
+		address = c.RemoteAddr()
+	case remoteAddress:
+		if a := c.RemoteAddr(); nil != a {
+			address = a.String()
+		}
+	}
+	if "" == address {
+		return "", fault.ErrClientAddressMissing
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if nil != err {
+		return address, nil
+	}
+	return host, nil
+}
+
+// request client certificates on a server configuration and record
+// the fingerprint of each one for ClientFingerprint
+//
+// certificates are not verified, only matched by fingerprint
+func RecordClientCertificates(config *tls.Config) {
+	config.ClientAuth = tls.RequestClientCert
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		address := hello.Conn.RemoteAddr().String()
+
+		// a new connection must not see the certificate of an
+		// earlier one from the same address
+		forgetFingerprint(address)
+
+		c := config.Clone()
+		c.GetConfigForClient = nil
+		c.VerifyPeerCertificate = func(certificates [][]byte, _ [][]*x509.Certificate) error {
+			if 0 != len(certificates) {
+				recordFingerprint(address, Fingerprint(certificates[0]), time.Now())
+			}
+			return nil
+		}
+		return c, nil
+	}
+}
+
+// the fingerprint of the client certificate of a TLS connection
+//
+// conn is a *tls.Conn, for which the handshake is completed first, or
+// the listener's client connection of a server configured by
+// RecordClientCertificates; returns nil if the client did not send a
+// certificate
+func ClientFingerprint(conn interface{}) *FingerprintBytes {
+	if c, ok := conn.(interface {
+		ConnectionState() tls.ConnectionState
+	}); ok {
+		if h, ok := conn.(interface {
+			Handshake() error
+		}); ok {
+			if err := h.Handshake(); nil != err {
+				return nil
+			}
+		}
+		state := c.ConnectionState()
+		if 0 == len(state.PeerCertificates) {
+			return nil
+		}
+		fingerprint := Fingerprint(state.PeerCertificates[0].Raw)
+		return &fingerprint
+	}
+
+	address := ""
+	switch c := conn.(type) {
+	case remoteAddressString:
+		address = c.RemoteAddr()
+	case remoteAddress:
+		if a := c.RemoteAddr(); nil != a {
+			address = a.String()
+		}
+	}
+	if "" == address {
+		return nil
+	}
+
+	clientCertificates.Lock()
+	defer clientCertificates.Unlock()
+
+	r, found := clientCertificates.fingerprints[address]
+	if !found || time.Since(r.recorded) >= fingerprintLifetime {
+		return nil
+	}
+	fingerprint := r.fingerprint
+	return &fingerprint
+}
+
+// save the fingerprint sent from an address
+func recordFingerprint(address string, fingerprint FingerprintBytes, now time.Time) {
+	clientCertificates.Lock()
+	defer clientCertificates.Unlock()
+
+	// occasionally discard old entries
+	if now.Sub(clientCertificates.purged) >= fingerprintLifetime {
+		for a, r := range clientCertificates.fingerprints {
+			if now.Sub(r.recorded) >= fingerprintLifetime {
+				delete(clientCertificates.fingerprints, a)
+			}
+		}
+		clientCertificates.purged = now
+	}
+
+	clientCertificates.fingerprints[address] = recordedFingerprint{
+		fingerprint: fingerprint,
+		recorded:    now,
+	}
+}
+
+// discard any fingerprint sent from an address
+func forgetFingerprint(address string) {
+	clientCertificates.Lock()
+	delete(clientCertificates.fingerprints, address)
+	clientCertificates.Unlock()
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2014-2015 Bitmark Inc.
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package util_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/bitmark-inc/bitmarkd/fault"
+	"github.com/bitmark-inc/bitmarkd/util"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// like the listener's client connection: only the address string
+type wrappedConnection struct {
+	io.ReadWriteCloser
+	address string
+}
+
+func (c *wrappedConnection) RemoteAddr() string {
+	return c.address
+}
+
+// a connected pair of TCP connections on the loopback interface
+func loopbackConnection(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("listen error: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if nil != err {
+		t.Fatalf("dial error: %v", err)
+	}
+	server := <-accepted
+	if nil == server {
+		t.Fatalf("accept failed")
+	}
+	return client, server
+}
+
+// test the client address of real and wrapped connections
+func TestClientAddress(t *testing.T) {
+
+	client, server := loopbackConnection(t)
+	defer client.Close()
+	defer server.Close()
+
+	address, err := util.ClientAddress(server)
+	if nil != err {
+		t.Fatalf("net.Conn: error: %v", err)
+	}
+	if "127.0.0.1" != address {
+		t.Errorf("net.Conn: address: %q  expected: 127.0.0.1", address)
+	}
+
+	wrapped := &wrappedConnection{
+		ReadWriteCloser: server,
+		address:         server.RemoteAddr().String(),
+	}
+	address, err = util.ClientAddress(wrapped)
+	if nil != err {
+		t.Fatalf("wrapped: error: %v", err)
+	}
+	if "127.0.0.1" != address {
+		t.Errorf("wrapped: address: %q  expected: 127.0.0.1", address)
+	}
+
+	// no address must not be treated as a valid client
+	anonymous := struct{ io.ReadWriteCloser }{server}
+	if _, err := util.ClientAddress(anonymous); fault.ErrClientAddressMissing != err {
+		t.Errorf("anonymous: expected ErrClientAddressMissing but got: %v", err)
+	}
+	if _, err := util.ClientAddress(&wrappedConnection{}); fault.ErrClientAddressMissing != err {
+		t.Errorf("empty: expected ErrClientAddressMissing but got: %v", err)
+	}
+}
+
+// a self signed certificate
+func testCertificate(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatalf("generate key error: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if nil != err {
+		t.Fatalf("create certificate error: %v", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
+
+// connect a TLS client, optionally sending a certificate
+//
+// returns the server side connection after the handshake and its
+// remote address
+func tlsConnection(t *testing.T, config *tls.Config, certificate *tls.Certificate) (*tls.Conn, string) {
+	client, server := loopbackConnection(t)
+
+	clientConfig := &tls.Config{
+		InsecureSkipVerify: true,
+	}
+	if nil != certificate {
+		clientConfig.Certificates = []tls.Certificate{*certificate}
+	}
+	tlsClient := tls.Client(client, clientConfig)
+	go func() {
+		tlsClient.Handshake()
+	}()
+
+	tlsServer := tls.Server(server, config)
+	if err := tlsServer.Handshake(); nil != err {
+		t.Fatalf("handshake error: %v", err)
+	}
+	return tlsServer, server.RemoteAddr().String()
+}
+
+// test the client certificate fingerprint of real and wrapped connections
+func TestClientFingerprint(t *testing.T) {
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "server")},
+	}
+	util.RecordClientCertificates(config)
+
+	certificate := testCertificate(t, "client")
+	expected := util.Fingerprint(certificate.Certificate[0])
+
+	conn, address := tlsConnection(t, config, &certificate)
+	defer conn.Close()
+
+	fingerprint := util.ClientFingerprint(conn)
+	if nil == fingerprint || expected != *fingerprint {
+		t.Errorf("tls.Conn: fingerprint: %x  expected: %x", fingerprint, expected)
+	}
+
+	wrapped := &wrappedConnection{
+		ReadWriteCloser: conn,
+		address:         address,
+	}
+	fingerprint = util.ClientFingerprint(wrapped)
+	if nil == fingerprint || expected != *fingerprint {
+		t.Errorf("wrapped: fingerprint: %x  expected: %x", fingerprint, expected)
+	}
+
+	// no certificate sent
+	anonymous, address := tlsConnection(t, config, nil)
+	defer anonymous.Close()
+
+	if fingerprint := util.ClientFingerprint(anonymous); nil != fingerprint {
+		t.Errorf("tls.Conn without certificate: fingerprint: %x", *fingerprint)
+	}
+	wrapped = &wrappedConnection{
+		ReadWriteCloser: anonymous,
+		address:         address,
+	}
+	if fingerprint := util.ClientFingerprint(wrapped); nil != fingerprint {
+		t.Errorf("wrapped without certificate: fingerprint: %x", *fingerprint)
+	}
+
+	// not a TLS connection
+	if fingerprint := util.ClientFingerprint(&wrappedConnection{}); nil != fingerprint {
+		t.Errorf("no address: fingerprint: %x", *fingerprint)
+	}
+}